@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/utility"
+)
+
+// configFlag binds a command-line flag to the environment variable it overrides.
+type configFlag struct {
+	name  string
+	env   string
+	usage string
+}
+
+// serverFlags are the config overrides accepted by serve and config print.
+var serverFlags = []configFlag{
+	{"port", "APP_PORT", "port to listen on"},
+	{"grpc-port", "GRPC_PORT", "port to serve the gRPC API on; empty disables it"},
+	{"log-level", "LOG_LEVEL", "log level"},
+	{"rulesets", "RULESETS_FILE", "rulesets file"},
+	{"api-keys", "API_KEYS_FILE", "API keys file"},
+	{"store", "STORE_FILE", "store snapshot file; empty keeps receipts in memory only"},
+	{"capture", "CAPTURE_FILE", "capture process requests to this JSONL file"},
+}
+
+// addConfigFlags registers --config and the server overrides on fs. The
+// returned function loads the layered config once fs has been parsed: the
+// defaults, then the config file, then the environment, then the flags that
+// were given.
+func addConfigFlags(fs *flag.FlagSet) func() (*config.Config, error) {
+	file := fs.String("config", "", "YAML or TOML config file ("+config.FileEnv+")")
+	for _, f := range serverFlags {
+		fs.String(f.name, "", f.usage+" ("+f.env+")")
+	}
+	return func() (*config.Config, error) {
+		overrides := map[string]string{}
+		fs.Visit(func(set *flag.Flag) {
+			for _, f := range serverFlags {
+				if f.name == set.Name {
+					overrides[f.env] = set.Value.String()
+				}
+			}
+		})
+		return config.Load(*file, overrides)
+	}
+}
+
+// settingFlags are subcommand flags that default to a config setting.
+var settingFlags = map[string]func(*config.Config) string{
+	"rulesets": func(c *config.Config) string { return c.RulesetsFile },
+	// validate's --rulesets names files to check, so receipts use this one
+	"receipt-rulesets": func(c *config.Config) string { return c.RulesetsFile },
+	"store":            func(c *config.Config) string { return c.StoreFile },
+	"columns":          func(c *config.Config) string { return c.CSVImportColumns },
+	"templates":        func(c *config.Config) string { return c.EmailTemplatesFile },
+}
+
+// addConfigFileFlag registers --config on a subcommand. The returned function
+// loads the layered config once fs has been parsed, applies its validation
+// profile and sets each of the named settingFlags that was not given to its
+// configured value.
+func addConfigFileFlag(fs *flag.FlagSet, names ...string) func() error {
+	file := fs.String("config", "", "YAML or TOML config file ("+config.FileEnv+")")
+	return func() error {
+		cfg, err := config.Load(*file, nil)
+		if err != nil {
+			return err
+		}
+		given := map[string]bool{}
+		fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+		for _, name := range names {
+			if !given[name] {
+				fs.Set(name, settingFlags[name](cfg))
+			}
+		}
+		profile, err := cfg.ValidationRules()
+		if err != nil {
+			return err
+		}
+		utility.SetValidationProfile(profile)
+		return nil
+	}
+}
+
+// runConfig implements `receipt-processor config print`, which shows the
+// effective configuration with secrets masked.
+func runConfig(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "yaml", "output format: yaml or toml")
+	loadConfig := addConfigFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: receipt-processor config print [flags]")
+		fmt.Fprintln(stderr, "Prints the effective configuration (defaults, config file, environment and flags)")
+		fmt.Fprintln(stderr, "with secrets masked. The output can be used as a config file.")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "print" {
+		if len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+			fs.Usage()
+			return exitOK
+		}
+		fs.Usage()
+		return exitUsage
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *format != "yaml" && *format != "toml" {
+		fmt.Fprintf(stderr, "config: unknown format %q\n", *format)
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(stderr, "config: %v\n", err)
+		return exitUsage
+	}
+	out, err := cfg.Masked().Encode(*format)
+	if err != nil {
+		fmt.Fprintf(stderr, "config: %v\n", err)
+		return exitError
+	}
+	stdout.Write(out)
+	return exitOK
+}
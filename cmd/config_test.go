@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunConfigPrint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("app_port: \"9000\"\nlog_level: debug\ngrpc_port: \"9090\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LOG_LEVEL", "")
+	t.Setenv("API_KEYS", "pos-1:abc:receipts:write")
+
+	var stdout, stderr bytes.Buffer
+	code := runConfig([]string{"print", "--config", path, "--port", "9001"}, strings.NewReader(""), &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("runConfig() exit code = %d; stderr: %s", code, stderr.String())
+	}
+	out := stdout.String()
+	if !strings.Contains(out, `app_port: "9001"`) || !strings.Contains(out, "log_level: debug") {
+		t.Errorf("expected flags to override the file: %s", out)
+	}
+	if strings.Contains(out, "pos-1") {
+		t.Errorf("expected secrets to be masked: %s", out)
+	}
+
+	// An empty flag clears a setting from the file
+	stdout.Reset()
+	if code := runConfig([]string{"print", "--config", path, "--log-level", "info", "--grpc-port="}, strings.NewReader(""), &stdout, &stderr); code != exitOK {
+		t.Fatalf("runConfig() exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if out := stdout.String(); !strings.Contains(out, `grpc_port: ""`) {
+		t.Errorf("expected --grpc-port= to disable gRPC: %s", out)
+	}
+
+	if code := runConfig([]string{"print", "--port", "0"}, strings.NewReader(""), &stdout, &stderr); code != exitUsage {
+		t.Errorf("expected exit code %d for an invalid config; got %d", exitUsage, code)
+	}
+	if code := runConfig(nil, strings.NewReader(""), &stdout, &stderr); code != exitUsage {
+		t.Errorf("expected exit code %d without a subcommand; got %d", exitUsage, code)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"receipt-processor/internal/ingest"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/services"
+)
+
+// runIngestEmail implements `receipt-processor ingest-eml`. It parses
+// e-receipt emails (.eml files, or one message on stdin) with the same
+// templates as the server's /receipts/email, then validates and scores them.
+// The json format includes the parsed receipt.
+func runIngestEmail(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("ingest-eml", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "text", "output format: text or json")
+	templatesFile := fs.String("templates", "", "email templates file (defaults to EMAIL_TEMPLATES_FILE)")
+	rulesetsFile := fs.String("rulesets", "", "rulesets file (defaults to RULESETS_FILE or the built-in rules)")
+	tenantID := fs.String("tenant", services.DefaultTenant, "tenant whose ruleset is applied")
+	logLevel := fs.String("log-level", "fatal", "log level for diagnostics written to stderr")
+	loadConfig := addConfigFileFlag(fs, "templates", "rulesets")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: receipt-processor ingest-eml [flags] [file.eml ...]")
+		fmt.Fprintln(stderr, "Parses and scores e-receipt emails, or one message read from stdin when no file (or -) is given.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(stderr, "ingest-eml: unknown format %q\n", *format)
+		return exitUsage
+	}
+	if err := loadConfig(); err != nil {
+		fmt.Fprintf(stderr, "ingest-eml: invalid configuration: %v\n", err)
+		return exitUsage
+	}
+	logger.InitCLILogger(*logLevel)
+
+	templates, err := ingest.LoadEmailTemplates(*templatesFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "ingest-eml: %v\n", err)
+		return exitUsage
+	}
+	rulesets, err := services.LoadRulesets(*rulesetsFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "ingest-eml: %v\n", err)
+		return exitUsage
+	}
+	ruleset := rulesets.For(*tenantID)
+
+	sources := fs.Args()
+	if len(sources) == 0 {
+		sources = []string{"-"}
+	}
+
+	code := exitOK
+	encoder := json.NewEncoder(stdout)
+	for _, source := range sources {
+		var data []byte
+		if source == "-" {
+			source = "stdin"
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(source)
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "ingest-eml: %v\n", err)
+			code = exitError
+			continue
+		}
+
+		var result scoreResult
+		receipt, err := ingest.ParseEmail(bytes.NewReader(data), templates)
+		if err != nil {
+			result = scoreResult{Source: source, Error: err.Error()}
+		} else {
+			result = scoreDecoded(source, receipt, ruleset)
+			result.Receipt = &receipt
+		}
+		if result.Error != "" && code == exitOK {
+			code = exitInvalid
+		}
+		if *format == "json" {
+			if err := encoder.Encode(result); err != nil {
+				fmt.Fprintf(stderr, "ingest-eml: %v\n", err)
+				return exitError
+			}
+			continue
+		}
+		writeScoreText(stdout, result)
+	}
+	return code
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const shopEmail = `From: Example Shop <orders@mail.exampleshop.com>
+Date: Tue, 15 Mar 2022 09:30:00 +0000
+Content-Type: text/html; charset=utf-8
+
+<p>Order placed: March 14, 2022</p>
+<table>
+<tr><td>Coffee Beans</td><td>$12.00</td></tr>
+<tr><td>Order total</td><td>$12.00</td></tr>
+</table>
+`
+
+const shopTemplates = `{"templates": [{
+	"domain": "exampleshop.com",
+	"retailer": "Example Shop",
+	"date": "^Order placed: (?P<date>.+)$",
+	"dateLayout": "January 2, 2006",
+	"item": "^(?P<description>.+?) \\$(?P<price>\\d+\\.\\d{2})$",
+	"total": "^Order total \\$(?P<total>\\d+\\.\\d{2})$"
+}]}`
+
+func TestRunIngestEmail(t *testing.T) {
+	dir := t.TempDir()
+	emailPath := filepath.Join(dir, "order.eml")
+	templatesPath := filepath.Join(dir, "templates.json")
+	if err := os.WriteFile(emailPath, []byte(shopEmail), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(templatesPath, []byte(shopTemplates), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := runIngestEmail([]string{"--templates", templatesPath, "--format", "json", emailPath}, strings.NewReader(""), &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("runIngestEmail() exit code = %d; stdout: %s stderr: %s", code, stdout.String(), stderr.String())
+	}
+	var result scoreResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	// 11 retailer characters, 50 + 25 for a round total, 3 for "Coffee Beans"
+	if result.Receipt == nil || result.Receipt.Retailer != "Example Shop" || result.Receipt.PurchaseDate != "2022-03-14" ||
+		result.Points != 11+50+25+3 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	// Without the template the HTML is parsed like a printed receipt, which
+	// has no TOTAL line
+	stdout.Reset()
+	code = runIngestEmail([]string{"--templates", ""}, strings.NewReader(shopEmail), &stdout, &stderr)
+	if code != exitInvalid || !strings.Contains(stdout.String(), "stdin: invalid: no TOTAL line found") {
+		t.Errorf("expected the untemplated email to be missing a total; got %d: %s", code, stdout.String())
+	}
+
+	if code := runIngestEmail([]string{"--templates", filepath.Join(dir, "missing.json")}, strings.NewReader(""), &stdout, &stderr); code != exitUsage {
+		t.Errorf("expected a missing templates file to be a usage error; got %d", code)
+	}
+}
@@ -1,28 +1,90 @@
 package main
 
 import (
+	"fmt"
+	"io"
 	"log"
 	"os"
-	"receipt-processor/internal/logger"
-	"receipt-processor/internal/server"
+	"text/tabwriter"
+	_ "time/tzdata" // receipt and ruleset time zones work on hosts without a zoneinfo database
 
 	"github.com/joho/godotenv"
-	"github.com/sirupsen/logrus"
 )
 
+// Exit codes shared by the subcommands.
+const (
+	exitOK      = 0
+	exitInvalid = 1 // at least one input failed validation
+	exitUsage   = 2 // bad flags or configuration
+	exitError   = 3 // an I/O or runtime error stopped the command
+)
+
+// command is a subcommand of the receipt-processor binary.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "run the HTTP server (the default when no command is given)", runServe},
+		{"validate", "check receipt and rulesets files", runValidate},
+		{"score", "score receipt files without running the server", runScore},
+		{"ingest-eml", "parse and score e-receipt emails (.eml files)", runIngestEmail},
+		{"replay", "replay recorded process requests against a ruleset", runReplay},
+		{"migrate", "upgrade a store snapshot to the current format", runMigrate},
+		{"export", "dump stored receipts and points as JSONL or CSV", runExport},
+		{"import", "bulk-load receipts into a store snapshot, keeping their IDs", runImport},
+		{"config", "print the effective configuration (config print)", runConfig},
+		{"help", "show this help", runHelp},
+	}
+}
+
 func main() {
+	// Load .env once, before any command reads the environment
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found. Using environment variables.")
 	}
+	os.Exit(dispatch(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
 
-	logLevel := os.Getenv("LOG_LEVEL")
-	logger.InitLogger(logLevel)
+// dispatch runs the subcommand named by args[0], defaulting to serve.
+func dispatch(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		return runServe(nil, stdin, stdout, stderr)
+	}
+	switch args[0] {
+	case "-h", "-help", "--help":
+		return runHelp(nil, stdin, stdout, stderr)
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(args[1:], stdin, stdout, stderr)
+		}
+	}
+	fmt.Fprintf(stderr, "receipt-processor: unknown command %q\n", args[0])
+	writeUsage(stderr)
+	return exitUsage
+}
+
+func runHelp(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	writeUsage(stdout)
+	return exitOK
+}
 
-	if err := server.Run(); err != nil {
-		logger.Error("Failed to start server", logrus.Fields{
-			"error": err,
-		})
-	} else {
-		logger.Info("Server started successfully", logrus.Fields{})
+func writeUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: receipt-processor <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
 	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'receipt-processor <command> --help' for the flags of a command.")
+	fmt.Fprintln(w, "Exit codes: 0 ok, 1 invalid input, 2 usage error, 3 I/O or runtime error.")
 }
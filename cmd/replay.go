@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/replay"
+	"receipt-processor/internal/services"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+)
+
+// runReplay implements `receipt-processor replay`. It replays a JSONL
+// recording of process requests in memory and prints a summary, optionally
+// comparing the points awarded under a second rulesets file.
+func runReplay(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "text", "output format: text or json")
+	rulesetsFile := fs.String("rulesets", "", "rulesets file (defaults to RULESETS_FILE or the built-in rules)")
+	compareFile := fs.String("compare", "", "second rulesets file to compare against")
+	logLevel := fs.String("log-level", "fatal", "log level for diagnostics written to stderr")
+	loadConfig := addConfigFileFlag(fs, "rulesets")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: receipt-processor replay [flags] [recording.jsonl]")
+		fmt.Fprintln(stderr, "Replays recorded process requests (stdin when no file or - is given) and summarises the results.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(stderr, "replay: unknown format %q\n", *format)
+		return exitUsage
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := loadConfig(); err != nil {
+		fmt.Fprintf(stderr, "replay: invalid configuration: %v\n", err)
+		return exitUsage
+	}
+	logger.InitCLILogger(*logLevel)
+
+	opts := replay.Options{}
+	var err error
+	if opts.Rulesets, err = services.LoadRulesets(*rulesetsFile); err != nil {
+		fmt.Fprintf(stderr, "replay: %v\n", err)
+		return exitUsage
+	}
+	if *compareFile != "" {
+		if opts.Compare, err = services.LoadRulesets(*compareFile); err != nil {
+			fmt.Fprintf(stderr, "replay: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	input := stdin
+	if path := fs.Arg(0); path != "" && path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "replay: %v\n", err)
+			return exitError
+		}
+		defer file.Close()
+		input = file
+	}
+
+	summary, err := replay.Run(input, opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "replay: %v\n", err)
+		return exitInvalid
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(summary); err != nil {
+			fmt.Fprintf(stderr, "replay: %v\n", err)
+			return exitError
+		}
+		return exitOK
+	}
+	writeReplayText(stdout, summary, *rulesetsFile, *compareFile)
+	return exitOK
+}
+
+func writeReplayText(w io.Writer, s *replay.Summary, rulesetsName, compareName string) {
+	if rulesetsName == "" {
+		rulesetsName = "built-in"
+	}
+
+	rejected := 0
+	reasons := make([]string, 0, len(s.Rejected))
+	for reason, n := range s.Rejected {
+		rejected += n
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if s.Rejected[reasons[i]] != s.Rejected[reasons[j]] {
+			return s.Rejected[reasons[i]] > s.Rejected[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+
+	fmt.Fprintf(w, "Replayed %d records\n", s.Total)
+	fmt.Fprintf(w, "  accepted:   %d\n", s.Accepted)
+	fmt.Fprintf(w, "  duplicates: %d\n", s.Duplicates)
+	fmt.Fprintf(w, "  rejected:   %d\n", rejected)
+	for _, reason := range reasons {
+		fmt.Fprintf(w, "    %6d  %s\n", s.Rejected[reason], reason)
+	}
+
+	fmt.Fprintf(w, "\nPoints (%s)\n", rulesetsName)
+	writeDistribution(w, s.Points)
+
+	if s.ComparePoints == nil {
+		return
+	}
+	fmt.Fprintf(w, "\nPoints (%s)\n", compareName)
+	writeDistribution(w, *s.ComparePoints)
+
+	up, down := 0, 0
+	for _, c := range s.Changes {
+		if c.Delta > 0 {
+			up++
+		} else {
+			down++
+		}
+	}
+	fmt.Fprintf(w, "\nChanged receipts: %d (%d up, %d down)\n", len(s.Changes), up, down)
+	if len(s.Changes) == 0 {
+		return
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  LINE\tTENANT\tRETAILER\tDATE\tPOINTS\tCOMPARE\tDELTA")
+	for _, c := range s.Changes {
+		fmt.Fprintf(tw, "  %d\t%s\t%s\t%s\t%d\t%d\t%+d\n", c.Line, c.Tenant, c.Retailer, c.PurchaseDate, c.Points, c.ComparePoints, c.Delta)
+	}
+	tw.Flush()
+}
+
+func writeDistribution(w io.Writer, d replay.Distribution) {
+	if d.Count == 0 {
+		fmt.Fprintln(w, "  no accepted receipts")
+		return
+	}
+	fmt.Fprintf(w, "  count %d, total %d, min %d, median %d, p90 %d, max %d, mean %.1f\n",
+		d.Count, d.Sum, d.Min, d.Median, d.P90, d.Max, d.Mean)
+	for _, b := range d.Buckets {
+		label := strconv.Itoa(b.Min) + "+"
+		if b.Max >= 0 {
+			label = strconv.Itoa(b.Min) + "-" + strconv.Itoa(b.Max)
+		}
+		fmt.Fprintf(w, "  %-8s %d\n", label, b.Count)
+	}
+}
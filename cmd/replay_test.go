@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"receipt-processor/internal/replay"
+	"strings"
+	"testing"
+)
+
+func TestRunReplay(t *testing.T) {
+	dir := t.TempDir()
+	compare := filepath.Join(dir, "compare.json")
+	if err := os.WriteFile(compare, []byte(`{"default": {"oddDayPoints": 20}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	compact := strings.Join(strings.Fields(targetReceipt), " ")
+	stdin := compact + "\n" + `{"tenant": "partner-a", "receipt": ` + compact + "}\n" + "not json\n"
+
+	var stdout, stderr bytes.Buffer
+	code := runReplay([]string{"--format", "json", "--compare", compare}, strings.NewReader(stdin), &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("runReplay() exit code = %d; stderr: %s", code, stderr.String())
+	}
+
+	var summary replay.Summary
+	if err := json.Unmarshal(stdout.Bytes(), &summary); err != nil {
+		t.Fatalf("invalid JSON output: %v", err)
+	}
+	if summary.Accepted != 2 || len(summary.Changes) != 2 || summary.Changes[0].Delta != 14 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+
+	stdout.Reset()
+	code = runReplay([]string{"--compare", compare}, strings.NewReader(stdin), &stdout, &stderr)
+	if code != exitOK || !strings.Contains(stdout.String(), "Changed receipts: 2 (2 up, 0 down)") {
+		t.Errorf("unexpected text output (exit %d): %s", code, stdout.String())
+	}
+}
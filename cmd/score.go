@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/services"
+	"strings"
+)
+
+// scoreResult is the outcome of scoring a single receipt input.
+type scoreResult struct {
+	Source    string                `json:"source"`
+	Receipt   *model.Receipt        `json:"receipt,omitempty"` // set when the receipt was parsed from another format
+	Points    int                   `json:"points"`
+	Breakdown []services.RuleResult `json:"breakdown,omitempty"`
+	Error     string                `json:"error,omitempty"`
+}
+
+// runScore implements `receipt-processor score`. It validates and scores
+// receipts from files (one JSON document each, or NDJSON for .jsonl/.ndjson)
+// or NDJSON on stdin, using the same decode, validate and scoring path as the
+// HTTP handler.
+func runScore(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("score", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "text", "output format: text or json")
+	rulesetsFile := fs.String("rulesets", "", "rulesets file (defaults to RULESETS_FILE or the built-in rules)")
+	tenantID := fs.String("tenant", services.DefaultTenant, "tenant whose ruleset is applied")
+	logLevel := fs.String("log-level", "fatal", "log level for diagnostics written to stderr")
+	loadConfig := addConfigFileFlag(fs, "rulesets")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: receipt-processor score [flags] [file ...]")
+		fmt.Fprintln(stderr, "Scores receipt JSON files, or NDJSON read from stdin when no file (or -) is given.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(stderr, "score: unknown format %q\n", *format)
+		return exitUsage
+	}
+	if err := loadConfig(); err != nil {
+		fmt.Fprintf(stderr, "score: invalid configuration: %v\n", err)
+		return exitUsage
+	}
+	logger.InitCLILogger(*logLevel)
+
+	rulesets, err := services.LoadRulesets(*rulesetsFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "score: %v\n", err)
+		return exitUsage
+	}
+	ruleset := rulesets.For(*tenantID)
+
+	sources := fs.Args()
+	if len(sources) == 0 {
+		sources = []string{"-"}
+	}
+
+	code := exitOK
+	encoder := json.NewEncoder(stdout)
+	for _, source := range sources {
+		inputs, err := readReceiptInputs(source, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "score: %v\n", err)
+			code = exitError
+			continue
+		}
+		for _, input := range inputs {
+			result := scoreInput(input, ruleset)
+			if result.Error != "" && code == exitOK {
+				code = exitInvalid
+			}
+			if *format == "json" {
+				if err := encoder.Encode(result); err != nil {
+					fmt.Fprintf(stderr, "score: %v\n", err)
+					return exitError
+				}
+				continue
+			}
+			writeScoreText(stdout, result)
+		}
+	}
+	return code
+}
+
+// receiptInput is one raw receipt document and where it came from.
+type receiptInput struct {
+	source string
+	body   []byte
+}
+
+// readReceiptInputs reads a single-document JSON file, or NDJSON from a
+// .jsonl/.ndjson file or from stdin when source is "-".
+func readReceiptInputs(source string, stdin io.Reader) ([]receiptInput, error) {
+	if source == "-" {
+		return readNDJSON("stdin", stdin)
+	}
+
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(source)) {
+	case ".jsonl", ".ndjson":
+		return readNDJSON(source, bytes.NewReader(data))
+	default:
+		return []receiptInput{{source: source, body: data}}, nil
+	}
+}
+
+// readNDJSON splits r into one input per non-blank line, labelled name:line.
+func readNDJSON(name string, r io.Reader) ([]receiptInput, error) {
+	var inputs []receiptInput
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		inputs = append(inputs, receiptInput{
+			source: fmt.Sprintf("%s:%d", name, line),
+			body:   append([]byte(nil), text...),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %v", name, err)
+	}
+	return inputs, nil
+}
+
+func scoreInput(input receiptInput, ruleset services.Ruleset) scoreResult {
+	receipt, err := model.DecodeReceipt(input.body)
+	if err != nil {
+		return scoreResult{Source: input.source, Error: err.Error()}
+	}
+	return scoreDecoded(input.source, receipt, ruleset)
+}
+
+// scoreDecoded validates and scores a decoded receipt.
+func scoreDecoded(source string, receipt model.Receipt, ruleset services.Ruleset) scoreResult {
+	result := scoreResult{Source: source}
+	if err := services.ValidateReceipt(receipt, ruleset); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	score := services.ScoreReceipt(receipt, ruleset)
+	result.Points = score.Points
+	result.Breakdown = score.Breakdown
+	return result
+}
+
+func writeScoreText(w io.Writer, result scoreResult) {
+	if result.Error != "" {
+		fmt.Fprintf(w, "%s: invalid: %s\n", result.Source, result.Error)
+		return
+	}
+	fmt.Fprintf(w, "%s: %d points\n", result.Source, result.Points)
+	for _, line := range result.Breakdown {
+		fmt.Fprintf(w, "  %d points - %s\n", line.Points, line.Reason)
+		if line.Detail != "" {
+			fmt.Fprintf(w, "            %s\n", line.Detail)
+		}
+	}
+}
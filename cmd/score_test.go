@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const targetReceipt = `{
+	"retailer": "Target",
+	"purchaseDate": "2022-01-01",
+	"purchaseTime": "13:01",
+	"items": [
+		{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+		{"shortDescription": "Emils Cheese Pizza", "price": "12.25"},
+		{"shortDescription": "Knorr Creamy Chicken", "price": "1.26"},
+		{"shortDescription": "Doritos Nacho Cheese", "price": "3.35"},
+		{"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ", "price": "12.00"}
+	],
+	"total": "35.35"
+}`
+
+func TestRunScore_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "target.json")
+	if err := os.WriteFile(path, []byte(targetReceipt), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := runScore([]string{path}, strings.NewReader(""), &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("runScore() exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "target.json: 28 points") {
+		t.Errorf("unexpected output: %s", stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "6 points - purchase day is odd") {
+		t.Errorf("expected breakdown in output: %s", stdout.String())
+	}
+}
+
+func TestRunScore_ConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	receiptPath := filepath.Join(dir, "target.json")
+	rulesetsPath := filepath.Join(dir, "rulesets.json")
+	configPath := filepath.Join(dir, "config.yaml")
+	for path, content := range map[string]string{
+		receiptPath:  targetReceipt,
+		rulesetsPath: `{"default": {"version": "v2", "oddDayPoints": 8}}`,
+		configPath:   "rulesets_file: " + rulesetsPath + "\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("RULESETS_FILE", "")
+
+	var stdout, stderr bytes.Buffer
+	code := runScore([]string{"--config", configPath, receiptPath}, strings.NewReader(""), &stdout, &stderr)
+	if code != exitOK || !strings.Contains(stdout.String(), "target.json: 30 points") {
+		t.Errorf("expected the config file's rulesets to be used; got %d: %s%s", code, stdout.String(), stderr.String())
+	}
+
+	stdout.Reset()
+	code = runScore([]string{"--config", configPath, "--rulesets", "", receiptPath}, strings.NewReader(""), &stdout, &stderr)
+	if code != exitOK || !strings.Contains(stdout.String(), "target.json: 28 points") {
+		t.Errorf("expected an empty --rulesets to use the built-in rules; got %d: %s", code, stdout.String())
+	}
+}
+
+func TestRunScore_NDJSONStdin(t *testing.T) {
+	compact := strings.Join(strings.Fields(targetReceipt), " ")
+	stdin := compact + "\n\n" + `{"retailer": "Target", "unknown": true}` + "\n"
+
+	var stdout, stderr bytes.Buffer
+	code := runScore([]string{"--format", "json"}, strings.NewReader(stdin), &stdout, &stderr)
+	if code != exitInvalid {
+		t.Errorf("expected exit code %d when a receipt is invalid; got %d", exitInvalid, code)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 results; got %d: %s", len(lines), stdout.String())
+	}
+	var first, second scoreResult
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+	if first.Source != "stdin:1" || first.Points != 28 || len(first.Breakdown) == 0 {
+		t.Errorf("unexpected first result: %+v", first)
+	}
+	if second.Source != "stdin:3" || second.Error == "" {
+		t.Errorf("expected second result to report an error; got %+v", second)
+	}
+}
+
+func TestRunScore_Usage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := runScore([]string{"--format", "xml"}, strings.NewReader(""), &stdout, &stderr); code != exitUsage {
+		t.Errorf("expected exit code %d for unknown format; got %d", exitUsage, code)
+	}
+	if code := runScore([]string{"missing.json"}, strings.NewReader(""), &stdout, &stderr); code != exitError {
+		t.Errorf("expected exit code %d for unreadable file; got %d", exitError, code)
+	}
+}
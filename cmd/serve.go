@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/server"
+
+	"github.com/sirupsen/logrus"
+)
+
+// runServe implements `receipt-processor serve`, which runs the HTTP server.
+// Flags override the config file and the corresponding environment variables.
+func runServe(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	loadConfig := addConfigFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: receipt-processor serve [flags]")
+		fmt.Fprintln(stderr, "Runs the HTTP server until it receives SIGINT or SIGTERM.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Fprintf(stderr, "serve: invalid configuration: %v\n", err)
+		return exitUsage
+	}
+
+	logger.InitLogger(cfg.LogLevel)
+	if err := server.Run(cfg, loadConfig); err != nil {
+		logger.Error("Failed to start server", logrus.Fields{
+			"error": err,
+		})
+		return exitError
+	}
+	return exitOK
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"receipt-processor/internal/ingest"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/services"
+	"receipt-processor/internal/tenant"
+	"receipt-processor/internal/utility"
+	"strconv"
+	"strings"
+)
+
+// storeErrorCode maps a snapshot error to an exit code: unreadable files are
+// I/O errors, anything else means the contents are invalid.
+func storeErrorCode(err error) int {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return exitError
+	}
+	return exitInvalid
+}
+
+// runMigrate implements `receipt-processor migrate`, which upgrades a store
+// snapshot in place to the format written by this release.
+func runMigrate(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	storeFile := flags.String("store", "", "store snapshot file (defaults to STORE_FILE)")
+	dryRun := flags.Bool("dry-run", false, "report what would change without writing the file")
+	logLevel := flags.String("log-level", "fatal", "log level for diagnostics written to stderr")
+	loadConfig := addConfigFileFlag(flags, "store")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: receipt-processor migrate [flags]")
+		fmt.Fprintf(stderr, "Upgrades a store snapshot to format version %d.\n", services.SnapshotVersion)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if err := loadConfig(); err != nil {
+		fmt.Fprintf(stderr, "migrate: invalid configuration: %v\n", err)
+		return exitUsage
+	}
+	if *storeFile == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	logger.InitCLILogger(*logLevel)
+
+	data, err := os.ReadFile(*storeFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "migrate: %v\n", err)
+		return exitError
+	}
+	snapshot, from, err := services.MigrateSnapshot(data)
+	if err != nil {
+		fmt.Fprintf(stderr, "migrate: %s: %v\n", *storeFile, err)
+		return exitInvalid
+	}
+	if from == services.SnapshotVersion {
+		fmt.Fprintf(stdout, "%s: already at version %d\n", *storeFile, from)
+		return exitOK
+	}
+	if !*dryRun {
+		if err := services.WriteSnapshot(*storeFile, snapshot); err != nil {
+			fmt.Fprintf(stderr, "migrate: %v\n", err)
+			return exitError
+		}
+	}
+	fmt.Fprintf(stdout, "%s: migrated from version %d to %d (%d receipts)\n",
+		*storeFile, from, services.SnapshotVersion, len(snapshot.Receipts))
+	return exitOK
+}
+
+// runExport implements `receipt-processor export`, which dumps the receipts
+// in a store snapshot with their points as JSONL or CSV.
+func runExport(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	storeFile := flags.String("store", "", "store snapshot file (defaults to STORE_FILE)")
+	tenantID := flags.String("tenant", "", "only export this tenant's receipts (default all tenants)")
+	storeID := flags.String("store-id", "", "only export receipts from this store ID")
+	region := flags.String("region", "", "only export receipts from stores in this region")
+	format := flags.String("format", "jsonl", "output format: jsonl or csv")
+	output := flags.String("o", "-", "output file, - for stdout")
+	logLevel := flags.String("log-level", "fatal", "log level for diagnostics written to stderr")
+	loadConfig := addConfigFileFlag(flags, "store")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: receipt-processor export [flags]")
+		fmt.Fprintln(stderr, "Writes stored receipts and their points as JSONL (readable by import) or CSV.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *format != "jsonl" && *format != "csv" {
+		fmt.Fprintf(stderr, "export: unknown format %q\n", *format)
+		return exitUsage
+	}
+	if err := loadConfig(); err != nil {
+		fmt.Fprintf(stderr, "export: invalid configuration: %v\n", err)
+		return exitUsage
+	}
+	if *storeFile == "" || flags.NArg() > 0 {
+		flags.Usage()
+		return exitUsage
+	}
+	logger.InitCLILogger(*logLevel)
+
+	snapshot, err := services.ReadSnapshot(*storeFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "export: %v\n", err)
+		return storeErrorCode(err)
+	}
+	var list []services.StoredReceipt
+	for _, r := range snapshot.Receipts {
+		if *tenantID != "" && r.Tenant != *tenantID {
+			continue
+		}
+		if *storeID != "" || *region != "" {
+			if r.Receipt == nil || r.Receipt.Store == nil ||
+				*storeID != "" && !strings.EqualFold(r.Receipt.Store.ID, *storeID) ||
+				*region != "" && !strings.EqualFold(r.Receipt.Store.Region, *region) {
+				continue
+			}
+		}
+		list = append(list, r)
+	}
+
+	w := stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(stderr, "export: %v\n", err)
+			return exitError
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if *format == "csv" {
+		err = writeExportCSV(w, list)
+	} else {
+		err = writeExportJSONL(w, list)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "export: %v\n", err)
+		return exitError
+	}
+	return exitOK
+}
+
+func writeExportJSONL(w io.Writer, list []services.StoredReceipt) error {
+	encoder := json.NewEncoder(w)
+	for _, r := range list {
+		if err := encoder.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportColumns are the CSV export columns, one row per receipt.
+var exportColumns = []string{"id", "tenant", "retailer", "purchaseDate", "purchaseTime", "items", "total", "points", "submittedBy", "storeId", "region"}
+
+func writeExportCSV(w io.Writer, list []services.StoredReceipt) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(utility.EscapeCSVRow(exportColumns)); err != nil {
+		return err
+	}
+	for _, r := range list {
+		receipt := model.Receipt{}
+		if r.Receipt != nil {
+			receipt = *r.Receipt
+		}
+		store := model.Store{}
+		if receipt.Store != nil {
+			store = *receipt.Store
+		}
+		row := []string{
+			r.ID,
+			r.Tenant,
+			receipt.Retailer,
+			receipt.PurchaseDate,
+			receipt.PurchaseTime,
+			strconv.Itoa(len(receipt.Items)),
+			receipt.Total,
+			strconv.Itoa(r.Points),
+			r.SubmittedBy,
+			store.ID,
+			store.Region,
+		}
+		if err := cw.Write(utility.EscapeCSVRow(row)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// importLine is one line of an import file: an exported receipt whose
+// receipt document is decoded strictly, as the process endpoint would.
+type importLine struct {
+	services.StoredReceipt
+	Receipt json.RawMessage `json:"receipt"`
+}
+
+// runImport implements `receipt-processor import`. It bulk-loads receipts in
+// the export JSONL format into a store snapshot, keeping their IDs. Receipts
+// without an explanation are scored with the active rulesets.
+func runImport(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	storeFile := flags.String("store", "", "store snapshot file (defaults to STORE_FILE)")
+	tenantID := flags.String("tenant", services.DefaultTenant, "tenant for lines that do not name one")
+	rulesetsFile := flags.String("rulesets", "", "rulesets used to score unscored receipts (defaults to RULESETS_FILE or the built-in rules)")
+	format := flags.String("format", "jsonl", "input format: jsonl or csv")
+	columnsSpec := flags.String("columns", "", "CSV column mapping as field=header pairs (defaults to CSV_IMPORT_COLUMNS)")
+	logLevel := flags.String("log-level", "fatal", "log level for diagnostics written to stderr")
+	loadConfig := addConfigFileFlag(flags, "store", "rulesets", "columns")
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: receipt-processor import [flags] [file.jsonl|file.csv ...]")
+		fmt.Fprintln(stderr, "Loads receipts in the export JSONL format (stdin when no file or - is given) into a store snapshot.")
+		fmt.Fprintln(stderr, "Each line needs a receipt; id, tenant, points and explanation are kept when present.")
+		fmt.Fprintln(stderr, "With --format csv, each row is an item and rows are grouped into receipts by the receipt column;")
+		fmt.Fprintln(stderr, "every receipt gets a new ID and is scored.")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if err := loadConfig(); err != nil {
+		fmt.Fprintf(stderr, "import: invalid configuration: %v\n", err)
+		return exitUsage
+	}
+	if *storeFile == "" {
+		flags.Usage()
+		return exitUsage
+	}
+	if *format != "jsonl" && *format != "csv" {
+		fmt.Fprintf(stderr, "import: unknown format %q\n", *format)
+		return exitUsage
+	}
+	if !tenant.ValidID(*tenantID) {
+		fmt.Fprintf(stderr, "import: invalid tenant ID %q\n", *tenantID)
+		return exitUsage
+	}
+	columns, err := ingest.ParseCSVColumns(*columnsSpec)
+	if err != nil {
+		fmt.Fprintf(stderr, "import: --columns: %v\n", err)
+		return exitUsage
+	}
+	logger.InitCLILogger(*logLevel)
+
+	rulesets, err := services.LoadRulesets(*rulesetsFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "import: %v\n", err)
+		return exitUsage
+	}
+	if err := services.LoadSnapshot(*storeFile); err != nil {
+		fmt.Fprintf(stderr, "import: %v\n", err)
+		return storeErrorCode(err)
+	}
+
+	sources := flags.Args()
+	if len(sources) == 0 {
+		sources = []string{"-"}
+	}
+
+	code := exitOK
+	imported, duplicates, invalid := 0, 0, 0
+	for _, source := range sources {
+		if *format == "csv" {
+			var results []csvImportResult
+			if source == "-" {
+				results, err = importCSV("stdin", stdin, *tenantID, columns, rulesets)
+			} else if file, openErr := os.Open(source); openErr != nil {
+				err = openErr
+			} else {
+				results, err = importCSV(source, file, *tenantID, columns, rulesets)
+				file.Close()
+			}
+			if err != nil {
+				fmt.Fprintf(stderr, "import: %v\n", err)
+				code = exitError
+				continue
+			}
+			for _, result := range results {
+				switch {
+				case result.err == nil:
+					imported++
+				case errors.Is(result.err, services.ErrDuplicateReceipt):
+					duplicates++
+					fmt.Fprintf(stdout, "%s: duplicate: %v\n", result.source, result.err)
+				default:
+					invalid++
+					fmt.Fprintf(stdout, "%s: invalid: %v\n", result.source, result.err)
+				}
+			}
+			continue
+		}
+
+		var inputs []receiptInput
+		if source == "-" {
+			inputs, err = readNDJSON("stdin", stdin)
+		} else if file, openErr := os.Open(source); openErr != nil {
+			err = openErr
+		} else {
+			inputs, err = readNDJSON(source, file)
+			file.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "import: %v\n", err)
+			code = exitError
+			continue
+		}
+
+		for _, input := range inputs {
+			r, err := parseImportLine(input.body, *tenantID, rulesets)
+			if err == nil {
+				err = services.ImportReceipt(r)
+			}
+			switch {
+			case err == nil:
+				imported++
+			case errors.Is(err, services.ErrDuplicateID) || errors.Is(err, services.ErrDuplicateReceipt):
+				duplicates++
+				fmt.Fprintf(stdout, "%s: duplicate: %v\n", input.source, err)
+			default:
+				invalid++
+				fmt.Fprintf(stdout, "%s: invalid: %v\n", input.source, err)
+			}
+		}
+	}
+
+	if imported > 0 {
+		if _, err := services.SaveSnapshot(*storeFile); err != nil {
+			fmt.Fprintf(stderr, "import: %v\n", err)
+			return exitError
+		}
+	}
+	fmt.Fprintf(stdout, "imported %d, duplicates %d, invalid %d\n", imported, duplicates, invalid)
+	if code == exitOK && duplicates+invalid > 0 {
+		code = exitInvalid
+	}
+	return code
+}
+
+// parseImportLine decodes and validates one import line, filling in the
+// tenant and ID when missing and scoring the receipt against the customer
+// history in the store if it has no explanation.
+func parseImportLine(body []byte, defaultTenant string, rulesets *services.RulesetSet) (services.StoredReceipt, error) {
+	var line importLine
+	if err := json.Unmarshal(body, &line); err != nil {
+		return services.StoredReceipt{}, err
+	}
+	if len(line.Receipt) == 0 {
+		return services.StoredReceipt{}, errors.New("missing receipt")
+	}
+	receipt, err := model.DecodeReceipt(line.Receipt)
+	if err != nil {
+		return services.StoredReceipt{}, err
+	}
+
+	r := line.StoredReceipt
+	r.Receipt = &receipt
+	if r.Tenant == "" {
+		r.Tenant = defaultTenant
+	} else if !tenant.ValidID(r.Tenant) {
+		return services.StoredReceipt{}, fmt.Errorf("invalid tenant ID %q", r.Tenant)
+	}
+	if err := services.ValidateReceipt(receipt, rulesets.For(r.Tenant)); err != nil {
+		return services.StoredReceipt{}, err
+	}
+	if r.ID == "" {
+		r.ID = utility.GenerateID()
+	}
+	// The hash is always recomputed so dedup matches what the server would do
+	r.Hash = ""
+	if r.Explanation == "" {
+		// Earlier lines are already stored, so limits and promotions see them
+		score := services.ScoreReceiptFor(receipt, rulesets.For(r.Tenant), services.CustomerHistoryFor(r.Tenant))
+		r.Points, r.Explanation, r.Promotions = score.Points, score.Explanation(), score.Promotions
+	}
+	return r, nil
+}
+
+// csvImportResult is the outcome of importing one receipt from a CSV file.
+type csvImportResult struct {
+	source string // file name, line numbers and receipt key
+	err    error
+}
+
+// importCSV imports the receipts in a CSV file into the store for the tenant,
+// scoring each with the tenant's ruleset and the customer history already in
+// the store. The error is for a file that cannot be read at all.
+func importCSV(name string, r io.Reader, tenantID string, columns ingest.CSVColumns, rulesets *services.RulesetSet) ([]csvImportResult, error) {
+	parsed, err := ingest.ParseCSV(r, columns)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	rs := rulesets.For(tenantID)
+	var results []csvImportResult
+	for _, rc := range parsed {
+		lines := make([]string, len(rc.Lines))
+		for i, line := range rc.Lines {
+			lines[i] = strconv.Itoa(line)
+		}
+		result := csvImportResult{source: name}
+		if rc.Key != "" {
+			result.source += ":" + strings.Join(lines, ",")
+			result.source += " (" + rc.Key + ")"
+		}
+
+		switch {
+		case len(rc.Errors) > 0:
+			result.err = rc.Errors
+		default:
+			result.err = services.ValidateReceipt(rc.Receipt, rs)
+		}
+		if result.err == nil {
+			// Dedup, scoring and storing happen together, as for the server
+			if _, _, stored := services.ProcessReceipt(tenantID, rc.Receipt, rs, ""); !stored {
+				result.err = services.ErrDuplicateReceipt
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
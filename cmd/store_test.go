@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"receipt-processor/internal/services"
+	"strings"
+	"testing"
+)
+
+func TestImportExport_RoundTrip(t *testing.T) {
+	t.Cleanup(services.ResetStore)
+	storePath := filepath.Join(t.TempDir(), "store.json")
+	receipt := strings.Join(strings.Fields(targetReceipt), " ")
+	input := strings.Join([]string{
+		`{"id": "keep-me", "receipt": ` + receipt + `}`,
+		`{"id": "again", "receipt": ` + receipt + `}`,
+		`{"id": "other", "tenant": "acme", "points": 5, "explanation": "imported", "receipt": ` + receipt + `}`,
+		`{"id": "bad", "receipt": {"retailer": "Target"}}`,
+	}, "\n")
+
+	var stdout, stderr bytes.Buffer
+	code := runImport([]string{"--store", storePath}, strings.NewReader(input), &stdout, &stderr)
+	if code != exitInvalid {
+		t.Errorf("expected exit code %d with a duplicate and an invalid line; got %d", exitInvalid, code)
+	}
+	if !strings.Contains(stdout.String(), "imported 2, duplicates 1, invalid 1") {
+		t.Errorf("unexpected import summary: %s", stdout.String())
+	}
+
+	stdout.Reset()
+	code = runExport([]string{"--store", storePath}, strings.NewReader(""), &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("runExport() exit code = %d; stderr: %s", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 exported receipts; got %d: %s", len(lines), stdout.String())
+	}
+	var exported []services.StoredReceipt
+	for _, line := range lines {
+		var r services.StoredReceipt
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatal(err)
+		}
+		exported = append(exported, r)
+	}
+	if exported[0].ID != "other" || exported[0].Points != 5 || exported[0].Explanation != "imported" {
+		t.Errorf("expected stored points to be kept; got %+v", exported[0])
+	}
+	if exported[1].ID != "keep-me" || exported[1].Points != 28 {
+		t.Errorf("expected the ID to be kept and the receipt scored; got %+v", exported[1])
+	}
+
+	stdout.Reset()
+	code = runExport([]string{"--store", storePath, "--tenant", "acme", "--format", "csv"}, strings.NewReader(""), &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("runExport() exit code = %d; stderr: %s", code, stderr.String())
+	}
+	rows, err := csv.NewReader(&stdout).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[1][0] != "other" || rows[1][2] != "Target" || rows[1][7] != "5" {
+		t.Errorf("unexpected CSV export: %v", rows)
+	}
+}
+
+func TestRunImport_Promotions(t *testing.T) {
+	t.Cleanup(services.ResetStore)
+	dir := t.TempDir()
+	storePath := filepath.Join(dir, "store.json")
+	rulesetsPath := filepath.Join(dir, "rulesets.json")
+	rulesets := `{"default": {"promotions": [{"id": "target", "retailers": ["Target"], "bonus": 100, "perCustomerLimit": 1}]}}`
+	if err := os.WriteFile(rulesetsPath, []byte(rulesets), 0600); err != nil {
+		t.Fatal(err)
+	}
+	receipt := strings.Replace(strings.Join(strings.Fields(targetReceipt), " "), `"retailer":`, `"customerId": "c1", "retailer":`, 1)
+	input := `{"id": "a", "receipt": ` + receipt + "}\n" +
+		`{"id": "b", "receipt": ` + strings.Replace(receipt, "2022-01-01", "2022-01-02", 1) + "}\n"
+
+	var stdout, stderr bytes.Buffer
+	if code := runImport([]string{"--store", storePath, "--rulesets", rulesetsPath}, strings.NewReader(input), &stdout, &stderr); code != exitOK {
+		t.Fatalf("runImport() exit code = %d; stdout: %s stderr: %s", code, stdout.String(), stderr.String())
+	}
+
+	// The second receipt sees the first one's use of the promotion
+	stored := services.ListStoredReceipts(services.DefaultTenant)
+	if len(stored) != 2 {
+		t.Fatalf("expected 2 stored receipts; got %d", len(stored))
+	}
+	if stored[0].Points != 128 || len(stored[0].Promotions) != 1 || stored[0].Promotions[0] != "target" {
+		t.Errorf("expected the first receipt to get the promotion; got %+v", stored[0].ReceiptDetails)
+	}
+	if stored[1].Points != 22 || len(stored[1].Promotions) != 0 {
+		t.Errorf("expected the promotion to be used up; got %+v", stored[1].ReceiptDetails)
+	}
+}
+
+func TestRunImport_CSV(t *testing.T) {
+	t.Cleanup(services.ResetStore)
+	storePath := filepath.Join(t.TempDir(), "store.json")
+	input := "Receipt No,retailer,purchaseDate,purchaseTime,total,shortDescription,price\n" +
+		"A,Target,2022-01-01,13:01,7.74,Mountain Dew 12PK,6.49\n" +
+		"A,Target,2022-01-01,13:01,7.74,Pepsi,1.25\n" +
+		"B,Shell,2022-01-03,09:00,40.00,Unleaded,\n"
+
+	var stdout, stderr bytes.Buffer
+	code := runImport([]string{"--store", storePath, "--format", "csv", "--columns", "receipt=Receipt No"},
+		strings.NewReader(input), &stdout, &stderr)
+	if code != exitInvalid {
+		t.Errorf("expected exit code %d with an invalid receipt; got %d (%s)", exitInvalid, code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "stdin:4 (B): invalid: line 4: item needs both") ||
+		!strings.Contains(stdout.String(), "imported 1, duplicates 0, invalid 1") {
+		t.Errorf("unexpected import output: %s", stdout.String())
+	}
+
+	// Importing the file again finds the receipt already in the store
+	stdout.Reset()
+	runImport([]string{"--store", storePath, "--format", "csv", "--columns", "receipt=Receipt No"}, strings.NewReader(input), &stdout, &stderr)
+	if !strings.Contains(stdout.String(), "stdin:2,3 (A): duplicate") {
+		t.Errorf("expected the second import to report a duplicate; got %s", stdout.String())
+	}
+
+	if code := runImport([]string{"--store", storePath, "--format", "csv", "--columns", "nope"}, strings.NewReader(input), &stdout, &stderr); code != exitUsage {
+		t.Errorf("expected a bad column mapping to be a usage error; got %d", code)
+	}
+}
+
+func TestRunMigrate(t *testing.T) {
+	storePath := filepath.Join(t.TempDir(), "store.json")
+	if err := os.WriteFile(storePath, []byte(`{"version": 1, "receipts": []}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := runMigrate([]string{"--store", storePath}, strings.NewReader(""), &stdout, &stderr); code != exitOK {
+		t.Fatalf("runMigrate() exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "already at version 1") {
+		t.Errorf("unexpected output: %s", stdout.String())
+	}
+
+	if err := os.WriteFile(storePath, []byte(`{"version": 99}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if code := runMigrate([]string{"--store", storePath}, strings.NewReader(""), &stdout, &stderr); code != exitInvalid {
+		t.Errorf("expected exit code %d for an unsupported version; got %d", exitInvalid, code)
+	}
+	if code := runMigrate([]string{"--store", storePath + ".missing"}, strings.NewReader(""), &stdout, &stderr); code != exitError {
+		t.Errorf("expected exit code %d for a missing file; got %d", exitError, code)
+	}
+	if code := runMigrate([]string{"--store", ""}, strings.NewReader(""), &stdout, &stderr); code != exitUsage {
+		t.Errorf("expected exit code %d without --store; got %d", exitUsage, code)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/services"
+	"strings"
+)
+
+// validateResult is the outcome of checking one receipt or rulesets input.
+type validateResult struct {
+	Source string `json:"source"`
+	Kind   string `json:"kind"`
+	Valid  bool   `json:"valid"`
+	Error  string `json:"error,omitempty"`
+}
+
+// stringList is a flag that may be repeated.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// runValidate implements `receipt-processor validate`. It checks receipt
+// files (or NDJSON on stdin) against the same decode and validation path as
+// the HTTP handler, including the tenant ruleset's currencies and time zones,
+// and rulesets files against the ruleset schema.
+func runValidate(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "text", "output format: text or json")
+	var rulesetsFiles stringList
+	fs.Var(&rulesetsFiles, "rulesets", "rulesets file to check (may be repeated)")
+	receiptRulesetsFile := fs.String("receipt-rulesets", "", "rulesets file receipts are validated against (defaults to RULESETS_FILE or the built-in rules)")
+	tenantID := fs.String("tenant", services.DefaultTenant, "tenant whose ruleset receipts are validated against")
+	logLevel := fs.String("log-level", "fatal", "log level for diagnostics written to stderr")
+	loadConfig := addConfigFileFlag(fs, "receipt-rulesets")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: receipt-processor validate [flags] [receipt file ...]")
+		fmt.Fprintln(stderr, "Checks receipt files and rulesets files. Receipts are read as NDJSON from stdin when")
+		fmt.Fprintln(stderr, "neither a receipt file nor --rulesets is given, or when a file is -.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(stderr, "validate: unknown format %q\n", *format)
+		return exitUsage
+	}
+	if err := loadConfig(); err != nil {
+		fmt.Fprintf(stderr, "validate: invalid configuration: %v\n", err)
+		return exitUsage
+	}
+	logger.InitCLILogger(*logLevel)
+
+	rulesets, err := services.LoadRulesets(*receiptRulesetsFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "validate: %v\n", err)
+		return exitUsage
+	}
+	ruleset := rulesets.For(*tenantID)
+
+	var results []validateResult
+	code := exitOK
+	fail := func(c int) {
+		if c > code {
+			code = c
+		}
+	}
+
+	for _, path := range rulesetsFiles {
+		result := validateResult{Source: path, Kind: "rulesets", Valid: true}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintf(stderr, "validate: %v\n", err)
+			fail(exitError)
+			continue
+		}
+		if _, err := services.ParseRulesets(data); err != nil {
+			result.Valid = false
+			result.Error = err.Error()
+			fail(exitInvalid)
+		}
+		results = append(results, result)
+	}
+
+	sources := fs.Args()
+	if len(sources) == 0 && len(rulesetsFiles) == 0 {
+		sources = []string{"-"}
+	}
+	for _, source := range sources {
+		inputs, err := readReceiptInputs(source, stdin)
+		if err != nil {
+			fmt.Fprintf(stderr, "validate: %v\n", err)
+			fail(exitError)
+			continue
+		}
+		for _, input := range inputs {
+			result := validateResult{Source: input.source, Kind: "receipt", Valid: true}
+			if err := validateReceipt(input.body, ruleset); err != nil {
+				result.Valid = false
+				result.Error = err.Error()
+				fail(exitInvalid)
+			}
+			results = append(results, result)
+		}
+	}
+
+	encoder := json.NewEncoder(stdout)
+	for _, result := range results {
+		if *format == "json" {
+			if err := encoder.Encode(result); err != nil {
+				fmt.Fprintf(stderr, "validate: %v\n", err)
+				return exitError
+			}
+			continue
+		}
+		if result.Valid {
+			fmt.Fprintf(stdout, "%s: ok\n", result.Source)
+		} else {
+			fmt.Fprintf(stdout, "%s: invalid %s: %s\n", result.Source, result.Kind, result.Error)
+		}
+	}
+	return code
+}
+
+func validateReceipt(body []byte, rs services.Ruleset) error {
+	receipt, err := model.DecodeReceipt(body)
+	if err != nil {
+		return err
+	}
+	return services.ValidateReceipt(receipt, rs)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"receipt-processor/internal/utility"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunValidate(t *testing.T) {
+	dir := t.TempDir()
+	receiptPath := filepath.Join(dir, "target.json")
+	rulesetsPath := filepath.Join(dir, "rulesets.json")
+	badRulesetsPath := filepath.Join(dir, "bad-rulesets.json")
+	files := map[string]string{
+		receiptPath:     targetReceipt,
+		rulesetsPath:    `{"default": {"version": "v2", "oddDayPoints": 8}}`,
+		badRulesetsPath: `{"default": {"descriptionLengthMultiple": 0}}`,
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := runValidate([]string{"--rulesets", rulesetsPath, receiptPath}, strings.NewReader(""), &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("runValidate() exit code = %d; stdout: %s stderr: %s", code, stdout.String(), stderr.String())
+	}
+	if strings.Count(stdout.String(), ": ok") != 2 {
+		t.Errorf("expected both files to be ok: %s", stdout.String())
+	}
+
+	stdout.Reset()
+	code = runValidate([]string{"--rulesets", badRulesetsPath}, strings.NewReader(""), &stdout, &stderr)
+	if code != exitInvalid {
+		t.Errorf("expected exit code %d for an invalid rulesets file; got %d", exitInvalid, code)
+	}
+	if !strings.Contains(stdout.String(), "invalid rulesets") {
+		t.Errorf("expected the rulesets error to be reported: %s", stdout.String())
+	}
+
+	stdout.Reset()
+	code = runValidate(nil, strings.NewReader(`{"retailer": "Target"}`+"\n"), &stdout, &stderr)
+	if code != exitInvalid {
+		t.Errorf("expected exit code %d for an invalid receipt on stdin; got %d", exitInvalid, code)
+	}
+
+	if code := runValidate([]string{filepath.Join(dir, "missing.json")}, strings.NewReader(""), &stdout, &stderr); code != exitError {
+		t.Errorf("expected exit code %d for an unreadable file; got %d", exitError, code)
+	}
+}
+
+func TestRunValidate_Currency(t *testing.T) {
+	dir := t.TempDir()
+	receiptPath := filepath.Join(dir, "yen.json")
+	rulesetsPath := filepath.Join(dir, "rulesets.json")
+	yen := `{"retailer": "Lawson", "purchaseDate": "2022-01-02", "purchaseTime": "10:00",
+		"items": [{"shortDescription": "Onigiri", "price": "150"}], "total": "150", "currency": "JPY"}`
+	for path, content := range map[string]string{
+		receiptPath:  yen,
+		rulesetsPath: `{"tenants": {"partner-jp": {"currencyRates": {"JPY": 0.0067}}}}`,
+	} {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The built-in rules have no yen rate, so the server would reject the receipt
+	var stdout, stderr bytes.Buffer
+	if code := runValidate([]string{receiptPath}, strings.NewReader(""), &stdout, &stderr); code != exitInvalid ||
+		!strings.Contains(stdout.String(), "no exchange rate to USD") {
+		t.Errorf("expected a currency without a rate to be invalid; got %d: %s", code, stdout.String())
+	}
+
+	// The tenant's ruleset from the rulesets file accepts it
+	stdout.Reset()
+	args := []string{"--receipt-rulesets", rulesetsPath, "--tenant", "partner-jp", receiptPath}
+	if code := runValidate(args, strings.NewReader(""), &stdout, &stderr); code != exitOK {
+		t.Errorf("expected the tenant's rate to be used; got %d: %s", code, stdout.String())
+	}
+}
+
+func TestRunValidate_Timezone(t *testing.T) {
+	defer func(now func() time.Time) { utility.Now = now }(utility.Now)
+	// 2024-03-21 has started east of UTC but not yet in Los Angeles
+	utility.Now = func() time.Time { return time.Date(2024, 3, 20, 13, 30, 0, 0, time.UTC) }
+
+	dir := t.TempDir()
+	receiptPath := filepath.Join(dir, "target.json")
+	rulesetsPath := filepath.Join(dir, "rulesets.json")
+	receipt := strings.Replace(targetReceipt, "2022-01-01", "2024-03-21", 1)
+	for path, content := range map[string]string{
+		receiptPath:  receipt,
+		rulesetsPath: `{"default": {"retailerTimezones": {"Target": "America/Los_Angeles"}}}`,
+	} {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Without a known zone the date is accepted once it has started anywhere
+	var stdout, stderr bytes.Buffer
+	if code := runValidate([]string{receiptPath}, strings.NewReader(""), &stdout, &stderr); code != exitOK {
+		t.Errorf("expected the date to be accepted without a time zone; got %d: %s", code, stdout.String())
+	}
+
+	// The retailer's zone from the ruleset makes it a future date, as on the server
+	stdout.Reset()
+	args := []string{"--receipt-rulesets", rulesetsPath, receiptPath}
+	if code := runValidate(args, strings.NewReader(""), &stdout, &stderr); code != exitInvalid {
+		t.Errorf("expected a future date in the retailer's time zone to be invalid; got %d: %s", code, stdout.String())
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := dispatch([]string{"help"}, strings.NewReader(""), &stdout, &stderr); code != exitOK {
+		t.Errorf("expected help to exit %d; got %d", exitOK, code)
+	}
+	for _, name := range []string{"serve", "validate", "migrate", "export", "import"} {
+		if !strings.Contains(stdout.String(), "  "+name) {
+			t.Errorf("expected help to list %s: %s", name, stdout.String())
+		}
+	}
+
+	if code := dispatch([]string{"frobnicate"}, strings.NewReader(""), &stdout, &stderr); code != exitUsage {
+		t.Errorf("expected an unknown command to exit %d; got %d", exitUsage, code)
+	}
+	if code := dispatch([]string{"export", "--help"}, strings.NewReader(""), &stdout, &stderr); code != exitOK {
+		t.Errorf("expected --help to exit %d; got %d", exitOK, code)
+	}
+}
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/utility"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// APIKeyHeader is the request header carrying the caller's API key.
+const APIKeyHeader = "X-API-Key"
+
+// Scopes understood by the API. ScopeAdmin implies every other scope.
+const (
+	ScopeReceiptsWrite = "receipts:write"
+	ScopeReceiptsRead  = "receipts:read"
+	ScopeAdmin         = "admin"
+)
+
+// knownScopes are the scopes a key may be given.
+var knownScopes = map[string]bool{
+	ScopeReceiptsWrite: true,
+	ScopeReceiptsRead:  true,
+	ScopeAdmin:         true,
+}
+
+// Key is a configured API key. Only the SHA-256 hash of the secret is kept.
+// A key bound to a Tenant can only act on that tenant's data.
+type Key struct {
+	ID     string   `json:"id"`
+	Hash   string   `json:"hash"`
+	Scopes []string `json:"scopes"`
+	Tenant string   `json:"tenant,omitempty"`
+}
+
+// HasScope reports whether the key grants scope, either directly or through admin.
+func (k Key) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// keysFile is the on-disk format of an API keys file.
+type keysFile struct {
+	Keys []Key `json:"keys"`
+}
+
+// Authenticator validates API keys and enforces per-route scopes.
+type Authenticator struct {
+	keys map[string]Key // keyed by hash
+}
+
+type contextKey struct{}
+
+// HashKey returns the hex-encoded SHA-256 hash used to store an API key at rest.
+func HashKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAuthenticator creates an Authenticator for the given keys. Keys with an
+// unknown scope or an invalid tenant ID are rejected. With no keys,
+// authentication is disabled and every request is let through.
+func NewAuthenticator(keys []Key) (*Authenticator, error) {
+	a := &Authenticator{keys: map[string]Key{}}
+	ids := map[string]bool{}
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, fmt.Errorf("api key is missing an id")
+		}
+		if ids[key.ID] {
+			return nil, fmt.Errorf("duplicate api key id %q", key.ID)
+		}
+		hash := strings.ToLower(key.Hash)
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("api key %q must have a hex-encoded SHA-256 hash", key.ID)
+		}
+		if len(key.Scopes) == 0 {
+			return nil, fmt.Errorf("api key %q has no scopes", key.ID)
+		}
+		for _, scope := range key.Scopes {
+			if !knownScopes[scope] {
+				return nil, fmt.Errorf("api key %q has unknown scope %q", key.ID, scope)
+			}
+		}
+		if key.Tenant != "" && !utility.IsValidTenantID(key.Tenant) {
+			return nil, fmt.Errorf("api key %q has invalid tenant ID %q", key.ID, key.Tenant)
+		}
+		ids[key.ID] = true
+		key.Hash = hash
+		a.keys[hash] = key
+	}
+	return a, nil
+}
+
+// LoadKeys reads API keys from a JSON keys file and/or an environment value.
+//
+// The file has the form {"keys": [{"id": "...", "hash": "...", "scopes": ["..."], "tenant": "..."}]}.
+// The environment value is a comma-separated list of id[@tenant]:hash:scope1 scope2 entries.
+func LoadKeys(path, env string) ([]Key, error) {
+	var keys []Key
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading api keys file: %v", err)
+		}
+		var file keysFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("parsing api keys file: %v", err)
+		}
+		keys = append(keys, file.Keys...)
+	}
+	for _, entry := range strings.Split(env, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid api key entry %q, expected id:hash:scopes", entry)
+		}
+		id, tenant, _ := strings.Cut(parts[0], "@")
+		keys = append(keys, Key{ID: id, Hash: parts[1], Scopes: strings.Fields(parts[2]), Tenant: tenant})
+	}
+	return keys, nil
+}
+
+// Enabled reports whether any API keys are configured.
+func (a *Authenticator) Enabled() bool {
+	return len(a.keys) > 0
+}
+
+// Authenticate looks up the key presented as raw.
+func (a *Authenticator) Authenticate(raw string) (Key, bool) {
+	if raw == "" {
+		return Key{}, false
+	}
+	key, ok := a.keys[HashKey(raw)]
+	return key, ok
+}
+
+// Require wraps next so it is only served to callers whose key grants scope.
+// Missing or unknown keys get 401; keys lacking the scope get 403.
+func (a *Authenticator) Require(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key, ok := a.Authenticate(r.Header.Get(APIKeyHeader))
+		if !ok {
+			logger.Warn("Rejected request with missing or invalid API key", logrus.Fields{
+				"uri": r.RequestURI,
+			})
+			w.Header().Set("WWW-Authenticate", `APIKey header="`+APIKeyHeader+`"`)
+			utility.WriteError(w, "Missing or invalid API key", http.StatusUnauthorized)
+			return
+		}
+		if !key.HasScope(scope) {
+			logger.Warn("Rejected request lacking required scope", logrus.Fields{
+				"key_id": key.ID,
+				"scope":  scope,
+				"uri":    r.RequestURI,
+			})
+			utility.WriteError(w, "API key lacks required scope "+scope, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithKey(r.Context(), key)))
+	})
+}
+
+// WithKey returns a copy of ctx carrying the authenticated key.
+func WithKey(ctx context.Context, key Key) context.Context {
+	return context.WithValue(ctx, contextKey{}, key)
+}
+
+// KeyFromContext returns the authenticated key stored in ctx, if any.
+func KeyFromContext(ctx context.Context) (Key, bool) {
+	key, ok := ctx.Value(contextKey{}).(Key)
+	return key, ok
+}
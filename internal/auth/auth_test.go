@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testAuthenticator(t *testing.T) *Authenticator {
+	t.Helper()
+	a, err := NewAuthenticator([]Key{
+		{ID: "pos", Hash: HashKey("pos-secret"), Scopes: []string{ScopeReceiptsWrite}},
+		{ID: "reader", Hash: HashKey("reader-secret"), Scopes: []string{ScopeReceiptsRead}},
+		{ID: "ops", Hash: HashKey("ops-secret"), Scopes: []string{ScopeAdmin}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestRequire(t *testing.T) {
+	a := testAuthenticator(t)
+
+	var seenKey string
+	h := a.Require(ScopeReceiptsWrite, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, _ := KeyFromContext(r.Context())
+		seenKey = key.ID
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		apiKey   string
+		expected int
+	}{
+		{"missing key", "", http.StatusUnauthorized},
+		{"unknown key", "not-a-key", http.StatusUnauthorized},
+		{"key lacking scope", "reader-secret", http.StatusForbidden},
+		{"key with scope", "pos-secret", http.StatusOK},
+		{"admin key", "ops-secret", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/receipts/process", nil)
+		if test.apiKey != "" {
+			req.Header.Set(APIKeyHeader, test.apiKey)
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		if rr.Code != test.expected {
+			t.Errorf("%s: got status %d; want %d", test.name, rr.Code, test.expected)
+		}
+	}
+
+	if seenKey != "ops" {
+		t.Errorf("expected handler to see the authenticated key; got %q", seenKey)
+	}
+}
+
+func TestRequire_Disabled(t *testing.T) {
+	a, err := NewAuthenticator(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := a.Require(ScopeAdmin, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected requests to pass when no keys are configured; got %d", rr.Code)
+	}
+}
+
+func TestNewAuthenticator_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []Key
+	}{
+		{"missing id", []Key{{Hash: HashKey("a"), Scopes: []string{ScopeAdmin}}}},
+		{"plaintext key", []Key{{ID: "a", Hash: "secret", Scopes: []string{ScopeAdmin}}}},
+		{"no scopes", []Key{{ID: "a", Hash: HashKey("a")}}},
+		{"duplicate id", []Key{
+			{ID: "a", Hash: HashKey("a"), Scopes: []string{ScopeAdmin}},
+			{ID: "a", Hash: HashKey("b"), Scopes: []string{ScopeAdmin}},
+		}},
+		{"unknown scope", []Key{{ID: "ci", Hash: HashKey("a"), Scopes: []string{"receipt:write"}}}},
+		{"invalid tenant", []Key{{ID: "ci", Hash: HashKey("a"), Scopes: []string{ScopeAdmin}, Tenant: "acme corp"}}},
+	}
+
+	for _, test := range tests {
+		_, err := NewAuthenticator(test.keys)
+		if err == nil {
+			t.Errorf("%s: expected error", test.name)
+		} else if test.keys[0].ID != "" && !strings.Contains(err.Error(), `"`+test.keys[0].ID+`"`) {
+			t.Errorf("%s: expected the error to name the key; got %v", test.name, err)
+		}
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	content := `{"keys": [{"id": "pos", "hash": "` + HashKey("pos-secret") + `", "scopes": ["receipts:write"]}]}`
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	env := "reader:" + HashKey("reader-secret") + ":receipts:read admin"
+
+	keys, err := LoadKeys(path, env)
+	if err != nil {
+		t.Fatalf("LoadKeys() error = %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("expected 2 keys; got %d", len(keys))
+	}
+	if keys[1].ID != "reader" || len(keys[1].Scopes) != 2 || keys[1].Scopes[0] != ScopeReceiptsRead {
+		t.Errorf("unexpected key parsed from environment: %+v", keys[1])
+	}
+
+	if _, err := LoadKeys("", "missing-fields"); err == nil {
+		t.Errorf("expected error for malformed environment entry")
+	}
+}
@@ -0,0 +1,256 @@
+package capture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"mime"
+	"net/http"
+	"receipt-processor/internal/auth"
+	"receipt-processor/internal/ingest"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/services"
+	"receipt-processor/internal/tenant"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FormatVersion is the version of the capture record format written by this
+// release. It is bumped whenever a field changes meaning or is removed;
+// adding fields does not change it. See docs/capture-format.md.
+const FormatVersion = 1
+
+// maxCapturedResponse bounds how much of a response body is buffered.
+const maxCapturedResponse = 64 * 1024
+
+// Record is one captured /receipts/process exchange, written as a JSONL line.
+type Record struct {
+	FormatVersion int             `json:"formatVersion"`
+	CapturedAt    time.Time       `json:"capturedAt"`
+	Tenant        string          `json:"tenant"`
+	KeyID         string          `json:"keyId,omitempty"`
+	ContentType   string          `json:"contentType,omitempty"` // set for text/plain and XML receipts, which are recorded decoded
+	Receipt       json.RawMessage `json:"receipt"`
+	Response      Response        `json:"response"`
+}
+
+// Response is the part of the server's reply kept in a Record.
+type Response struct {
+	Status int    `json:"status"`
+	ID     string `json:"id,omitempty"`
+	Points *int   `json:"points,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Config controls sampling and redaction.
+type Config struct {
+	// SampleRate is the fraction of requests captured, from 0 to 1.
+	SampleRate float64
+	// Redact lists dotted JSON paths in the receipt whose string values are
+	// replaced by a stable token, e.g. "retailer" or "items.shortDescription".
+	Redact []string
+}
+
+// Recorder captures sampled requests and their responses as JSONL.
+type Recorder struct {
+	cfg    Config
+	mu     sync.Mutex
+	out    io.Writer
+	sample func() float64
+	now    func() time.Time
+}
+
+// NewRecorder creates a Recorder writing records to out.
+func NewRecorder(out io.Writer, cfg Config) *Recorder {
+	return &Recorder{
+		cfg:    cfg,
+		out:    out,
+		sample: rand.Float64,
+		now:    time.Now,
+	}
+}
+
+// Middleware captures a sample of the requests served by next. It must run
+// after tenant resolution so records carry the caller's tenant.
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rec.cfg.SampleRate <= 0 || rec.sample() >= rec.cfg.SampleRate {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		r.Body.Close()
+		// Hand the handler what was read, followed by the read error (e.g. body too large)
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+
+		cw := &capturingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(cw, r)
+
+		if err != nil {
+			return
+		}
+		rec.write(r, body, cw)
+	})
+}
+
+func (rec *Recorder) write(r *http.Request, body []byte, cw *capturingWriter) {
+	tenantID := tenant.FromContext(r.Context())
+	record := Record{
+		FormatVersion: FormatVersion,
+		CapturedAt:    rec.now().UTC(),
+		Tenant:        tenantID,
+		Response:      Response{Status: cw.status},
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/plain":
+		record.ContentType = mediaType
+		record.Receipt = rec.sanitizeDecoded(body, ingest.ParseText)
+	case "application/xml", "text/xml":
+		record.ContentType = mediaType
+		record.Receipt = rec.sanitizeDecoded(body, func(body string) (model.Receipt, error) {
+			return model.DecodeReceiptXML([]byte(body))
+		})
+	default:
+		record.Receipt = rec.sanitize(body)
+	}
+	if key, ok := auth.KeyFromContext(r.Context()); ok {
+		record.KeyID = key.ID
+	}
+
+	var reply struct {
+		ID    string `json:"id"`
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(cw.body.Bytes(), &reply) == nil {
+		record.Response.ID = reply.ID
+		record.Response.Error = reply.Error
+	}
+	if record.Response.ID != "" {
+		if points, _, ok := services.GetReceiptPoints(tenantID, record.Response.ID, false); ok {
+			record.Response.Points = &points
+		}
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		logger.Error("Failed to encode capture record", logrus.Fields{
+			"error": err,
+		})
+		return
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if _, err := rec.out.Write(append(line, '\n')); err != nil {
+		logger.Error("Failed to write capture record", logrus.Fields{
+			"error": err,
+		})
+	}
+}
+
+// sanitize applies the redaction rules to the request body. Bodies that are
+// not a JSON object are kept as a JSON string so the record stays valid JSON.
+func (rec *Recorder) sanitize(body []byte) json.RawMessage {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		raw, _ := json.Marshal(string(body))
+		return raw
+	}
+	for _, path := range rec.cfg.Redact {
+		redact(doc, strings.Split(path, "."))
+	}
+	raw, err := json.Marshal(doc)
+	if err != nil {
+		raw, _ = json.Marshal(string(body))
+	}
+	return raw
+}
+
+// sanitizeDecoded records a plain-text or XML receipt as the receipt it
+// decodes to, so it can be redacted and replayed like a JSON one. A body that
+// does not decode is kept as a string, or as a single token when redaction
+// is configured.
+func (rec *Recorder) sanitizeDecoded(body []byte, decode func(string) (model.Receipt, error)) json.RawMessage {
+	receipt, err := decode(string(body))
+	if err == nil {
+		if doc, err := json.Marshal(receipt); err == nil {
+			return rec.sanitize(doc)
+		}
+	}
+	text := string(body)
+	if len(rec.cfg.Redact) > 0 {
+		text = redactedToken(text)
+	}
+	raw, _ := json.Marshal(text)
+	return raw
+}
+
+// redact replaces string values at path with a token derived from their hash.
+// The token is stable, so redacted receipts still dedup against each other
+// on replay, and it passes the retailer and description validation rules.
+func redact(node interface{}, path []string) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		child, ok := v[path[0]]
+		if !ok {
+			return
+		}
+		if len(path) == 1 {
+			if s, ok := child.(string); ok {
+				v[path[0]] = redactedToken(s)
+			}
+			return
+		}
+		redact(child, path[1:])
+	case []interface{}:
+		for _, elem := range v {
+			redact(elem, path)
+		}
+	}
+}
+
+func redactedToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "REDACTED-" + hex.EncodeToString(sum[:4])
+}
+
+// capturingWriter records the status and the first part of the response body.
+type capturingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *capturingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *capturingWriter) Write(p []byte) (int, error) {
+	if room := maxCapturedResponse - w.body.Len(); room > 0 {
+		if len(p) < room {
+			room = len(p)
+		}
+		w.body.Write(p[:room])
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// errReader returns err (or io.EOF) on every read.
+type errReader struct{ err error }
+
+func (r errReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, io.EOF
+}
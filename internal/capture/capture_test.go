@@ -0,0 +1,143 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"receipt-processor/internal/handler"
+	"receipt-processor/internal/tenant"
+	"strings"
+	"testing"
+	"time"
+)
+
+const receiptBody = `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}], "total": "6.49"}`
+
+func newTestRecorder(cfg Config, out io.Writer) *Recorder {
+	rec := NewRecorder(out, cfg)
+	rec.sample = func() float64 { return 0.5 }
+	rec.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	return rec
+}
+
+func serve(h http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/receipts/process", strings.NewReader(body))
+	req = req.WithContext(tenant.WithTenant(req.Context(), "capture-test"))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestMiddleware_CapturesRequestAndResponse(t *testing.T) {
+	var out bytes.Buffer
+	rec := newTestRecorder(Config{SampleRate: 1, Redact: []string{"items.shortDescription"}}, &out)
+	h := rec.Middleware(http.HandlerFunc(handler.ProcessReceipt))
+
+	rr := serve(h, receiptBody)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the handler to still see the body; got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var record Record
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("capture output is not a JSON record: %v (%q)", err, out.String())
+	}
+	if record.FormatVersion != FormatVersion || record.Tenant != "capture-test" || !record.CapturedAt.Equal(rec.now()) {
+		t.Errorf("unexpected record metadata: %+v", record)
+	}
+	if record.Response.Status != http.StatusOK || record.Response.ID == "" {
+		t.Errorf("unexpected captured response: %+v", record.Response)
+	}
+	if record.Response.Points == nil || *record.Response.Points == 0 {
+		t.Errorf("expected captured response to include points; got %+v", record.Response)
+	}
+
+	receipt := string(record.Receipt)
+	if strings.Contains(receipt, "Mountain Dew") || !strings.Contains(receipt, "REDACTED-") {
+		t.Errorf("expected item descriptions to be redacted; got %s", receipt)
+	}
+	if !strings.Contains(receipt, `"retailer":"Target"`) {
+		t.Errorf("expected fields without a redaction rule to be kept; got %s", receipt)
+	}
+}
+
+func TestMiddleware_Sampling(t *testing.T) {
+	var out bytes.Buffer
+	rec := newTestRecorder(Config{SampleRate: 0.25}, &out)
+	h := rec.Middleware(http.HandlerFunc(handler.ProcessReceipt))
+
+	serve(h, receiptBody)
+	if out.Len() != 0 {
+		t.Errorf("expected request outside the sample not to be captured; got %q", out.String())
+	}
+}
+
+func TestMiddleware_ErrorResponse(t *testing.T) {
+	var out bytes.Buffer
+	rec := newTestRecorder(Config{SampleRate: 1}, &out)
+	h := rec.Middleware(http.HandlerFunc(handler.ProcessReceipt))
+
+	serve(h, "not json")
+	var record Record
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("capture output is not a JSON record: %v", err)
+	}
+	if record.Response.Status != http.StatusBadRequest || record.Response.Error == "" {
+		t.Errorf("unexpected captured response: %+v", record.Response)
+	}
+	if string(record.Receipt) != `"not json"` {
+		t.Errorf("expected non-JSON body to be kept as a string; got %s", record.Receipt)
+	}
+}
+
+func TestMiddleware_TextReceipt(t *testing.T) {
+	var out bytes.Buffer
+	rec := newTestRecorder(Config{SampleRate: 1, Redact: []string{"retailer"}}, &out)
+	h := rec.Middleware(http.HandlerFunc(handler.ProcessReceipt))
+
+	req := httptest.NewRequest("POST", "/receipts/process", strings.NewReader("Walgreens\n2022-01-02 08:13\nPepsi 12-PK 1.25\nTOTAL 1.25\n"))
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req = req.WithContext(tenant.WithTenant(req.Context(), "capture-test"))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the text receipt to be processed; got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The parsed receipt is recorded, so redaction applies and replay can read it
+	var record Record
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	receipt := string(record.Receipt)
+	if record.ContentType != "text/plain" || strings.Contains(receipt, "Walgreens") || !strings.Contains(receipt, `"shortDescription":"Pepsi 12-PK"`) {
+		t.Errorf("expected a redacted parsed receipt; got %s %s", record.ContentType, receipt)
+	}
+}
+
+func TestMiddleware_XMLReceipt(t *testing.T) {
+	var out bytes.Buffer
+	rec := newTestRecorder(Config{SampleRate: 1}, &out)
+	h := rec.Middleware(http.HandlerFunc(handler.ProcessReceipt))
+
+	body := `<receipt><retailer>Walgreens</retailer><purchaseDate>2022-01-02</purchaseDate><purchaseTime>08:13</purchaseTime>` +
+		`<items><item><shortDescription>Pepsi 12-PK</shortDescription><price>1.25</price></item></items><total>1.25</total></receipt>`
+	req := httptest.NewRequest("POST", "/receipts/process", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/xml")
+	req = req.WithContext(tenant.WithTenant(req.Context(), "capture-xml-test"))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the XML receipt to be processed; got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var record Record
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.ContentType != "application/xml" || !strings.Contains(string(record.Receipt), `"retailer":"Walgreens"`) {
+		t.Errorf("expected the decoded receipt to be recorded; got %s %s", record.ContentType, record.Receipt)
+	}
+}
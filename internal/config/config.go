@@ -1,37 +1,467 @@
 package config
 
 import (
-	"log"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"receipt-processor/internal/ingest"
+	"receipt-processor/internal/utility"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/joho/godotenv"
+	"github.com/BurntSushi/toml"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
 )
 
+// Config is the effective server configuration. Settings are layered: the
+// defaults, then an optional YAML or TOML file, then environment variables,
+// then command-line overrides. File keys are the environment variable names
+// in lower case, e.g. app_port for APP_PORT.
 type Config struct {
-	AppPort     string
-	LogLevel    string
-	DatabaseURL string
+	AppPort  string `yaml:"app_port" toml:"app_port"`
+	LogLevel string `yaml:"log_level" toml:"log_level"`
+
+	// GRPCPort serves the gRPC API on a second port; disabled when empty
+	GRPCPort string `yaml:"grpc_port" toml:"grpc_port"`
+
+	// ShutdownDrainDelay is how long /readyz reports unavailable before the
+	// server stops accepting connections, giving load balancers time to drain.
+	ShutdownDrainDelay time.Duration `yaml:"shutdown_drain_delay" toml:"shutdown_drain_delay"`
+
+	// HTTP server limits
+	ReadTimeout       time.Duration `yaml:"http_read_timeout" toml:"http_read_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"http_read_header_timeout" toml:"http_read_header_timeout"`
+	WriteTimeout      time.Duration `yaml:"http_write_timeout" toml:"http_write_timeout"`
+	IdleTimeout       time.Duration `yaml:"http_idle_timeout" toml:"http_idle_timeout"`
+	MaxHeaderBytes    int           `yaml:"http_max_header_bytes" toml:"http_max_header_bytes"`
+	MaxBodyBytes      int64         `yaml:"http_max_body_bytes" toml:"http_max_body_bytes"`
+
+	// Rate limiting; an RPS of 0 disables limiting
+	RateLimit        RateLimit            `yaml:"rate_limit" toml:"rate_limit"`
+	RateLimitRoutes  map[string]RateLimit `yaml:"rate_limit_routes" toml:"rate_limit_routes"`
+	RateLimitIdleTTL time.Duration        `yaml:"rate_limit_idle_ttl" toml:"rate_limit_idle_ttl"`
+	TrustedProxies   []string             `yaml:"trusted_proxies" toml:"trusted_proxies"`
+
+	// API keys: a JSON keys file and/or id:sha256:scopes entries
+	APIKeysFile string `yaml:"api_keys_file" toml:"api_keys_file"`
+	APIKeys     string `yaml:"api_keys" toml:"api_keys"`
+
+	// RulesetsFile holds the default scoring ruleset and per-tenant overrides
+	RulesetsFile string `yaml:"rulesets_file" toml:"rulesets_file"`
+
+	// Characters accepted in retailer names and descriptions: "unicode" (any
+	// script plus ValidationPunctuation) or "strict" (the original spec)
+	ValidationProfile     string `yaml:"validation_profile" toml:"validation_profile"`
+	ValidationPunctuation string `yaml:"validation_punctuation" toml:"validation_punctuation"`
+
+	// CSVImportColumns overrides the CSV import column mapping, e.g.
+	// "receipt=Receipt No,retailer=Merchant"
+	CSVImportColumns string `yaml:"csv_import_columns" toml:"csv_import_columns"`
+
+	// EmailTemplatesFile holds the per-sender-domain e-receipt templates
+	EmailTemplatesFile string `yaml:"email_templates_file" toml:"email_templates_file"`
+
+	// Request capture for replay; disabled when CaptureFile is empty
+	CaptureFile       string   `yaml:"capture_file" toml:"capture_file"`
+	CaptureSampleRate float64  `yaml:"capture_sample_rate" toml:"capture_sample_rate"`
+	CaptureRedact     []string `yaml:"capture_redact" toml:"capture_redact"`
+	CaptureMaxBytes   int64    `yaml:"capture_max_bytes" toml:"capture_max_bytes"`
+	CaptureMaxBackups int      `yaml:"capture_max_backups" toml:"capture_max_backups"`
+
+	// Receipt store persistence; the store is memory-only when StoreFile is empty
+	StoreFile          string        `yaml:"store_file" toml:"store_file"`
+	StoreFlushInterval time.Duration `yaml:"store_flush_interval" toml:"store_flush_interval"`
+}
+
+// RateLimit is a token-bucket limit of Burst requests refilled at RPS per second.
+type RateLimit struct {
+	RPS   float64 `yaml:"rps" toml:"rps"`
+	Burst int     `yaml:"burst" toml:"burst"`
+}
+
+// FileEnv names the environment variable that points at the config file.
+const FileEnv = "CONFIG_FILE"
+
+// mask replaces secret values when the config is printed.
+const mask = "********"
+
+// Default returns the configuration used when nothing else is set.
+func Default() *Config {
+	return &Config{
+		AppPort:  "8080",
+		LogLevel: "info",
+
+		ShutdownDrainDelay: 5 * time.Second,
+
+		ReadTimeout:       10 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		MaxHeaderBytes:    1 << 20,
+		MaxBodyBytes:      1 << 20,
+
+		RateLimit:        RateLimit{RPS: 10, Burst: 20},
+		RateLimitRoutes:  map[string]RateLimit{},
+		RateLimitIdleTTL: 10 * time.Minute,
+
+		ValidationProfile:     utility.ProfileUnicode,
+		ValidationPunctuation: utility.DefaultPunctuation,
+
+		CaptureSampleRate: 1,
+		CaptureMaxBytes:   100 << 20,
+		CaptureMaxBackups: 5,
+
+		StoreFlushInterval: 30 * time.Second,
+	}
+}
+
+// Load builds the effective configuration from the defaults, the config file
+// at path (CONFIG_FILE when path is empty), the environment and overrides.
+// Overrides are keyed by environment variable name and take precedence over
+// the environment. Unlike an empty environment variable, an empty override
+// clears a string setting, e.g. to disable gRPC. The result is validated.
+func Load(path string, overrides map[string]string) (*Config, error) {
+	lookup := func(key string) (string, bool) {
+		if value, ok := overrides[key]; ok {
+			return value, true
+		}
+		value := os.Getenv(key)
+		return value, value != ""
+	}
+
+	cfg := Default()
+	if path == "" {
+		path, _ = lookup(FileEnv)
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.loadEnv(lookup); err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
 }
 
-func LoadConfig() *Config {
-	// Load .env file
-	err := godotenv.Load()
+// loadFile overlays the YAML (.yaml, .yml) or TOML (.toml) file at path.
+// Unknown keys are rejected so typos do not go unnoticed.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		log.Println("No .env file found, using default environment variables.")
+		return fmt.Errorf("reading config file: %v", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("parsing config file %s: %v", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("parsing config file %s: %v", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("parsing config file %s: unknown key %q", path, undecoded[0].String())
+		}
+	default:
+		return fmt.Errorf("config file %s: unsupported extension, expected .yaml, .yml or .toml", path)
 	}
+	return nil
+}
 
-	return &Config{
-		AppPort:     getEnv("APP_PORT", "8080"),
-		LogLevel:    getEnv("LOG_LEVEL", "INFO"),
-		DatabaseURL: getEnv("DATABASE_URL", "localhost"),
+// loadEnv overlays every variable that lookup reports as set.
+func (c *Config) loadEnv(lookup func(string) (string, bool)) error {
+	e := envLoader{lookup: lookup}
+	e.str("APP_PORT", &c.AppPort)
+	e.str("LOG_LEVEL", &c.LogLevel)
+	e.str("GRPC_PORT", &c.GRPCPort)
+
+	e.duration("SHUTDOWN_DRAIN_DELAY", &c.ShutdownDrainDelay)
+
+	e.duration("HTTP_READ_TIMEOUT", &c.ReadTimeout)
+	e.duration("HTTP_READ_HEADER_TIMEOUT", &c.ReadHeaderTimeout)
+	e.duration("HTTP_WRITE_TIMEOUT", &c.WriteTimeout)
+	e.duration("HTTP_IDLE_TIMEOUT", &c.IdleTimeout)
+	e.integer("HTTP_MAX_HEADER_BYTES", &c.MaxHeaderBytes)
+	e.integer64("HTTP_MAX_BODY_BYTES", &c.MaxBodyBytes)
+
+	e.float("RATE_LIMIT_RPS", &c.RateLimit.RPS)
+	e.integer("RATE_LIMIT_BURST", &c.RateLimit.Burst)
+	e.routes("RATE_LIMIT_ROUTES", &c.RateLimitRoutes)
+	e.duration("RATE_LIMIT_IDLE_TTL", &c.RateLimitIdleTTL)
+	e.list("TRUSTED_PROXIES", &c.TrustedProxies)
+
+	e.str("API_KEYS_FILE", &c.APIKeysFile)
+	e.str("API_KEYS", &c.APIKeys)
+
+	e.str("RULESETS_FILE", &c.RulesetsFile)
+
+	e.str("VALIDATION_PROFILE", &c.ValidationProfile)
+	e.str("VALIDATION_PUNCTUATION", &c.ValidationPunctuation)
+	e.str("CSV_IMPORT_COLUMNS", &c.CSVImportColumns)
+	e.str("EMAIL_TEMPLATES_FILE", &c.EmailTemplatesFile)
+
+	e.str("CAPTURE_FILE", &c.CaptureFile)
+	e.float("CAPTURE_SAMPLE_RATE", &c.CaptureSampleRate)
+	e.list("CAPTURE_REDACT", &c.CaptureRedact)
+	e.integer64("CAPTURE_MAX_BYTES", &c.CaptureMaxBytes)
+	e.integer("CAPTURE_MAX_BACKUPS", &c.CaptureMaxBackups)
+
+	e.str("STORE_FILE", &c.StoreFile)
+	e.duration("STORE_FLUSH_INTERVAL", &c.StoreFlushInterval)
+	return errors.Join(e.errs...)
+}
+
+// Validate reports every setting that is out of range or names a missing path.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	port, err := strconv.Atoi(c.AppPort)
+	check(err == nil && port >= 1 && port <= 65535, "app_port: %q is not a port between 1 and 65535", c.AppPort)
+	if c.GRPCPort != "" {
+		port, err := strconv.Atoi(c.GRPCPort)
+		check(err == nil && port >= 1 && port <= 65535, "grpc_port: %q is not a port between 1 and 65535", c.GRPCPort)
+		check(c.GRPCPort != c.AppPort, "grpc_port: must differ from app_port")
+	}
+	_, err = logrus.ParseLevel(c.LogLevel)
+	check(err == nil, "log_level: %q is not a valid level (trace, debug, info, warn, error, fatal, panic)", c.LogLevel)
+
+	check(c.ShutdownDrainDelay >= 0, "shutdown_drain_delay: must not be negative")
+	check(c.ReadTimeout >= 0, "http_read_timeout: must not be negative")
+	check(c.ReadHeaderTimeout >= 0, "http_read_header_timeout: must not be negative")
+	check(c.WriteTimeout >= 0, "http_write_timeout: must not be negative")
+	check(c.IdleTimeout >= 0, "http_idle_timeout: must not be negative")
+	check(c.MaxHeaderBytes > 0, "http_max_header_bytes: must be positive")
+	check(c.MaxBodyBytes > 0, "http_max_body_bytes: must be positive")
+
+	check(c.RateLimit.RPS >= 0 && c.RateLimit.Burst >= 0, "rate_limit: rps and burst must not be negative")
+	for route, limit := range c.RateLimitRoutes {
+		check(limit.RPS >= 0 && limit.Burst >= 0, "rate_limit_routes: %s: rps and burst must not be negative", route)
+	}
+	check(c.RateLimitIdleTTL > 0, "rate_limit_idle_ttl: must be positive")
+
+	_, err = c.ValidationRules()
+	check(err == nil, "validation_profile: %v", err)
+	_, err = c.ImportColumns()
+	check(err == nil, "csv_import_columns: %v", err)
+
+	check(c.CaptureSampleRate >= 0 && c.CaptureSampleRate <= 1, "capture_sample_rate: must be between 0 and 1")
+	check(c.CaptureMaxBytes > 0, "capture_max_bytes: must be positive")
+	check(c.CaptureMaxBackups >= 0, "capture_max_backups: must not be negative")
+	check(c.StoreFlushInterval > 0, "store_flush_interval: must be positive")
+
+	// Files the server reads must exist; files it writes need an existing directory
+	for key, path := range map[string]string{"api_keys_file": c.APIKeysFile, "rulesets_file": c.RulesetsFile,
+		"email_templates_file": c.EmailTemplatesFile} {
+		if path != "" {
+			info, err := os.Stat(path)
+			check(err == nil && !info.IsDir(), "%s: %s does not exist or is not a file", key, path)
+		}
+	}
+	for key, path := range map[string]string{"capture_file": c.CaptureFile, "store_file": c.StoreFile} {
+		if path != "" {
+			info, err := os.Stat(filepath.Dir(path))
+			check(err == nil && info.IsDir(), "%s: directory of %s does not exist", key, path)
+		}
 	}
+
+	// Some checks iterate maps, so sort for stable messages
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
 }
 
-// Helper to get environment variables with default fallback
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+// ValidationRules returns the validation profile the settings describe.
+func (c *Config) ValidationRules() (*utility.ValidationProfile, error) {
+	return utility.NewValidationProfile(c.ValidationProfile, c.ValidationPunctuation)
+}
+
+// ImportColumns returns the CSV import column mapping.
+func (c *Config) ImportColumns() (ingest.CSVColumns, error) {
+	return ingest.ParseCSVColumns(c.CSVImportColumns)
+}
+
+// reloadable lists the settings a running server applies when it reloads.
+var reloadable = map[string]bool{
+	"log_level":         true,
+	"rate_limit":        true,
+	"rate_limit_routes": true,
+	"rulesets_file":     true,
+
+	"validation_profile":     true,
+	"validation_punctuation": true,
+	"csv_import_columns":     true,
+	"email_templates_file":   true,
+}
+
+// RestartRequired returns the keys whose value differs in next but which only
+// take effect after a restart.
+func (c *Config) RestartRequired(next *Config) []string {
+	var keys []string
+	current, updated := reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < current.NumField(); i++ {
+		key := current.Type().Field(i).Tag.Get("yaml")
+		if reloadable[key] {
+			continue
+		}
+		if !reflect.DeepEqual(current.Field(i).Interface(), updated.Field(i).Interface()) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Masked returns a copy of the config with secrets replaced, for display.
+func (c *Config) Masked() *Config {
+	masked := *c
+	if masked.APIKeys != "" {
+		masked.APIKeys = mask
+	}
+	return &masked
+}
+
+// Encode renders the config as YAML or TOML, in the same form Load reads.
+func (c *Config) Encode(format string) ([]byte, error) {
+	switch format {
+	case "yaml":
+		return yaml.Marshal(c)
+	case "toml":
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(c); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unknown config format %q", format)
 	}
+}
+
+// envLoader overlays environment variables onto config fields, collecting
+// parse errors rather than silently falling back to defaults.
+type envLoader struct {
+	lookup func(string) (string, bool)
+	errs   []error
+}
+
+// value returns the value of key, or "" when it is not set. Only str applies
+// empty values; for the other types they keep the current setting.
+func (e *envLoader) value(key string) string {
+	value, _ := e.lookup(key)
 	return value
 }
+
+func (e *envLoader) str(key string, dst *string) {
+	if value, ok := e.lookup(key); ok {
+		*dst = value
+	}
+}
+
+func (e *envLoader) duration(key string, dst *time.Duration) {
+	value := e.value(key)
+	if value == "" {
+		return
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: invalid duration %q", key, value))
+		return
+	}
+	*dst = d
+}
+
+func (e *envLoader) integer(key string, dst *int) {
+	value := e.value(key)
+	if value == "" {
+		return
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: invalid integer %q", key, value))
+		return
+	}
+	*dst = n
+}
+
+func (e *envLoader) integer64(key string, dst *int64) {
+	value := e.value(key)
+	if value == "" {
+		return
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: invalid integer %q", key, value))
+		return
+	}
+	*dst = n
+}
+
+func (e *envLoader) float(key string, dst *float64) {
+	value := e.value(key)
+	if value == "" {
+		return
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: invalid number %q", key, value))
+		return
+	}
+	*dst = f
+}
+
+// list parses a comma-separated value.
+func (e *envLoader) list(key string, dst *[]string) {
+	value := e.value(key)
+	if value == "" {
+		return
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*dst = list
+}
+
+// routes parses per-route limits in the form
+// "/receipts/process=5:10,/receipts/{id}/points=20:40" (route=rps:burst).
+func (e *envLoader) routes(key string, dst *map[string]RateLimit) {
+	value := e.value(key)
+	if value == "" {
+		return
+	}
+	routes := map[string]RateLimit{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		route, limit, ok := strings.Cut(entry, "=")
+		rpsValue, burstValue, hasBurst := strings.Cut(limit, ":")
+		rps, rpsErr := strconv.ParseFloat(rpsValue, 64)
+		burst, burstErr := strconv.Atoi(burstValue)
+		if !ok || !hasBurst || rpsErr != nil || burstErr != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s: invalid entry %q, expected route=rps:burst", key, entry))
+			continue
+		}
+		routes[route] = RateLimit{RPS: rps, Burst: burst}
+	}
+	*dst = routes
+}
@@ -1,23 +1,178 @@
 package config
 
-// import (
-// 	"os"
-// 	"testing"
-// )
-
-// func TestLoadConfig(t *testing.T) {
-// 	const defaultPort = "8080"
-// 	os.Setenv("PORT", "3000")
-// 	defer os.Unsetenv("PORT")
-
-// 	cfg := LoadConfig()
-// 	if cfg.Port != "3000" {
-// 		t.Errorf("Expected port %v, got %v", "3000", cfg.Port)
-// 	}
-
-// 	os.Unsetenv("PORT") // Test default value
-// 	cfg = LoadConfig()
-// 	if cfg.Port != defaultPort {
-// 		t.Errorf("Expected default port %v, got %v", defaultPort, cfg.Port)
-// 	}
-// }
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	t.Setenv("APP_PORT", "")
+	t.Setenv(FileEnv, "")
+
+	cfg, err := Load("", nil)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if cfg.AppPort != "8080" || cfg.ReadTimeout != 10*time.Second || cfg.RateLimit.Burst != 20 {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestLoad_Layering(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+app_port: "9000"
+log_level: debug
+http_read_timeout: 3s
+rate_limit:
+  rps: 2
+rate_limit_routes:
+  /receipts/process: {rps: 1, burst: 2}
+`)
+	t.Setenv("LOG_LEVEL", "warn")
+	t.Setenv("APP_PORT", "9001")
+	t.Setenv("HTTP_READ_TIMEOUT", "")
+
+	cfg, err := Load(path, map[string]string{"APP_PORT": "9002"})
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if cfg.AppPort != "9002" {
+		t.Errorf("expected the override to win; got port %s", cfg.AppPort)
+	}
+	if cfg.LogLevel != "warn" {
+		t.Errorf("expected the environment to override the file; got log level %s", cfg.LogLevel)
+	}
+	if cfg.ReadTimeout != 3*time.Second {
+		t.Errorf("expected the file to override the default; got read timeout %s", cfg.ReadTimeout)
+	}
+	if cfg.RateLimit.RPS != 2 || cfg.RateLimit.Burst != 20 {
+		t.Errorf("expected file keys to overlay the defaults; got %+v", cfg.RateLimit)
+	}
+	if cfg.RateLimitRoutes["/receipts/process"] != (RateLimit{RPS: 1, Burst: 2}) {
+		t.Errorf("unexpected routes: %+v", cfg.RateLimitRoutes)
+	}
+}
+
+func TestLoad_EmptyOverride(t *testing.T) {
+	path := writeFile(t, "config.yaml", "grpc_port: \"9090\"\nlog_level: debug\n")
+	t.Setenv("GRPC_PORT", "")
+	t.Setenv("LOG_LEVEL", "")
+
+	cfg, err := Load(path, nil)
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if cfg.GRPCPort != "9090" || cfg.LogLevel != "debug" {
+		t.Errorf("expected empty environment variables to keep the file values; got %+v", cfg)
+	}
+	cfg, err = Load(path, map[string]string{"GRPC_PORT": ""})
+	if err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	if cfg.GRPCPort != "" {
+		t.Errorf("expected an empty override to disable gRPC; got port %q", cfg.GRPCPort)
+	}
+}
+
+func TestLoad_TOMLRoundTrip(t *testing.T) {
+	t.Setenv("APP_PORT", "")
+	t.Setenv("LOG_LEVEL", "")
+	want := Default()
+	want.AppPort = "9100"
+	want.CaptureRedact = []string{"retailer"}
+	want.RateLimitRoutes["/receipts/process"] = RateLimit{RPS: 5, Burst: 10}
+
+	data, err := want.Encode("toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(writeFile(t, "config.toml", string(data)), nil)
+	if err != nil {
+		t.Fatalf("Load() error: %v\n%s", err, data)
+	}
+	if cfg.AppPort != "9100" || cfg.IdleTimeout != time.Minute || len(cfg.CaptureRedact) != 1 ||
+		cfg.RateLimitRoutes["/receipts/process"].Burst != 10 {
+		t.Errorf("config did not survive a TOML round trip: %+v", cfg)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	t.Setenv("APP_PORT", "")
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		wantErr string
+	}{
+		{"unknown file key", writeFile(t, "c.yaml", "app_prot: 80\n"), nil, "app_prot"},
+		{"unknown toml key", writeFile(t, "c.toml", "app_prot = 80\n"), nil, "app_prot"},
+		{"unsupported extension", writeFile(t, "c.json", "{}"), nil, "unsupported extension"},
+		{"missing file", filepath.Join(t.TempDir(), "missing.yaml"), nil, "reading config file"},
+		{"bad duration", "", map[string]string{"HTTP_READ_TIMEOUT": "soon"}, "HTTP_READ_TIMEOUT"},
+		{"bad routes", "", map[string]string{"RATE_LIMIT_ROUTES": "/receipts/process=5"}, "RATE_LIMIT_ROUTES"},
+		{"port range", "", map[string]string{"APP_PORT": "70000"}, "app_port"},
+		{"log level", "", map[string]string{"LOG_LEVEL": "loud"}, "log_level"},
+		{"grpc port range", "", map[string]string{"GRPC_PORT": "0"}, "grpc_port"},
+		{"grpc port clash", "", map[string]string{"APP_PORT": "9000", "GRPC_PORT": "9000"}, "grpc_port: must differ"},
+		{"sample rate", "", map[string]string{"CAPTURE_SAMPLE_RATE": "2"}, "capture_sample_rate"},
+		{"validation profile", "", map[string]string{"VALIDATION_PROFILE": "ascii"}, "validation_profile"},
+		{"validation punctuation", "", map[string]string{"VALIDATION_PUNCTUATION": "-x"}, "validation_profile"},
+		{"missing rulesets", "", map[string]string{"RULESETS_FILE": "/nonexistent/rulesets.json"}, "rulesets_file"},
+		{"missing email templates", "", map[string]string{"EMAIL_TEMPLATES_FILE": "/nonexistent/templates.json"}, "email_templates_file"},
+		{"missing store dir", "", map[string]string{"STORE_FILE": "/nonexistent/store.json"}, "store_file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(tt.file, tt.env)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected an error mentioning %q; got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMasked(t *testing.T) {
+	cfg := Default()
+	cfg.APIKeys = "pos-1:abc:receipts:write"
+
+	out, err := cfg.Masked().Encode("yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "pos-1") {
+		t.Errorf("expected API keys to be masked:\n%s", out)
+	}
+	if cfg.APIKeys != "pos-1:abc:receipts:write" {
+		t.Error("Masked() must not modify the original config")
+	}
+}
+
+func TestRestartRequired(t *testing.T) {
+	running := Default()
+	next := Default()
+	next.LogLevel = "debug"
+	next.RateLimit.RPS = 1
+	next.RulesetsFile = "rulesets.json"
+	if keys := running.RestartRequired(next); len(keys) != 0 {
+		t.Errorf("expected reloadable changes only; got %v", keys)
+	}
+
+	next.AppPort = "9000"
+	next.TrustedProxies = []string{"10.0.0.0/8"}
+	keys := running.RestartRequired(next)
+	if len(keys) != 2 || keys[0] != "app_port" || keys[1] != "trusted_proxies" {
+		t.Errorf("expected app_port and trusted_proxies; got %v", keys)
+	}
+}
@@ -0,0 +1,92 @@
+package grpcapi
+
+import (
+	receiptsv1 "receipt-processor/api/receipts/v1"
+	"receipt-processor/internal/model"
+)
+
+// receiptFromProto converts a request receipt to the model, normalized like
+// the REST decoders do.
+func receiptFromProto(r *receiptsv1.Receipt) model.Receipt {
+	receipt := model.Receipt{
+		Retailer:      r.GetRetailer(),
+		PurchaseDate:  r.GetPurchaseDate(),
+		PurchaseTime:  r.GetPurchaseTime(),
+		Total:         r.GetTotal(),
+		CustomerID:    r.GetCustomerId(),
+		Timezone:      r.GetTimezone(),
+		Currency:      r.GetCurrency(),
+		Subtotal:      r.GetSubtotal(),
+		Tax:           r.GetTax(),
+		Tip:           r.GetTip(),
+		PaymentMethod: r.GetPaymentMethod(),
+	}
+	for _, item := range r.GetItems() {
+		receipt.Items = append(receipt.Items, model.Item{
+			ShortDescription: item.GetShortDescription(),
+			Price:            item.GetPrice(),
+			Quantity:         item.GetQuantity(),
+			UnitPrice:        item.GetUnitPrice(),
+		})
+	}
+	for _, discount := range r.GetDiscounts() {
+		receipt.Discounts = append(receipt.Discounts, model.Discount{
+			Description: discount.GetDescription(),
+			Amount:      discount.GetAmount(),
+		})
+	}
+	if store := r.GetStore(); store != nil {
+		receipt.Store = &model.Store{
+			ID:         store.GetId(),
+			Address:    store.GetAddress(),
+			PostalCode: store.GetPostalCode(),
+			Region:     store.GetRegion(),
+			Latitude:   store.Latitude,
+			Longitude:  store.Longitude,
+		}
+	}
+	receipt.Normalize()
+	return receipt
+}
+
+// receiptToProto converts a stored receipt for a response.
+func receiptToProto(r model.Receipt) *receiptsv1.Receipt {
+	receipt := &receiptsv1.Receipt{
+		Retailer:      r.Retailer,
+		PurchaseDate:  r.PurchaseDate,
+		PurchaseTime:  r.PurchaseTime,
+		Total:         r.Total,
+		CustomerId:    r.CustomerID,
+		Timezone:      r.Timezone,
+		Currency:      r.Currency,
+		Subtotal:      r.Subtotal,
+		Tax:           r.Tax,
+		Tip:           r.Tip,
+		PaymentMethod: r.PaymentMethod,
+	}
+	for _, item := range r.Items {
+		receipt.Items = append(receipt.Items, &receiptsv1.Item{
+			ShortDescription: item.ShortDescription,
+			Price:            item.Price,
+			Quantity:         item.Quantity,
+			UnitPrice:        item.UnitPrice,
+		})
+	}
+	for _, discount := range r.Discounts {
+		receipt.Discounts = append(receipt.Discounts, &receiptsv1.Discount{
+			Description: discount.Description,
+			Amount:      discount.Amount,
+		})
+	}
+	if r.Store != nil {
+		receipt.Store = &receiptsv1.Store{
+			Id:         r.Store.ID,
+			Address:    r.Store.Address,
+			PostalCode: r.Store.PostalCode,
+			Region:     r.Store.Region,
+			Latitude:   r.Store.Latitude,
+			Longitude:  r.Store.Longitude,
+		}
+	}
+	return receipt
+}
@@ -0,0 +1,175 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	receiptsv1 "receipt-processor/api/receipts/v1"
+	"receipt-processor/internal/auth"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/ratelimit"
+	"receipt-processor/internal/tenant"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Metadata keys carrying the API key and tenant, named like the HTTP headers.
+var (
+	apiKeyMetadata = strings.ToLower(auth.APIKeyHeader)
+	tenantMetadata = strings.ToLower(tenant.Header)
+)
+
+// methodScopes is the scope each method requires, as for its REST endpoint.
+var methodScopes = map[string]string{
+	receiptsv1.ReceiptService_ProcessReceipt_FullMethodName: auth.ScopeReceiptsWrite,
+	receiptsv1.ReceiptService_BatchProcess_FullMethodName:   auth.ScopeReceiptsWrite,
+	receiptsv1.ReceiptService_GetPoints_FullMethodName:      auth.ScopeReceiptsRead,
+	receiptsv1.ReceiptService_GetReceipt_FullMethodName:     auth.ScopeReceiptsRead,
+}
+
+// interceptor logs calls, rate limits them, authenticates the caller and
+// resolves its tenant before a method runs, like the HTTP middleware does for
+// the REST routes.
+type interceptor struct {
+	authenticator *auth.Authenticator
+	limiter       *ratelimit.Limiter
+}
+
+func (i *interceptor) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+	ctx, err := i.intercept(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return next(ctx, req)
+}
+
+func (i *interceptor) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, next grpc.StreamHandler) error {
+	ctx, err := i.intercept(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return next(srv, contextStream{ServerStream: ss, ctx: ctx})
+}
+
+// intercept logs the call, then rate limits and authorizes it.
+func (i *interceptor) intercept(ctx context.Context, method string) (context.Context, error) {
+	logger.Info("gRPC request received", logrus.Fields{
+		"method": method,
+	})
+	if err := i.limit(ctx, method); err != nil {
+		return nil, err
+	}
+	return i.authorize(ctx, method)
+}
+
+// limit takes a token for the call from the limiter, keyed by method and by
+// the caller's key ID or peer address as for REST. An exhausted bucket fails
+// with RESOURCE_EXHAUSTED and a google.rpc.RetryInfo saying when to retry.
+func (i *interceptor) limit(ctx context.Context, method string) error {
+	if i.limiter == nil {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	client := i.limiter.ClientKeyFor(first(md, apiKeyMetadata), peerAddress(ctx))
+	result := i.limiter.AllowRoute(method, client)
+	if result.Allowed {
+		return nil
+	}
+
+	logger.Warn("Rate limit exceeded", logrus.Fields{
+		"method": method,
+		"client": client,
+	})
+	st := status.New(codes.ResourceExhausted, "Rate limit exceeded")
+	detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(result.RetryAfter)})
+	if err != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+// peerAddress returns the host of the caller's address, or "" when unknown.
+func peerAddress(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// authorize returns ctx with the caller's key and tenant. Missing or unknown
+// keys fail with UNAUTHENTICATED, and keys lacking the method's scope or the
+// requested tenant with PERMISSION_DENIED.
+func (i *interceptor) authorize(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if i.authenticator.Enabled() {
+		scope, ok := methodScopes[method]
+		if !ok {
+			scope = auth.ScopeAdmin
+		}
+		key, ok := i.authenticator.Authenticate(first(md, apiKeyMetadata))
+		if !ok {
+			logger.Warn("Rejected request with missing or invalid API key", logrus.Fields{
+				"method": method,
+			})
+			return nil, status.Error(codes.Unauthenticated, "Missing or invalid API key")
+		}
+		if !key.HasScope(scope) {
+			logger.Warn("Rejected request lacking required scope", logrus.Fields{
+				"key_id": key.ID,
+				"scope":  scope,
+				"method": method,
+			})
+			return nil, status.Error(codes.PermissionDenied, "API key lacks required scope "+scope)
+		}
+		ctx = auth.WithKey(ctx, key)
+	}
+
+	tenantID, err := tenant.ResolveRequested(ctx, first(md, tenantMetadata))
+	if err != nil {
+		code := codes.InvalidArgument
+		var resolveErr *tenant.ResolveError
+		if errors.As(err, &resolveErr) && resolveErr.Status == http.StatusForbidden {
+			code = codes.PermissionDenied
+		}
+		logger.Warn("Rejected request for tenant", logrus.Fields{
+			"tenant": first(md, tenantMetadata),
+			"error":  err,
+			"method": method,
+		})
+		return nil, status.Error(code, err.Error())
+	}
+	return tenant.WithTenant(ctx, tenantID), nil
+}
+
+// first returns the first value of a metadata key, or "".
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// contextStream is a server stream whose context carries the caller's key and
+// tenant.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s contextStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,159 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	receiptsv1 "receipt-processor/api/receipts/v1"
+	"receipt-processor/internal/auth"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/ratelimit"
+	"receipt-processor/internal/services"
+	"receipt-processor/internal/tenant"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// receiptService implements receiptsv1.ReceiptServiceServer on the same
+// services as the REST handlers.
+type receiptService struct {
+	receiptsv1.UnimplementedReceiptServiceServer
+}
+
+// NewServer returns a gRPC server with the receipt service registered. Calls
+// are rate limited by limiter, which may be nil, authenticated by
+// authenticator and receive messages of up to maxMessageBytes.
+func NewServer(authenticator *auth.Authenticator, limiter *ratelimit.Limiter, maxMessageBytes int) *grpc.Server {
+	interceptor := &interceptor{authenticator: authenticator, limiter: limiter}
+	server := grpc.NewServer(
+		grpc.MaxRecvMsgSize(maxMessageBytes),
+		grpc.UnaryInterceptor(interceptor.unary),
+		grpc.StreamInterceptor(interceptor.stream),
+	)
+	receiptsv1.RegisterReceiptServiceServer(server, receiptService{})
+	return server
+}
+
+// ProcessReceipt validates, scores and stores a receipt.
+func (receiptService) ProcessReceipt(ctx context.Context, req *receiptsv1.ProcessReceiptRequest) (*receiptsv1.ProcessReceiptResponse, error) {
+	return process(ctx, req.GetReceipt(), "receipt")
+}
+
+// GetPoints returns the points of a stored receipt.
+func (receiptService) GetPoints(ctx context.Context, req *receiptsv1.GetPointsRequest) (*receiptsv1.GetPointsResponse, error) {
+	tenantID := tenant.FromContext(ctx)
+	points, explanation, ok := services.GetReceiptPoints(tenantID, req.GetId(), req.GetDetailed())
+	if !ok {
+		return nil, notFound(ctx, tenantID, req.GetId())
+	}
+	return &receiptsv1.GetPointsResponse{Points: int32(points), Explanation: explanation}, nil
+}
+
+// GetReceipt returns a stored receipt with its points.
+func (receiptService) GetReceipt(ctx context.Context, req *receiptsv1.GetReceiptRequest) (*receiptsv1.GetReceiptResponse, error) {
+	tenantID := tenant.FromContext(ctx)
+	details, ok := services.GetReceipt(tenantID, req.GetId())
+	if !ok {
+		return nil, notFound(ctx, tenantID, req.GetId())
+	}
+	response := &receiptsv1.GetReceiptResponse{
+		Id:          req.GetId(),
+		Points:      int32(details.Points),
+		Promotions:  details.Promotions,
+		SubmittedBy: details.SubmittedBy,
+	}
+	if req.GetDetailed() {
+		response.Explanation = details.Explanation
+	}
+	if details.Receipt != nil {
+		response.Receipt = receiptToProto(*details.Receipt)
+	}
+	return response, nil
+}
+
+// BatchProcess processes each receipt in turn and streams its outcome.
+// Failures are reported per receipt; only a failed send ends the stream.
+func (receiptService) BatchProcess(req *receiptsv1.BatchProcessRequest, stream grpc.ServerStreamingServer[receiptsv1.BatchProcessResponse]) error {
+	ctx := stream.Context()
+	for i, r := range req.GetReceipts() {
+		response := &receiptsv1.BatchProcessResponse{Index: int32(i)}
+		result, err := process(ctx, r, fmt.Sprintf("receipts[%d]", i))
+		if err != nil {
+			response.Outcome = &receiptsv1.BatchProcessResponse_Error{Error: status.Convert(err).Proto()}
+		} else {
+			response.Outcome = &receiptsv1.BatchProcessResponse_Result{Result: result}
+		}
+		if err := stream.Send(response); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// process validates, scores and stores one receipt. field is the receipt's
+// path in the request, for field violations.
+func process(ctx context.Context, r *receiptsv1.Receipt, field string) (*receiptsv1.ProcessReceiptResponse, error) {
+	method, _ := grpc.Method(ctx)
+	if r == nil {
+		return nil, invalidArgument(field, errors.New("receipt is required"))
+	}
+	tenantID := tenant.FromContext(ctx)
+	rs := services.RulesetFor(tenantID)
+	receipt := receiptFromProto(r)
+	if err := services.ValidateReceipt(receipt, rs); err != nil {
+		logger.Error("Receipt validation failed", logrus.Fields{
+			"error":   err,
+			"method":  method,
+			"receipt": receipt,
+		})
+		return nil, invalidArgument(field, err)
+	}
+
+	var submittedBy string
+	if key, ok := auth.KeyFromContext(ctx); ok {
+		submittedBy = key.ID
+	}
+	id, details, stored := services.ProcessReceipt(tenantID, receipt, rs, submittedBy)
+	logger.Info("Receipt processed successfully", logrus.Fields{
+		"tenant":       tenantID,
+		"id":           id,
+		"points":       details.Points,
+		"duplicate":    !stored,
+		"submitted_by": submittedBy,
+		"method":       method,
+	})
+	return &receiptsv1.ProcessReceiptResponse{Id: id, Points: int32(details.Points), Duplicate: !stored}, nil
+}
+
+// invalidArgument is the INVALID_ARGUMENT status for a receipt that failed
+// validation, with a google.rpc.BadRequest naming the offending field under
+// the receipt's path.
+func invalidArgument(field string, err error) error {
+	var fieldErr *model.FieldError
+	if errors.As(err, &fieldErr) {
+		field += "." + fieldErr.Field
+	}
+	st := status.New(codes.InvalidArgument, "Validation error: "+err.Error())
+	detailed, detailErr := st.WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: field, Description: err.Error()}},
+	})
+	if detailErr != nil {
+		return st.Err()
+	}
+	return detailed.Err()
+}
+
+func notFound(ctx context.Context, tenantID, id string) error {
+	method, _ := grpc.Method(ctx)
+	logger.Error("Invalid receipt ID", logrus.Fields{
+		"tenant":     tenantID,
+		"receipt_id": id,
+		"method":     method,
+	})
+	return status.Error(codes.NotFound, "Incorrect receipt ID")
+}
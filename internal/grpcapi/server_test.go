@@ -0,0 +1,264 @@
+package grpcapi
+
+import (
+	"context"
+	"io"
+	"net"
+	receiptsv1 "receipt-processor/api/receipts/v1"
+	"receipt-processor/internal/auth"
+	"receipt-processor/internal/ratelimit"
+	"receipt-processor/internal/services"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newClient serves the receipt service on an in-process listener with the
+// pos (write) and reader (read) keys and returns a client for it.
+func newClient(t *testing.T) receiptsv1.ReceiptServiceClient {
+	t.Helper()
+	return newLimitedClient(t, nil)
+}
+
+// newLimitedClient is newClient with calls rate limited by limiter, which may
+// be nil.
+func newLimitedClient(t *testing.T, limiter *ratelimit.Limiter) receiptsv1.ReceiptServiceClient {
+	t.Helper()
+	services.ResetStore()
+	t.Cleanup(services.ResetStore)
+
+	authenticator := testAuthenticator(t)
+	listener := bufconn.Listen(1 << 20)
+	server := NewServer(authenticator, limiter, 1<<20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return receiptsv1.NewReceiptServiceClient(conn)
+}
+
+// testAuthenticator knows the pos (write) and reader (read) keys.
+func testAuthenticator(t *testing.T) *auth.Authenticator {
+	t.Helper()
+	authenticator, err := auth.NewAuthenticator([]auth.Key{
+		{ID: "pos", Hash: auth.HashKey("pos-secret"), Scopes: []string{auth.ScopeReceiptsWrite}},
+		{ID: "reader", Hash: auth.HashKey("reader-secret"), Scopes: []string{auth.ScopeReceiptsRead}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authenticator
+}
+
+func withKey(key string, pairs ...string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), append([]string{"x-api-key", key}, pairs...)...)
+}
+
+func cornerMarket() *receiptsv1.Receipt {
+	receipt := &receiptsv1.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: "2022-03-20",
+		PurchaseTime: "14:33",
+		Total:        "9.00",
+	}
+	for i := 0; i < 4; i++ {
+		receipt.Items = append(receipt.Items, &receiptsv1.Item{ShortDescription: "Gatorade", Price: "2.25"})
+	}
+	return receipt
+}
+
+// fieldViolation returns the single field violation in err's details.
+func fieldViolation(t *testing.T, st *status.Status) string {
+	t.Helper()
+	for _, detail := range st.Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok && len(badRequest.FieldViolations) == 1 {
+			return badRequest.FieldViolations[0].Field
+		}
+	}
+	t.Fatalf("expected one field violation in %v", st.Details())
+	return ""
+}
+
+func TestProcessAndGet(t *testing.T) {
+	client := newClient(t)
+	writer, reader := withKey("pos-secret"), withKey("reader-secret")
+
+	created, err := client.ProcessReceipt(writer, &receiptsv1.ProcessReceiptRequest{Receipt: cornerMarket()})
+	if err != nil || created.Id == "" || created.Points != 109 || created.Duplicate {
+		t.Fatalf("ProcessReceipt() = %v, %v", created, err)
+	}
+	again, err := client.ProcessReceipt(writer, &receiptsv1.ProcessReceiptRequest{Receipt: cornerMarket()})
+	if err != nil || again.Id != created.Id || !again.Duplicate || again.Points != 109 {
+		t.Errorf("expected the duplicate to return the stored receipt; got %v, %v", again, err)
+	}
+
+	points, err := client.GetPoints(reader, &receiptsv1.GetPointsRequest{Id: created.Id, Detailed: true})
+	if err != nil || points.Points != 109 || points.Explanation == "" {
+		t.Errorf("GetPoints() = %v, %v", points, err)
+	}
+	receipt, err := client.GetReceipt(reader, &receiptsv1.GetReceiptRequest{Id: created.Id})
+	if err != nil || receipt.Receipt.GetRetailer() != "M&M Corner Market" || len(receipt.Receipt.GetItems()) != 4 ||
+		receipt.SubmittedBy != "pos" || receipt.Explanation != "" {
+		t.Errorf("GetReceipt() = %v, %v", receipt, err)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		id   string
+		code codes.Code
+	}{
+		{"unknown receipt", reader, "missing", codes.NotFound},
+		{"no API key", context.Background(), created.Id, codes.Unauthenticated},
+		{"missing scope", writer, created.Id, codes.PermissionDenied},
+		{"other tenant", withKey("reader-secret", "x-tenant-id", "acme"), created.Id, codes.PermissionDenied},
+		{"invalid tenant", withKey("reader-secret", "x-tenant-id", "not a tenant"), created.Id, codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.GetPoints(tt.ctx, &receiptsv1.GetPointsRequest{Id: tt.id})
+			if status.Code(err) != tt.code {
+				t.Errorf("expected %s; got %v", tt.code, err)
+			}
+		})
+	}
+}
+
+func TestProcessReceipt_Invalid(t *testing.T) {
+	client := newClient(t)
+	ctx := withKey("pos-secret")
+
+	receipt := cornerMarket()
+	receipt.Items[1].Price = "2.2"
+	_, err := client.ProcessReceipt(ctx, &receiptsv1.ProcessReceiptRequest{Receipt: receipt})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument; got %v", err)
+	}
+	if field := fieldViolation(t, st); field != "receipt.items[1].price" {
+		t.Errorf("expected a violation of receipt.items[1].price; got %s", field)
+	}
+
+	_, err = client.ProcessReceipt(ctx, &receiptsv1.ProcessReceiptRequest{})
+	if st := status.Convert(err); st.Code() != codes.InvalidArgument || fieldViolation(t, st) != "receipt" {
+		t.Errorf("expected a missing receipt to be invalid; got %v", err)
+	}
+}
+
+func TestBatchProcess(t *testing.T) {
+	client := newClient(t)
+	invalid := cornerMarket()
+	invalid.Retailer = ""
+	stream, err := client.BatchProcess(withKey("pos-secret"), &receiptsv1.BatchProcessRequest{
+		Receipts: []*receiptsv1.Receipt{cornerMarket(), invalid, cornerMarket()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var responses []*receiptsv1.BatchProcessResponse
+	for {
+		response, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, response)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("expected a response per receipt; got %v", responses)
+	}
+	first, last := responses[0].GetResult(), responses[2].GetResult()
+	if first == nil || first.Points != 109 || last == nil || !last.Duplicate || last.Id != first.Id {
+		t.Errorf("expected the first receipt stored and the last a duplicate; got %v", responses)
+	}
+	st := status.FromProto(responses[1].GetError())
+	if responses[1].Index != 1 || st.Code() != codes.InvalidArgument || fieldViolation(t, st) != "receipts[1].retailer" {
+		t.Errorf("expected receipts[1] to fail validation; got %v", responses[1])
+	}
+
+	// The write scope is required, as for ProcessReceipt
+	stream, err = client.BatchProcess(withKey("reader-secret"), &receiptsv1.BatchProcessRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied; got %v", err)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	getPoints := receiptsv1.ReceiptService_GetPoints_FullMethodName
+	batch := receiptsv1.ReceiptService_BatchProcess_FullMethodName
+	limiter := ratelimit.New(ratelimit.Config{
+		Routes:        map[string]ratelimit.Rule{getPoints: {RPS: 0.001, Burst: 1}, batch: {RPS: 0.001, Burst: 1}},
+		Authenticator: testAuthenticator(t),
+	})
+	client := newLimitedClient(t, limiter)
+	getPointsCode := func(ctx context.Context) codes.Code {
+		_, err := client.GetPoints(ctx, &receiptsv1.GetPointsRequest{Id: "missing"})
+		return status.Code(err)
+	}
+
+	// Each key has its own bucket per method; methods without a rule are not limited
+	reader := withKey("reader-secret")
+	if code := getPointsCode(reader); code != codes.NotFound {
+		t.Errorf("expected the first call to go through; got %s", code)
+	}
+	_, err := client.GetPoints(reader, &receiptsv1.GetPointsRequest{Id: "missing"})
+	st := status.Convert(err)
+	if st.Code() != codes.ResourceExhausted || len(st.Details()) != 1 {
+		t.Errorf("expected ResourceExhausted with retry info; got %v", err)
+	} else if info, ok := st.Details()[0].(*errdetails.RetryInfo); !ok || info.RetryDelay.AsDuration() <= 0 {
+		t.Errorf("expected a retry delay; got %v", st.Details())
+	}
+	if _, err := client.GetReceipt(reader, &receiptsv1.GetReceiptRequest{Id: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected GetReceipt not to be limited; got %v", err)
+	}
+
+	// Made-up keys share the peer address's bucket
+	if code := getPointsCode(withKey("bogus-1")); code != codes.Unauthenticated {
+		t.Errorf("expected the first made-up key to pass the limit and fail authentication; got %s", code)
+	}
+	for _, key := range []string{"bogus-2", "bogus-3", "bogus-4"} {
+		if code := getPointsCode(withKey(key)); code != codes.ResourceExhausted {
+			t.Errorf("%s: expected ResourceExhausted; got %s", key, code)
+		}
+	}
+
+	// Streams are limited too
+	for i, want := range []codes.Code{codes.OK, codes.ResourceExhausted} {
+		stream, err := client.BatchProcess(withKey("pos-secret"), &receiptsv1.BatchProcessRequest{})
+		if err == nil {
+			_, err = stream.Recv()
+			if err == io.EOF {
+				err = nil
+			}
+		}
+		if status.Code(err) != want {
+			t.Errorf("BatchProcess call %d: expected %s; got %v", i+1, want, err)
+		}
+	}
+
+	// Reloaded rules apply to running servers
+	limiter.SetRules(ratelimit.Rule{}, nil)
+	if code := getPointsCode(reader); code != codes.NotFound {
+		t.Errorf("expected no limit after the rules were reloaded; got %s", code)
+	}
+}
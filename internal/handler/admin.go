@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"net/http"
+	"receipt-processor/internal/utility"
+	"sync"
+	"time"
+)
+
+// ReloadStatus describes the configuration a running server is using and the
+// outcome of the most recent reload attempt.
+type ReloadStatus struct {
+	OK              bool       `json:"ok"`
+	Trigger         string     `json:"trigger,omitempty"`
+	AttemptedAt     *time.Time `json:"attemptedAt,omitempty"`
+	LoadedAt        time.Time  `json:"loadedAt"`
+	RulesetVersion  string     `json:"rulesetVersion"`
+	Error           string     `json:"error,omitempty"`
+	RestartRequired []string   `json:"restartRequired,omitempty"`
+}
+
+// Reloader re-reads the rulesets and reloadable configuration.
+type Reloader interface {
+	Reload(trigger string) ReloadStatus
+	Status() ReloadStatus
+}
+
+var (
+	reloaderMu sync.RWMutex
+	reloader   Reloader
+)
+
+// SetReloader registers the reloader used by the admin reload endpoints.
+func SetReloader(r Reloader) {
+	reloaderMu.Lock()
+	defer reloaderMu.Unlock()
+	reloader = r
+}
+
+func currentReloader() Reloader {
+	reloaderMu.RLock()
+	defer reloaderMu.RUnlock()
+	return reloader
+}
+
+// Reload handles POST requests on /admin/reload. It returns the new status,
+// with 422 when the new configuration was rejected and the old one kept.
+func Reload(w http.ResponseWriter, r *http.Request) {
+	rl := currentReloader()
+	if rl == nil {
+		utility.WriteError(w, "Reload is not available", http.StatusServiceUnavailable)
+		return
+	}
+	status := rl.Reload("api")
+	if !status.OK {
+		utility.WriteJSONWithStatus(w, status, http.StatusUnprocessableEntity)
+		return
+	}
+	utility.WriteJSONWithStatus(w, status, http.StatusOK)
+}
+
+// GetReloadStatus handles GET requests on /admin/reload, reporting the active
+// configuration and why the last reload failed, if it did.
+func GetReloadStatus(w http.ResponseWriter, r *http.Request) {
+	rl := currentReloader()
+	if rl == nil {
+		utility.WriteError(w, "Reload is not available", http.StatusServiceUnavailable)
+		return
+	}
+	utility.WriteJSONWithStatus(w, rl.Status(), http.StatusOK)
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type fakeReloader struct {
+	next    ReloadStatus
+	reloads int
+}
+
+func (f *fakeReloader) Reload(trigger string) ReloadStatus {
+	f.reloads++
+	f.next.Trigger = trigger
+	return f.next
+}
+
+func (f *fakeReloader) Status() ReloadStatus {
+	return f.next
+}
+
+func TestReload(t *testing.T) {
+	defer SetReloader(nil)
+
+	rr := httptest.NewRecorder()
+	Reload(rr, httptest.NewRequest("POST", "/admin/reload", nil))
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without a reloader; got %d", rr.Code)
+	}
+
+	fake := &fakeReloader{next: ReloadStatus{OK: true, RulesetVersion: "v2"}}
+	SetReloader(fake)
+	rr = httptest.NewRecorder()
+	Reload(rr, httptest.NewRequest("POST", "/admin/reload", nil))
+	if rr.Code != http.StatusOK || fake.reloads != 1 {
+		t.Errorf("expected a successful reload; got %d after %d reloads", rr.Code, fake.reloads)
+	}
+
+	fake.next = ReloadStatus{OK: false, Error: "parsing rulesets: bad", RulesetVersion: "v2"}
+	rr = httptest.NewRecorder()
+	Reload(rr, httptest.NewRequest("POST", "/admin/reload", nil))
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for a rejected reload; got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	GetReloadStatus(rr, httptest.NewRequest("GET", "/admin/reload", nil))
+	var status ReloadStatus
+	if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusOK || status.OK || status.Error != "parsing rulesets: bad" || status.Trigger != "api" {
+		t.Errorf("expected the status to expose the failure; got %d %+v", rr.Code, status)
+	}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"receipt-processor/internal/ingest"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/services"
+	"receipt-processor/internal/tenant"
+	"receipt-processor/internal/utility"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	emailTemplatesMu sync.RWMutex
+	emailTemplates   = &ingest.EmailTemplates{}
+)
+
+// SetEmailTemplates sets the per-domain templates /receipts/email extracts
+// e-receipts with.
+func SetEmailTemplates(templates *ingest.EmailTemplates) {
+	emailTemplatesMu.Lock()
+	defer emailTemplatesMu.Unlock()
+	emailTemplates = templates
+}
+
+func currentEmailTemplates() *ingest.EmailTemplates {
+	emailTemplatesMu.RLock()
+	defer emailTemplatesMu.RUnlock()
+	return emailTemplates
+}
+
+// ProcessEmail handles POST requests on /receipts/email. The body is an
+// e-receipt email (.eml), sent as message/rfc822 or as the "file" field of a
+// multipart/form-data upload. The receipt is validated, scored and stored
+// like one sent to /process, and the response is the same.
+func ProcessEmail(w http.ResponseWriter, r *http.Request) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "message/rfc822" && mediaType != "multipart/form-data" {
+		utility.WriteError(w, "Content-Type must be message/rfc822 or multipart/form-data", http.StatusUnsupportedMediaType)
+		return
+	}
+	body, ok := readRequestBody(w, r, "/email")
+	if !ok {
+		return
+	}
+	if mediaType == "multipart/form-data" {
+		if body, err = uploadedFile(body, params["boundary"], "file"); err != nil {
+			logger.Error("Failed to read email upload", logrus.Fields{
+				"error":    err,
+				"endpoint": "/email",
+			})
+			utility.WriteError(w, "Invalid upload: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	rs := services.RulesetFor(tenant.FromContext(r.Context()))
+	receipt, err := ingest.ParseEmail(bytes.NewReader(body), currentEmailTemplates())
+	if err != nil {
+		logger.Error("Failed to parse email receipt", logrus.Fields{
+			"error":    err,
+			"endpoint": "/email",
+		})
+		var errs ingest.ParseErrors
+		if !errors.As(err, &errs) {
+			errs = ingest.ParseErrors{{Message: err.Error()}}
+		}
+		utility.WriteJSONWithStatus(w, TextParseError{Error: "Unparsable email receipt", Errors: errs}, http.StatusBadRequest)
+		return
+	}
+	if !validateReceipt(w, receipt, "/email", rs) {
+		return
+	}
+	storeProcessedReceipt(w, r, receipt, rs, "/email")
+}
+
+// uploadedFile returns the content of the named field of a multipart/form-data body.
+func uploadedFile(body []byte, boundary, field string) ([]byte, error) {
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("no " + field + " field in the form")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == field {
+			return io.ReadAll(part)
+		}
+	}
+}
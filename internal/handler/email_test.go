@@ -0,0 +1,77 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"receipt-processor/internal/services"
+	"strings"
+	"testing"
+)
+
+const cornerMarketEmail = `From: M&M Corner Market <receipts@mmcorner.example>
+Date: Sun, 20 Mar 2022 14:33:00 -0500
+Content-Type: text/plain; charset=utf-8
+
+Gatorade     2.25
+Gatorade     2.25
+Gatorade     2.25
+Gatorade     2.25
+TOTAL        9.00
+`
+
+func postEmail(body io.Reader, contentType string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/receipts/email", body)
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	ProcessEmail(rr, req)
+	return rr
+}
+
+func TestProcessEmail(t *testing.T) {
+	services.ResetStore()
+	defer services.ResetStore()
+
+	rr := postEmail(strings.NewReader(cornerMarketEmail), "message/rfc822")
+	var created map[string]string
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &created) != nil || created["id"] == "" {
+		t.Fatalf("expected the email receipt to be processed; got %d: %s", rr.Code, rr.Body.String())
+	}
+	if points, _, ok := services.GetReceiptPoints(services.DefaultTenant, created["id"], false); !ok || points != 109 {
+		t.Errorf("expected the email receipt to score 109 points; got %d", points)
+	}
+
+	// The same email uploaded as a form file is a duplicate
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	file, _ := writer.CreateFormFile("file", "receipt.eml")
+	file.Write([]byte(cornerMarketEmail))
+	writer.Close()
+	rr = postEmail(&form, writer.FormDataContentType())
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), created["id"]) {
+		t.Errorf("expected the uploaded email to return the existing ID; got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestProcessEmail_Errors(t *testing.T) {
+	if rr := postEmail(strings.NewReader(cornerMarketEmail), "text/plain"); rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415 for a non-email body; got %d", rr.Code)
+	}
+
+	rr := postEmail(strings.NewReader(strings.Replace(cornerMarketEmail, "TOTAL", "Thanks", 1)), "message/rfc822")
+	var parseErr TextParseError
+	if rr.Code != http.StatusBadRequest || json.Unmarshal(rr.Body.Bytes(), &parseErr) != nil || parseErr.Error != "Unparsable email receipt" {
+		t.Fatalf("expected 400 with parse errors; got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	writer.WriteField("note", "no file")
+	writer.Close()
+	if rr := postEmail(&form, writer.FormDataContentType()); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a form without a file; got %d", rr.Code)
+	}
+}
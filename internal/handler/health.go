@@ -1,12 +1,55 @@
 package handler
 
 import (
+	"context"
 	"net/http"
 	"receipt-processor/internal/logger"
+	"receipt-processor/internal/utility"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+// readinessTimeout bounds how long a single readiness probe may take.
+const readinessTimeout = 2 * time.Second
+
+// ReadinessCheck reports whether a dependency the service relies on is usable.
+type ReadinessCheck func(ctx context.Context) error
+
+// CheckResult is the outcome of a single readiness check.
+type CheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latencyMs"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// ReadinessResponse is the JSON body returned by the /readyz endpoint.
+type ReadinessResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+var (
+	readinessMu     sync.RWMutex
+	readinessChecks = map[string]ReadinessCheck{}
+	shuttingDown    atomic.Bool
+)
+
+// RegisterReadinessCheck adds (or replaces) a named check evaluated by /readyz.
+func RegisterReadinessCheck(name string, check ReadinessCheck) {
+	readinessMu.Lock()
+	defer readinessMu.Unlock()
+	readinessChecks[name] = check
+}
+
+// SetShuttingDown marks the service as draining so /readyz reports unavailable.
+func SetShuttingDown(draining bool) {
+	shuttingDown.Store(draining)
+}
+
 // HealthCheck handles GET requests on the /health endpoint.
 func HealthCheck(w http.ResponseWriter, r *http.Request) {
 	// Log the health check access
@@ -24,3 +67,60 @@ func HealthCheck(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 }
+
+// Livez handles GET requests on the /livez endpoint. It only reports that the
+// process is up and serving HTTP; dependencies are covered by /readyz.
+func Livez(w http.ResponseWriter, r *http.Request) {
+	utility.WriteJSONWithStatus(w, map[string]string{"status": "ok"}, http.StatusOK)
+}
+
+// Readyz handles GET requests on the /readyz endpoint. It runs every registered
+// readiness check and returns 503 if any fails or the server is shutting down.
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	response := ReadinessResponse{
+		Status: "ok",
+		Checks: map[string]CheckResult{},
+	}
+
+	readinessMu.RLock()
+	names := make([]string, 0, len(readinessChecks))
+	checks := make(map[string]ReadinessCheck, len(readinessChecks))
+	for name, check := range readinessChecks {
+		names = append(names, name)
+		checks[name] = check
+	}
+	readinessMu.RUnlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		start := time.Now()
+		err := checks[name](ctx)
+		cancel()
+
+		result := CheckResult{
+			Status:    "ok",
+			LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+			response.Status = "unavailable"
+			logger.Warn("Readiness check failed", logrus.Fields{
+				"check": name,
+				"error": err,
+			})
+		}
+		response.Checks[name] = result
+	}
+
+	if shuttingDown.Load() {
+		response.Status = "shutting_down"
+	}
+
+	status := http.StatusOK
+	if response.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	utility.WriteJSONWithStatus(w, response, status)
+}
@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -26,3 +29,76 @@ func TestHealthCheck(t *testing.T) {
 		t.Errorf("HealthCheck handler returned unexpected body: got %v want %v", rr.Body.String(), expected)
 	}
 }
+
+func TestLivez(t *testing.T) {
+	req, err := http.NewRequest("GET", "/livez", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Livez).ServeHTTP(rr, req)
+
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Livez handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	defer resetReadiness()
+
+	RegisterReadinessCheck("store", func(ctx context.Context) error { return nil })
+
+	rr := serveReadyz(t)
+	if status := rr.Code; status != http.StatusOK {
+		t.Errorf("Readyz handler returned wrong status code: got %v want %v", status, http.StatusOK)
+	}
+	var body ReadinessResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Readyz returned invalid JSON: %v", err)
+	}
+	if body.Status != "ok" || body.Checks["store"].Status != "ok" {
+		t.Errorf("Readyz returned unexpected body: %+v", body)
+	}
+
+	// A failing dependency makes the service unready
+	RegisterReadinessCheck("ruleset", func(ctx context.Context) error { return errors.New("not loaded") })
+	rr = serveReadyz(t)
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("Readyz handler returned wrong status code: got %v want %v", status, http.StatusServiceUnavailable)
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Readyz returned invalid JSON: %v", err)
+	}
+	if body.Checks["ruleset"].Error != "not loaded" {
+		t.Errorf("expected ruleset check error to be reported; got %+v", body.Checks["ruleset"])
+	}
+}
+
+func TestReadyz_ShuttingDown(t *testing.T) {
+	defer resetReadiness()
+
+	SetShuttingDown(true)
+	rr := serveReadyz(t)
+	if status := rr.Code; status != http.StatusServiceUnavailable {
+		t.Errorf("Readyz handler returned wrong status code during shutdown: got %v want %v", status, http.StatusServiceUnavailable)
+	}
+}
+
+func serveReadyz(t *testing.T) *httptest.ResponseRecorder {
+	t.Helper()
+	req, err := http.NewRequest("GET", "/readyz", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(Readyz).ServeHTTP(rr, req)
+	return rr
+}
+
+func resetReadiness() {
+	readinessMu.Lock()
+	readinessChecks = map[string]ReadinessCheck{}
+	readinessMu.Unlock()
+	SetShuttingDown(false)
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"receipt-processor/internal/auth"
+	"receipt-processor/internal/ingest"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/services"
+	"receipt-processor/internal/tenant"
+	"receipt-processor/internal/utility"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Statuses of a receipt in an import report.
+const (
+	ImportImported  = "imported"
+	ImportDuplicate = "duplicate"
+	ImportInvalid   = "invalid"
+)
+
+// ImportReport is the response of /receipts/import: one result per receipt
+// found in the file, in the order they first appear.
+type ImportReport struct {
+	Imported   int            `json:"imported"`
+	Duplicates int            `json:"duplicates"`
+	Invalid    int            `json:"invalid"`
+	Receipts   []ImportResult `json:"receipts"`
+}
+
+// ImportResult is the outcome for the receipt assembled from some CSV rows.
+// Errors lists row-level problems; Error is set when the assembled receipt
+// failed validation.
+type ImportResult struct {
+	Key    string             `json:"key"`
+	Lines  []int              `json:"lines"`
+	Status string             `json:"status"`
+	ID     string             `json:"id,omitempty"` // new ID, or the existing one for a duplicate
+	Points *int               `json:"points,omitempty"`
+	Error  string             `json:"error,omitempty"`
+	Errors ingest.ParseErrors `json:"errors,omitempty"`
+}
+
+var (
+	importColumnsMu sync.RWMutex
+	importColumns   = ingest.DefaultCSVColumns()
+)
+
+// SetImportColumns sets the CSV column mapping used by /receipts/import when
+// the request does not give one.
+func SetImportColumns(columns ingest.CSVColumns) {
+	importColumnsMu.Lock()
+	defer importColumnsMu.Unlock()
+	importColumns = columns
+}
+
+func currentImportColumns() ingest.CSVColumns {
+	importColumnsMu.RLock()
+	defer importColumnsMu.RUnlock()
+	return importColumns
+}
+
+// ImportReceipts handles POST requests on /receipts/import. The text/csv body
+// holds one row per item, grouped into receipts by a key column. Each receipt
+// is validated, checked for duplicates, scored and stored like one sent to
+// /process. The columns query parameter overrides parts of the column mapping,
+// e.g. columns=receipt=Receipt No,retailer=Merchant.
+func ImportReceipts(w http.ResponseWriter, r *http.Request) {
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "text/csv" {
+		utility.WriteError(w, "Content-Type must be text/csv", http.StatusUnsupportedMediaType)
+		return
+	}
+	columns, err := currentImportColumns().Overlay(r.URL.Query().Get("columns"))
+	if err != nil {
+		utility.WriteError(w, "Invalid columns: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	body, ok := readRequestBody(w, r, "/import")
+	if !ok {
+		return
+	}
+	parsed, err := ingest.ParseCSV(bytes.NewReader(body), columns)
+	if err != nil {
+		logger.Error("Failed to read CSV import", logrus.Fields{
+			"error":    err,
+			"endpoint": "/import",
+		})
+		utility.WriteError(w, "Invalid CSV: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tenantID := tenant.FromContext(r.Context())
+	rs := services.RulesetFor(tenantID)
+	submittedBy := ""
+	if key, ok := auth.KeyFromContext(r.Context()); ok {
+		submittedBy = key.ID
+	}
+
+	report := ImportReport{Receipts: []ImportResult{}}
+	for _, rc := range parsed {
+		result := importCSVReceipt(tenantID, rc, rs, submittedBy)
+		switch result.Status {
+		case ImportImported:
+			report.Imported++
+		case ImportDuplicate:
+			report.Duplicates++
+		default:
+			report.Invalid++
+		}
+		report.Receipts = append(report.Receipts, result)
+	}
+
+	logger.Info("CSV import processed", logrus.Fields{
+		"tenant":       tenantID,
+		"imported":     report.Imported,
+		"duplicates":   report.Duplicates,
+		"invalid":      report.Invalid,
+		"submitted_by": submittedBy,
+		"endpoint":     "/import",
+	})
+	utility.WriteJSONWithStatus(w, report, http.StatusOK)
+}
+
+// importCSVReceipt validates, dedups, scores and stores one CSV receipt.
+func importCSVReceipt(tenantID string, rc ingest.CSVReceipt, rs services.Ruleset, submittedBy string) ImportResult {
+	result := ImportResult{Key: rc.Key, Lines: rc.Lines, Status: ImportInvalid, Errors: rc.Errors}
+	if len(rc.Errors) > 0 {
+		return result
+	}
+	receipt := rc.Receipt
+	if err := services.ValidateReceipt(receipt, rs); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	id, details, stored := services.ProcessReceipt(tenantID, receipt, rs, submittedBy)
+	result.ID = id
+	if !stored {
+		result.Status = ImportDuplicate
+		return result
+	}
+	result.Status = ImportImported
+	result.Points = &details.Points
+	return result
+}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"receipt-processor/internal/services"
+	"strings"
+	"testing"
+)
+
+const importCSV = `receipt,retailer,purchaseDate,purchaseTime,total,shortDescription,price
+1,Target,2022-01-01,13:01,7.74,Mountain Dew 12PK,6.49
+1,Target,2022-01-01,13:01,7.74,Pepsi,1.25
+2,Target,2022-01-01,13:01,7.74,Mountain Dew 12PK,6.49
+2,Target,2022-01-01,13:01,7.74,Pepsi,1.25
+3,Shell,2022-01-03,09:00,40.00,Unleaded,39.00
+`
+
+func postImport(body, contentType, query string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/receipts/import?"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	ImportReceipts(rr, req)
+	return rr
+}
+
+func TestImportReceipts(t *testing.T) {
+	services.ResetStore()
+	defer services.ResetStore()
+
+	rr := postImport(importCSV, "text/csv; charset=utf-8", "")
+	var report ImportReport
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &report) != nil {
+		t.Fatalf("expected a report; got %d: %s", rr.Code, rr.Body.String())
+	}
+	if report.Imported != 1 || report.Duplicates != 1 || report.Invalid != 1 || len(report.Receipts) != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	imported, duplicate, invalid := report.Receipts[0], report.Receipts[1], report.Receipts[2]
+	if imported.Status != ImportImported || imported.Points == nil || len(imported.Lines) != 2 {
+		t.Errorf("unexpected imported result: %+v", imported)
+	}
+	if points, _, ok := services.GetReceiptPoints(services.DefaultTenant, imported.ID, false); !ok || points != *imported.Points {
+		t.Errorf("expected the imported receipt to be stored with its points; got %d, %v", points, ok)
+	}
+	if duplicate.Status != ImportDuplicate || duplicate.ID != imported.ID {
+		t.Errorf("expected receipt 2 to duplicate receipt 1; got %+v", duplicate)
+	}
+	if invalid.Status != ImportInvalid || !strings.Contains(invalid.Error, "total") {
+		t.Errorf("expected receipt 3 to fail validation; got %+v", invalid)
+	}
+}
+
+func TestImportReceipts_Errors(t *testing.T) {
+	if rr := postImport(importCSV, "application/json", ""); rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415 for a non-CSV body; got %d", rr.Code)
+	}
+	if rr := postImport("a,b\n1,2\n", "text/csv", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a header without the required columns; got %d", rr.Code)
+	}
+	if rr := postImport(importCSV, "text/csv", "columns="+url.QueryEscape("shop=Merchant")); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown field in columns; got %d", rr.Code)
+	}
+
+	// The mapping can be changed per request
+	services.ResetStore()
+	defer services.ResetStore()
+	body := strings.Replace(importCSV, "retailer,", "Merchant,", 1)
+	rr := postImport(body, "text/csv", "columns="+url.QueryEscape("retailer=Merchant"))
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"imported":1`) {
+		t.Errorf("expected the mapped column to be read; got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -14,13 +14,13 @@ type Utility interface {
 // Services interface for receipt services
 type Services interface {
 	GenerateHash(receipt model.Receipt) string
-	CheckReceipt(hash string) (string, bool)
+	CheckReceipt(tenant, hash string) (string, bool)
 	CalculatePoints(receipt model.Receipt) (int, string)
-	StoreReceipt(id, hash string, points int, explanation string)
+	StoreReceipt(tenant, id, hash string, details model.ReceiptDetails)
 	GenerateID() string
 }
 
 // PointsServices interface for points retrieval
 type PointsServices interface {
-	GetReceiptPoints(id string, detailed bool) (int, string, bool)
+	GetReceiptPoints(tenant, id string, detailed bool) (int, string, bool)
 }
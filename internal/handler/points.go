@@ -1,53 +1,106 @@
 package handler
 
 import (
+	"encoding/xml"
 	"net/http"
 	"receipt-processor/internal/logger"
 	"receipt-processor/internal/services"
+	"receipt-processor/internal/tenant"
 	"receipt-processor/internal/utility"
+	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
-// GetPoints handles GET requests on the /{id}/points endpoint to retrieve points for a specific receipt.
+// responseTypes are the media types the points and receipt endpoints offer,
+// JSON first for clients that do not say.
+var responseTypes = []string{utility.MediaJSON, utility.MediaXML, utility.MediaCSV}
+
+// PointsResponse is the body of /{id}/points. Explanation is only set for
+// detailed requests.
+type PointsResponse struct {
+	XMLName     xml.Name `json:"-" xml:"receiptPoints"`
+	Points      int      `json:"points" xml:"points"`
+	Explanation *string  `json:"explanation,omitempty" xml:"explanation,omitempty"`
+}
+
+func (p PointsResponse) CSVHeader() []string {
+	if p.Explanation != nil {
+		return []string{"points", "explanation"}
+	}
+	return []string{"points"}
+}
+
+func (p PointsResponse) CSVRows() [][]string {
+	row := []string{strconv.Itoa(p.Points)}
+	if p.Explanation != nil {
+		row = append(row, *p.Explanation)
+	}
+	return [][]string{row}
+}
+
+// negotiate picks the response type for the Accept header. It writes a 406
+// and returns false when none of responseTypes is acceptable.
+func negotiate(w http.ResponseWriter, r *http.Request, endpoint string) (string, bool) {
+	mediaType, ok := utility.Negotiate(r, responseTypes...)
+	if !ok {
+		logger.Error("No acceptable response type", logrus.Fields{
+			"accept":   r.Header.Get("Accept"),
+			"endpoint": endpoint,
+		})
+		utility.WriteError(w, "Not acceptable, supported types are "+strings.Join(responseTypes, ", "), http.StatusNotAcceptable)
+	}
+	return mediaType, ok
+}
+
+// GetPoints handles GET requests on the /{id}/points endpoint to retrieve
+// points for a specific receipt, as JSON, XML or CSV per the Accept header.
 func GetPoints(w http.ResponseWriter, r *http.Request) {
+	mediaType, ok := negotiate(w, r, "/{id}/points")
+	if !ok {
+		return
+	}
 	vars := mux.Vars(r)
 	id, exists := vars["id"]
 	if !exists {
 		logger.Error("Missing receipt ID in request", logrus.Fields{
 			"endpoint": "/{id}/points",
 		})
-		utility.WriteError(w, "Missing receipt ID in request", http.StatusBadRequest)
+		utility.WriteFormattedError(w, mediaType, "Missing receipt ID in request", http.StatusBadRequest)
 		return
 	}
 
 	// Check if the detailed flag is set in the query
 	detailed := r.URL.Query().Get("detailed") == "true"
 
-	// Retrieve points and explanation for the receipt
-	points, explanation, ok := services.GetReceiptPoints(id, detailed)
+	// Retrieve points and explanation for the receipt from the caller's tenant
+	tenantID := tenant.FromContext(r.Context())
+	points, explanation, ok := services.GetReceiptPoints(tenantID, id, detailed)
 	if !ok {
 		logger.Error("Invalid receipt ID", logrus.Fields{
+			"tenant":     tenantID,
 			"receipt_id": id,
 			"endpoint":   "/{id}/points",
 		})
-		utility.WriteError(w, "Incorrect receipt ID", http.StatusNotFound)
+		utility.WriteFormattedError(w, mediaType, "Incorrect receipt ID", http.StatusNotFound)
 		return
 	}
 
 	// Prepare the response
-	response := map[string]interface{}{"points": points}
+	response := PointsResponse{Points: points}
 	if detailed {
-		response["explanation"] = explanation
+		response.Explanation = &explanation
 	}
 
 	logger.Info("Points retrieved successfully", logrus.Fields{
 		"receipt_id": id,
 		"points":     points,
 		"detailed":   detailed,
+		"media_type": mediaType,
 		"endpoint":   "/{id}/points",
 	})
 
-	utility.WriteJSON(w, response)
+	utility.WriteFormatted(w, mediaType, response, http.StatusOK)
 }
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"receipt-processor/internal/tenant"
+	"strings"
 	"testing"
 
 	"github.com/gorilla/mux"
@@ -11,7 +13,7 @@ import (
 
 type MockPointsServices struct{}
 
-func (m *MockPointsServices) GetReceiptPoints(id string, detailed bool) (int, string, bool) {
+func (m *MockPointsServices) GetReceiptPoints(tenant, id string, detailed bool) (int, string, bool) {
 	if id == "id12345" {
 		return 109, "Points breakdown explanation", true
 	}
@@ -80,7 +82,7 @@ func GetPointsWithMocks(
 	}
 
 	detailed := r.URL.Query().Get("detailed") == "true"
-	points, explanation, found := services.GetReceiptPoints(id, detailed)
+	points, explanation, found := services.GetReceiptPoints("default", id, detailed)
 	if !found {
 		http.Error(w, "Receipt ID not found", http.StatusNotFound)
 		return
@@ -95,3 +97,53 @@ func GetPointsWithMocks(
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// Test that a receipt processed for one tenant is invisible to another
+func TestCrossTenantAccess(t *testing.T) {
+	body := `{
+		"retailer": "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}],
+		"total": "6.49"
+	}`
+
+	process := func(tenantID string) string {
+		req := httptest.NewRequest("POST", "/receipts/process", strings.NewReader(body))
+		req = req.WithContext(tenant.WithTenant(req.Context(), tenantID))
+		rr := httptest.NewRecorder()
+		ProcessReceipt(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("ProcessReceipt for %s returned status %d: %s", tenantID, rr.Code, rr.Body.String())
+		}
+		var resp map[string]string
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp["id"]
+	}
+	getPoints := func(tenantID, id string) int {
+		req := httptest.NewRequest("GET", "/receipts/"+id+"/points", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": id})
+		req = req.WithContext(tenant.WithTenant(req.Context(), tenantID))
+		rr := httptest.NewRecorder()
+		GetPoints(rr, req)
+		return rr.Code
+	}
+
+	idA := process("xt-partner-a")
+	idB := process("xt-partner-b")
+	if idA == idB {
+		t.Errorf("expected the same receipt to get separate IDs per tenant; both got %q", idA)
+	}
+
+	if status := getPoints("xt-partner-a", idA); status != http.StatusOK {
+		t.Errorf("expected tenant to read its own receipt; got %d", status)
+	}
+	if status := getPoints("xt-partner-b", idA); status != http.StatusNotFound {
+		t.Errorf("expected 404 reading another tenant's receipt; got %d", status)
+	}
+	if status := getPoints("xt-partner-a", idB); status != http.StatusNotFound {
+		t.Errorf("expected 404 reading another tenant's receipt; got %d", status)
+	}
+}
@@ -1,87 +1,188 @@
 package handler
 
 import (
+	"errors"
+	"mime"
 	"net/http"
+	"receipt-processor/internal/auth"
+	"receipt-processor/internal/ingest"
 	"receipt-processor/internal/logger"
 	"receipt-processor/internal/model"
 	"receipt-processor/internal/services"
+	"receipt-processor/internal/tenant"
 	"receipt-processor/internal/utility"
 
 	"github.com/sirupsen/logrus"
 )
 
-// ProcessReceipt handles POST requests on the /process endpoint for receipt processing.
+// ProcessReceipt handles POST requests on the /process endpoint for receipt
+// processing. The body is a JSON receipt, an XML one when sent as
+// application/xml or text/xml, or the text of a printed receipt when sent as
+// text/plain.
 func ProcessReceipt(w http.ResponseWriter, r *http.Request) {
-	// Read the request body
+	body, ok := readRequestBody(w, r, "/process")
+	if !ok {
+		return
+	}
+	tenantID := tenant.FromContext(r.Context())
+	rs := services.RulesetFor(tenantID)
+	var receipt model.Receipt
+	if isTextBody(r) {
+		receipt, ok = decodeTextReceipt(w, body, "/process", rs)
+	} else if isXMLBody(r) {
+		receipt, ok = decodeXMLReceipt(w, body, "/process", rs)
+	} else {
+		receipt, ok = decodeReceipt(w, body, "/process", rs)
+	}
+	if !ok {
+		return
+	}
+
+	storeProcessedReceipt(w, r, receipt, rs, "/process")
+}
+
+// storeProcessedReceipt scores and stores a validated receipt, or finds the
+// same receipt already stored, and responds with its ID.
+func storeProcessedReceipt(w http.ResponseWriter, r *http.Request, receipt model.Receipt, rs services.Ruleset, endpoint string) {
+	tenantID := tenant.FromContext(r.Context())
+	var submittedBy string
+	if key, ok := auth.KeyFromContext(r.Context()); ok {
+		submittedBy = key.ID
+	}
+
+	id, details, stored := services.ProcessReceipt(tenantID, receipt, rs, submittedBy)
+	if !stored {
+		logger.Info("Receipt already processed", logrus.Fields{
+			"id":       id,
+			"endpoint": endpoint,
+		})
+	} else {
+		logger.Info("Receipt processed successfully", logrus.Fields{
+			"tenant":       tenantID,
+			"id":           id,
+			"points":       details.Points,
+			"submitted_by": submittedBy,
+			"endpoint":     endpoint,
+		})
+	}
+	utility.WriteJSON(w, map[string]string{"id": id})
+}
+
+// readRequestBody reads the request body. It writes the error response and
+// returns false when the body is too large or cannot be read.
+func readRequestBody(w http.ResponseWriter, r *http.Request, endpoint string) ([]byte, bool) {
 	body, err := utility.ReadBody(r)
+	if utility.IsBodyTooLarge(err) {
+		logger.Error("Request body too large", logrus.Fields{
+			"error":    err,
+			"endpoint": endpoint,
+		})
+		utility.WriteError(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
 	if err != nil {
 		logger.Error("Failed to read request body", logrus.Fields{
 			"error":    err,
-			"endpoint": "/process",
+			"endpoint": endpoint,
 		})
 		utility.WriteError(w, "Error reading request body", http.StatusBadRequest)
-		return
+		return nil, false
 	}
+	return body, true
+}
 
-	var dataMap map[string]interface{}
-	if err := utility.ParseJSON(body, &dataMap); err != nil {
-		logger.Error("Invalid JSON format in request", logrus.Fields{
+// decodeReceipt decodes and validates a receipt document, taking retailer time
+// zones from rs. It writes the error response and returns false when the
+// receipt is malformed or invalid.
+func decodeReceipt(w http.ResponseWriter, body []byte, endpoint string, rs services.Ruleset) (model.Receipt, bool) {
+	receipt, err := model.DecodeReceipt(body)
+	if err != nil {
+		message := "Invalid JSON data"
+		switch {
+		case errors.Is(err, model.ErrInvalidJSON):
+			message = "Invalid JSON format"
+		case errors.Is(err, model.ErrUnknownFields):
+			message = "Incorrect Receipt data"
+		}
+		logger.Error("Failed to decode receipt", logrus.Fields{
 			"error":    err,
-			"endpoint": "/process",
+			"endpoint": endpoint,
 		})
-		utility.WriteError(w, "Invalid JSON format", http.StatusBadRequest)
-		return
+		utility.WriteError(w, message, http.StatusBadRequest)
+		return model.Receipt{}, false
 	}
+	return receipt, validateReceipt(w, receipt, endpoint, rs)
+}
 
-	var receipt model.Receipt
-	if err := receipt.ValidateReceiptMap(dataMap); err != nil {
-		logger.Error("Invalid receipt data in request", logrus.Fields{
+// isXMLBody reports whether the request body is an XML receipt.
+func isXMLBody(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && (mediaType == "application/xml" || mediaType == "text/xml")
+}
+
+// decodeXMLReceipt is decodeReceipt for an XML receipt document.
+func decodeXMLReceipt(w http.ResponseWriter, body []byte, endpoint string, rs services.Ruleset) (model.Receipt, bool) {
+	receipt, err := model.DecodeReceiptXML(body)
+	if err != nil {
+		message := "Invalid XML data"
+		switch {
+		case errors.Is(err, model.ErrInvalidXML):
+			message = "Invalid XML format"
+		case errors.Is(err, model.ErrUnknownFields):
+			message = "Incorrect Receipt data"
+		}
+		logger.Error("Failed to decode XML receipt", logrus.Fields{
 			"error":    err,
-			"endpoint": "/process",
+			"endpoint": endpoint,
 		})
-		utility.WriteError(w, "Incorrect Receipt data", http.StatusBadRequest)
-		return
+		utility.WriteError(w, message, http.StatusBadRequest)
+		return model.Receipt{}, false
 	}
+	return receipt, validateReceipt(w, receipt, endpoint, rs)
+}
+
+// TextParseError is the response to a text/plain receipt that could not be
+// parsed, listing each problem with its line number.
+type TextParseError struct {
+	Error  string             `json:"error"`
+	Errors ingest.ParseErrors `json:"errors"`
+}
 
-	if err := utility.ParseJSON(body, &receipt); err != nil {
-		logger.Error("Failed to parse receipt JSON", logrus.Fields{
+// isTextBody reports whether the request body is a plain-text receipt.
+func isTextBody(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "text/plain"
+}
+
+// decodeTextReceipt is decodeReceipt for the text of a printed receipt.
+func decodeTextReceipt(w http.ResponseWriter, body []byte, endpoint string, rs services.Ruleset) (model.Receipt, bool) {
+	receipt, err := ingest.ParseText(string(body))
+	if err != nil {
+		logger.Error("Failed to parse receipt text", logrus.Fields{
 			"error":    err,
-			"endpoint": "/process",
+			"endpoint": endpoint,
 		})
-		utility.WriteError(w, "Invalid JSON data", http.StatusBadRequest)
-		return
+		var errs ingest.ParseErrors
+		if !errors.As(err, &errs) {
+			errs = ingest.ParseErrors{{Message: err.Error()}}
+		}
+		utility.WriteJSONWithStatus(w, TextParseError{Error: "Unparsable receipt text", Errors: errs}, http.StatusBadRequest)
+		return model.Receipt{}, false
 	}
+	return receipt, validateReceipt(w, receipt, endpoint, rs)
+}
 
-	if err := receipt.Validate(); err != nil {
+// validateReceipt validates a decoded receipt. It writes the error response
+// and returns false when the receipt is invalid.
+func validateReceipt(w http.ResponseWriter, receipt model.Receipt, endpoint string, rs services.Ruleset) bool {
+	if err := services.ValidateReceipt(receipt, rs); err != nil {
 		logger.Error("Receipt validation failed", logrus.Fields{
 			"error":    err,
-			"endpoint": "/process",
+			"endpoint": endpoint,
 			"receipt":  receipt,
 		})
 		utility.WriteError(w, "Validation error", http.StatusBadRequest)
-		return
-	}
-
-	// Process receipt hash and check existence
-	receiptHash := services.GenerateHash(receipt)
-	if id, exists := services.CheckReceipt(receiptHash); exists {
-		logger.Info("Receipt already processed", logrus.Fields{
-			"id":       id,
-			"endpoint": "/process",
-		})
-		utility.WriteJSON(w, map[string]string{"id": id})
-		return
+		return false
 	}
-
-	// Generate ID, calculate points, and store receipt
-	id := utility.GenerateID()
-	points, explanation := services.CalculatePoints(receipt)
-	services.StoreReceipt(id, receiptHash, points, explanation)
-
-	logger.Info("Receipt processed successfully", logrus.Fields{
-		"id":       id,
-		"points":   points,
-		"endpoint": "/process",
-	})
-	utility.WriteJSON(w, map[string]string{"id": id})
+	return true
 }
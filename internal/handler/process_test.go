@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"receipt-processor/internal/model"
+	"receipt-processor/internal/services"
+	"strings"
 	"testing"
 )
 
@@ -37,7 +39,7 @@ func (m *MockServices) GenerateHash(receipt model.Receipt) string {
 	return "receipt-hash"
 }
 
-func (m *MockServices) CheckReceipt(hash string) (string, bool) {
+func (m *MockServices) CheckReceipt(tenant, hash string) (string, bool) {
 	return "", false
 }
 
@@ -45,7 +47,7 @@ func (m *MockServices) CalculatePoints(receipt model.Receipt) (int, string) {
 	return 109, "Points breakdown explanation"
 }
 
-func (m *MockServices) StoreReceipt(id, hash string, points int, explanation string) {}
+func (m *MockServices) StoreReceipt(tenant, id, hash string, details model.ReceiptDetails) {}
 
 func (m *MockServices) GenerateID() string {
 	return "unique-id"
@@ -94,7 +96,7 @@ func ProcessReceiptWithMocks(
 	}
 
 	receiptHash := services.GenerateHash(receipt)
-	if id, exists := services.CheckReceipt(receiptHash); exists {
+	if id, exists := services.CheckReceipt("default", receiptHash); exists {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`{"id":"` + id + `"}`))
 		return
@@ -102,8 +104,94 @@ func ProcessReceiptWithMocks(
 
 	id := services.GenerateID()
 	points, explanation := services.CalculatePoints(receipt)
-	services.StoreReceipt(id, receiptHash, points, explanation)
+	services.StoreReceipt("default", id, receiptHash, model.ReceiptDetails{Points: points, Explanation: explanation})
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"id":"` + id + `"}`))
 }
+
+// Test ProcessReceipt rejects bodies over the configured limit
+func TestProcessReceipt_BodyTooLarge(t *testing.T) {
+	body := `{"retailer": "` + strings.Repeat("A", 2048) + `"}`
+	req, err := http.NewRequest("POST", "/receipts/process", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	req.Body = http.MaxBytesReader(rr, req.Body, 1024)
+
+	ProcessReceipt(rr, req)
+
+	if status := rr.Code; status != http.StatusRequestEntityTooLarge {
+		t.Errorf("ProcessReceipt handler returned wrong status code: got %v want %v", status, http.StatusRequestEntityTooLarge)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("ProcessReceipt handler returned wrong Content-Type: got %v want application/json", contentType)
+	}
+}
+
+// Test ProcessReceipt accepts the text of a printed receipt
+func TestProcessReceipt_Text(t *testing.T) {
+	services.ResetStore()
+	defer services.ResetStore()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/receipts/process", strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/plain")
+		rr := httptest.NewRecorder()
+		ProcessReceipt(rr, req)
+		return rr
+	}
+
+	rr := post("Target\n01/01/2022 1:01 PM\nMountain Dew 12PK   6.49\nTOTAL   6.49\n")
+	var created map[string]string
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &created) != nil || created["id"] == "" {
+		t.Fatalf("expected the text receipt to be processed; got %d: %s", rr.Code, rr.Body.String())
+	}
+	if points, _, ok := services.GetReceiptPoints(services.DefaultTenant, created["id"], false); !ok || points != 6+6 {
+		t.Errorf("expected the parsed receipt to score %d points; got %d", 6+6, points)
+	}
+
+	// Parse errors point at lines
+	rr = post("Target\n01/01/2022 25:01\nMountain Dew 12PK   6.49\n")
+	var parseErr TextParseError
+	if rr.Code != http.StatusBadRequest || json.Unmarshal(rr.Body.Bytes(), &parseErr) != nil {
+		t.Fatalf("expected 400 with parse errors; got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(parseErr.Errors) == 0 || parseErr.Errors[0].Line != 2 {
+		t.Errorf("expected the first error on line 2; got %+v", parseErr.Errors)
+	}
+}
+
+// Test ProcessReceipt accepts XML receipts
+func TestProcessReceipt_XML(t *testing.T) {
+	services.ResetStore()
+	defer services.ResetStore()
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/receipts/process", strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+		rr := httptest.NewRecorder()
+		ProcessReceipt(rr, req)
+		return rr
+	}
+
+	rr := post(cornerMarketXML)
+	var created map[string]string
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &created) != nil || created["id"] == "" {
+		t.Fatalf("expected the XML receipt to be processed; got %d: %s", rr.Code, rr.Body.String())
+	}
+	if points, _, ok := services.GetReceiptPoints(services.DefaultTenant, created["id"], false); !ok || points != 109 {
+		t.Errorf("expected the XML receipt to score 109 points; got %d", points)
+	}
+
+	for body, want := range map[string]string{
+		"<receipt><retailer>Target":                      "Invalid XML format",
+		"<receipt><extra>1</extra></receipt>":            "Incorrect Receipt data",
+		"<receipt><retailer>Target</retailer></receipt>": "Validation error",
+	} {
+		if rr := post(body); rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("%s: expected 400 %q; got %d: %s", body, want, rr.Code, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/xml"
+	"net/http"
+	"receipt-processor/internal/ingest"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/services"
+	"receipt-processor/internal/tenant"
+	"receipt-processor/internal/utility"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// ReceiptResponse is the body of /{id}: a stored receipt with its points.
+// Explanation is only set for detailed requests. Receipt is nil for receipts
+// stored before receipts were kept.
+type ReceiptResponse struct {
+	XMLName     xml.Name       `json:"-" xml:"storedReceipt"`
+	ID          string         `json:"id" xml:"id"`
+	Points      int            `json:"points" xml:"points"`
+	Explanation *string        `json:"explanation,omitempty" xml:"explanation,omitempty"`
+	Promotions  []string       `json:"promotions,omitempty" xml:"promotions>promotion,omitempty"`
+	SubmittedBy string         `json:"submittedBy,omitempty" xml:"submittedBy,omitempty"`
+	Receipt     *model.Receipt `json:"receipt,omitempty" xml:"receipt,omitempty"`
+}
+
+// CSVHeader uses the CSV import columns, so a download can be imported again,
+// followed by points.
+func (r ReceiptResponse) CSVHeader() []string {
+	return append(ingest.CSVHeader(), "points")
+}
+
+// CSVRows writes one row per item with the receipt ID in the receipt column.
+func (r ReceiptResponse) CSVRows() [][]string {
+	points := strconv.Itoa(r.Points)
+	if r.Receipt == nil {
+		row := make([]string, len(ingest.CSVHeader()))
+		row[0] = r.ID
+		return [][]string{append(row, points)}
+	}
+	rows := ingest.CSVRows(r.ID, *r.Receipt)
+	for i := range rows {
+		rows[i] = append(rows[i], points)
+	}
+	return rows
+}
+
+// GetReceipt handles GET requests on the /{id} endpoint, returning a stored
+// receipt as JSON, XML or CSV per the Accept header.
+func GetReceipt(w http.ResponseWriter, r *http.Request) {
+	mediaType, ok := negotiate(w, r, "/{id}")
+	if !ok {
+		return
+	}
+	id := mux.Vars(r)["id"]
+	tenantID := tenant.FromContext(r.Context())
+	details, ok := services.GetReceipt(tenantID, id)
+	if !ok {
+		logger.Error("Invalid receipt ID", logrus.Fields{
+			"tenant":     tenantID,
+			"receipt_id": id,
+			"endpoint":   "/{id}",
+		})
+		utility.WriteFormattedError(w, mediaType, "Incorrect receipt ID", http.StatusNotFound)
+		return
+	}
+
+	response := ReceiptResponse{
+		ID:          id,
+		Points:      details.Points,
+		Promotions:  details.Promotions,
+		SubmittedBy: details.SubmittedBy,
+		Receipt:     details.Receipt,
+	}
+	if r.URL.Query().Get("detailed") == "true" {
+		response.Explanation = &details.Explanation
+	}
+
+	logger.Info("Receipt retrieved successfully", logrus.Fields{
+		"receipt_id": id,
+		"media_type": mediaType,
+		"endpoint":   "/{id}",
+	})
+	utility.WriteFormatted(w, mediaType, response, http.StatusOK)
+}
@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"receipt-processor/internal/ingest"
+	"receipt-processor/internal/services"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+const cornerMarketXML = `<?xml version="1.0" encoding="UTF-8"?>
+<receipt>
+  <retailer>M&amp;M Corner Market</retailer>
+  <purchaseDate>2022-03-20</purchaseDate>
+  <purchaseTime>14:33</purchaseTime>
+  <items>
+    <item><shortDescription>Gatorade</shortDescription><price>2.25</price></item>
+    <item><shortDescription>Gatorade</shortDescription><price>2.25</price></item>
+    <item><shortDescription>Gatorade</shortDescription><price>2.25</price></item>
+    <item><shortDescription>Gatorade</shortDescription><price>2.25</price></item>
+  </items>
+  <total>9.00</total>
+</receipt>`
+
+// getNegotiated calls a GET handler for the receipt id with an Accept header.
+func getNegotiated(h http.HandlerFunc, path, id, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	req = mux.SetURLVars(req, map[string]string{"id": id})
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rr := httptest.NewRecorder()
+	h(rr, req)
+	return rr
+}
+
+func TestGetPoints_Negotiation(t *testing.T) {
+	services.ResetStore()
+	defer services.ResetStore()
+	req := httptest.NewRequest("POST", "/receipts/process", strings.NewReader(cornerMarketXML))
+	req.Header.Set("Content-Type", "application/xml")
+	rr := httptest.NewRecorder()
+	ProcessReceipt(rr, req)
+	var created map[string]string
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	id := created["id"]
+
+	rr = getNegotiated(GetPoints, "/receipts/"+id+"/points?detailed=true", id, "application/xml")
+	var points PointsResponse
+	if rr.Code != http.StatusOK || xml.Unmarshal(rr.Body.Bytes(), &points) != nil || points.Points != 109 || points.Explanation == nil {
+		t.Errorf("expected XML points; got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = getNegotiated(GetPoints, "/receipts/"+id+"/points", id, "text/csv")
+	if rr.Code != http.StatusOK || rr.Body.String() != "points\n109\n" {
+		t.Errorf("expected CSV points; got %d: %q", rr.Code, rr.Body.String())
+	}
+
+	rr = getNegotiated(GetPoints, "/receipts/"+id+"/points", id, "image/png")
+	if rr.Code != http.StatusNotAcceptable {
+		t.Errorf("expected 406 for an unsupported type; got %d", rr.Code)
+	}
+
+	rr = getNegotiated(GetPoints, "/receipts/nope/points", "nope", "application/xml")
+	if rr.Code != http.StatusNotFound || !strings.Contains(rr.Body.String(), "<error>Incorrect receipt ID</error>") {
+		t.Errorf("expected an XML 404; got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestGetReceipt(t *testing.T) {
+	services.ResetStore()
+	defer services.ResetStore()
+	req := httptest.NewRequest("POST", "/receipts/process", strings.NewReader(cornerMarketXML))
+	req.Header.Set("Content-Type", "application/xml")
+	rr := httptest.NewRecorder()
+	ProcessReceipt(rr, req)
+	var created map[string]string
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	id := created["id"]
+
+	// The three formats carry the same fields
+	rr = getNegotiated(GetReceipt, "/receipts/"+id, id, "")
+	var fromJSON ReceiptResponse
+	if rr.Code != http.StatusOK || json.Unmarshal(rr.Body.Bytes(), &fromJSON) != nil {
+		t.Fatalf("expected a JSON receipt; got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = getNegotiated(GetReceipt, "/receipts/"+id, id, "application/xml")
+	var fromXML ReceiptResponse
+	if rr.Code != http.StatusOK || xml.Unmarshal(rr.Body.Bytes(), &fromXML) != nil {
+		t.Fatalf("expected an XML receipt; got %d: %s", rr.Code, rr.Body.String())
+	}
+	if fromJSON.ID != id || fromJSON.Points != 109 || fromJSON.Receipt == nil || fromXML.Receipt == nil ||
+		fromJSON.Receipt.String() != fromXML.Receipt.String() || fromXML.Points != 109 {
+		t.Errorf("expected matching JSON and XML receipts; got %+v and %+v", fromJSON, fromXML)
+	}
+
+	// The CSV download can be imported again
+	rr = getNegotiated(GetReceipt, "/receipts/"+id, id, "text/csv")
+	rows, err := csv.NewReader(strings.NewReader(rr.Body.String())).ReadAll()
+	if rr.Code != http.StatusOK || err != nil || len(rows) != 5 || rows[1][0] != id || rows[1][len(rows[1])-1] != "109" {
+		t.Fatalf("expected a CSV row per item; got %d: %s", rr.Code, rr.Body.String())
+	}
+	parsed, err := ingest.ParseCSV(strings.NewReader(rr.Body.String()), ingest.DefaultCSVColumns())
+	if err != nil || len(parsed) != 1 || parsed[0].Receipt.String() != fromJSON.Receipt.String() {
+		t.Errorf("expected the CSV to parse back to the receipt; got %+v, %v", parsed, err)
+	}
+
+	if rr := getNegotiated(GetReceipt, "/receipts/nope", "nope", "text/csv"); rr.Code != http.StatusNotFound || rr.Body.String() != "error\nIncorrect receipt ID\n" {
+		t.Errorf("expected a CSV 404; got %d: %q", rr.Code, rr.Body.String())
+	}
+}
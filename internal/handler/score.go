@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/services"
+	"receipt-processor/internal/tenant"
+	"receipt-processor/internal/utility"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ScoreRequest is the optional envelope accepted by /receipts/score. A bare
+// receipt is also accepted.
+type ScoreRequest struct {
+	Receipt        json.RawMessage `json:"receipt"`
+	CompareVersion string          `json:"compareVersion,omitempty"`
+	CompareRuleset json.RawMessage `json:"compareRuleset,omitempty"`
+}
+
+// ScoreResponse is the outcome of a what-if scoring request.
+type ScoreResponse struct {
+	Ruleset    string                `json:"ruleset"`
+	Points     int                   `json:"points"`
+	Breakdown  []services.RuleResult `json:"breakdown"`
+	Comparison *ScoreComparison      `json:"comparison,omitempty"`
+}
+
+// ScoreComparison is the same receipt scored with a second ruleset. Delta is
+// the comparison's points minus the active ruleset's points.
+type ScoreComparison struct {
+	Ruleset   string                `json:"ruleset"`
+	Points    int                   `json:"points"`
+	Breakdown []services.RuleResult `json:"breakdown"`
+	Delta     int                   `json:"delta"`
+}
+
+// ScoreReceipt handles POST requests on the /score endpoint. It validates and
+// scores a receipt with the caller's active ruleset like /process, but stores
+// nothing and does not check for duplicates. The receipt may be compared with
+// a previously active ruleset version (compareVersion, also accepted as a
+// query parameter) or an inline ruleset (compareRuleset).
+func ScoreReceipt(w http.ResponseWriter, r *http.Request) {
+	body, ok := readRequestBody(w, r, "/score")
+	if !ok {
+		return
+	}
+
+	request := ScoreRequest{Receipt: body}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) == nil && fields["receipt"] != nil {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&request); err != nil {
+			logger.Error("Failed to decode score request", logrus.Fields{
+				"error":    err,
+				"endpoint": "/score",
+			})
+			utility.WriteError(w, "Incorrect score request", http.StatusBadRequest)
+			return
+		}
+	}
+	if version := r.URL.Query().Get("compareVersion"); version != "" {
+		request.CompareVersion = version
+	}
+
+	tenantID := tenant.FromContext(r.Context())
+	active := services.RulesetFor(tenantID)
+	receipt, ok := decodeReceipt(w, request.Receipt, "/score", active)
+	if !ok {
+		return
+	}
+
+	var compare *services.Ruleset
+	switch {
+	case request.CompareVersion != "" && len(request.CompareRuleset) > 0:
+		utility.WriteError(w, "Use either compareVersion or compareRuleset, not both", http.StatusBadRequest)
+		return
+	case request.CompareVersion != "":
+		rs, found := services.RulesetVersion(tenantID, request.CompareVersion)
+		if !found {
+			utility.WriteError(w, "Unknown ruleset version", http.StatusBadRequest)
+			return
+		}
+		compare = &rs
+	case len(request.CompareRuleset) > 0:
+		rs, err := services.ParseRuleset(request.CompareRuleset)
+		if err != nil {
+			logger.Error("Invalid comparison ruleset", logrus.Fields{
+				"error":    err,
+				"endpoint": "/score",
+			})
+			utility.WriteError(w, "Invalid ruleset: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if rs.Version == "" {
+			rs.Version = "inline"
+		}
+		compare = &rs
+	}
+
+	history := services.CustomerHistoryFor(tenantID)
+	score := services.ScoreReceiptFor(receipt, active, history)
+	response := ScoreResponse{
+		Ruleset:   active.Version,
+		Points:    score.Points,
+		Breakdown: score.Breakdown,
+	}
+	if compare != nil {
+		compared := services.ScoreReceiptFor(receipt, *compare, history)
+		response.Comparison = &ScoreComparison{
+			Ruleset:   compare.Version,
+			Points:    compared.Points,
+			Breakdown: compared.Breakdown,
+			Delta:     compared.Points - score.Points,
+		}
+	}
+
+	logger.Info("Receipt scored without storing", logrus.Fields{
+		"tenant":   tenantID,
+		"points":   score.Points,
+		"ruleset":  active.Version,
+		"endpoint": "/score",
+	})
+	utility.WriteJSON(w, response)
+}
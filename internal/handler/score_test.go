@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"receipt-processor/internal/services"
+	"receipt-processor/internal/tenant"
+	"strings"
+	"testing"
+)
+
+const scoreTestReceipt = `{
+	"retailer": "Target",
+	"purchaseDate": "2022-01-01",
+	"purchaseTime": "13:01",
+	"items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}],
+	"total": "6.49"
+}`
+
+func postScore(t *testing.T, target, body string) (*httptest.ResponseRecorder, ScoreResponse) {
+	t.Helper()
+	req := httptest.NewRequest("POST", target, strings.NewReader(body))
+	req = req.WithContext(tenant.WithTenant(req.Context(), "score-test"))
+	rr := httptest.NewRecorder()
+	ScoreReceipt(rr, req)
+	var resp ScoreResponse
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rr, resp
+}
+
+func TestScoreReceipt_DoesNotStore(t *testing.T) {
+	rr, resp := postScore(t, "/receipts/score", scoreTestReceipt)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200; got %d: %s", rr.Code, rr.Body.String())
+	}
+	// 6 retailer characters + 6 for the odd day
+	if resp.Points != 12 || len(resp.Breakdown) == 0 || resp.Comparison != nil {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	if list := services.ListStoredReceipts("score-test"); len(list) != 0 {
+		t.Errorf("expected nothing to be stored; got %d receipts", len(list))
+	}
+
+	// Scoring again is not a duplicate
+	if rr, _ := postScore(t, "/receipts/score", scoreTestReceipt); rr.Code != http.StatusOK {
+		t.Errorf("expected a repeat to be scored again; got %d", rr.Code)
+	}
+}
+
+func TestScoreReceipt_Compare(t *testing.T) {
+	body := `{"receipt": ` + scoreTestReceipt + `, "compareRuleset": {"version": "double-odd", "oddDayPoints": 12}}`
+	rr, resp := postScore(t, "/receipts/score", body)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200; got %d: %s", rr.Code, rr.Body.String())
+	}
+	if resp.Comparison == nil || resp.Comparison.Ruleset != "double-odd" || resp.Comparison.Delta != 6 {
+		t.Errorf("unexpected comparison: %+v", resp.Comparison)
+	}
+
+	rr, resp = postScore(t, "/receipts/score?compareVersion=builtin", scoreTestReceipt)
+	if rr.Code != http.StatusOK || resp.Comparison == nil || resp.Comparison.Delta != 0 {
+		t.Errorf("expected a comparison with the builtin ruleset; got %d %+v", rr.Code, resp.Comparison)
+	}
+
+	// Another tenant's ruleset versions cannot be compared against
+	defer services.SetRulesets(&services.RulesetSet{Default: services.DefaultRuleset()})
+	other := services.DefaultRuleset()
+	other.Version = "other-v1"
+	services.SetRulesets(&services.RulesetSet{Default: services.DefaultRuleset(), Tenants: map[string]services.Ruleset{"other": other}})
+	if rr, _ := postScore(t, "/receipts/score?compareVersion=other-v1", scoreTestReceipt); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected another tenant's version to be unknown; got %d", rr.Code)
+	}
+}
+
+func TestScoreReceipt_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		body   string
+	}{
+		{"invalid receipt", "/receipts/score", `{"retailer": "Target"}`},
+		{"unknown envelope field", "/receipts/score", `{"receipt": ` + scoreTestReceipt + `, "extra": 1}`},
+		{"unknown version", "/receipts/score?compareVersion=nope", scoreTestReceipt},
+		{"invalid ruleset", "/receipts/score", `{"receipt": ` + scoreTestReceipt + `, "compareRuleset": {"descriptionLengthMultiple": 0}}`},
+		{"unknown ruleset field", "/receipts/score", `{"receipt": ` + scoreTestReceipt + `, "compareRuleset": {"oddDay": 1}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rr, _ := postScore(t, tt.target, tt.body); rr.Code != http.StatusBadRequest {
+				t.Errorf("expected 400; got %d: %s", rr.Code, rr.Body.String())
+			}
+		})
+	}
+}
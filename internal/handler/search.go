@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/services"
+	"receipt-processor/internal/tenant"
+	"receipt-processor/internal/utility"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ReceiptList is the body of GET /receipts.
+type ReceiptList struct {
+	Receipts   []ReceiptResponse `json:"receipts"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+// ListReceipts handles GET requests on /receipts. It returns a page of the
+// caller's receipts filtered by the retailer, customerId, from, to, currency,
+// minTotal, maxTotal, minPoints and maxPoints query parameters, ordered by
+// sort (date, points or total) and order (desc by default). The tenant
+// parameter picks another tenant under the same rules as the X-Tenant-ID
+// header.
+func ListReceipts(w http.ResponseWriter, r *http.Request) {
+	tenantID := tenant.FromContext(r.Context())
+	if requested := r.URL.Query().Get("tenant"); requested != "" {
+		resolved, err := tenant.ResolveRequested(r.Context(), requested)
+		if err != nil {
+			status := http.StatusBadRequest
+			var resolveErr *tenant.ResolveError
+			if errors.As(err, &resolveErr) {
+				status = resolveErr.Status
+			}
+			logger.Warn("Rejected request for tenant", logrus.Fields{
+				"tenant":   requested,
+				"error":    err,
+				"endpoint": "/receipts",
+			})
+			utility.WriteError(w, err.Error(), status)
+			return
+		}
+		tenantID = resolved
+	}
+
+	q, err := parseReceiptQuery(r)
+	if err != nil {
+		logger.Error("Invalid receipt query", logrus.Fields{
+			"error":    err,
+			"endpoint": "/receipts",
+		})
+		utility.WriteError(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := services.ListReceipts(tenantID, q)
+	if err != nil {
+		logger.Error("Invalid receipt cursor", logrus.Fields{
+			"tenant":   tenantID,
+			"error":    err,
+			"endpoint": "/receipts",
+		})
+		utility.WriteError(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+
+	response := ReceiptList{Receipts: []ReceiptResponse{}, NextCursor: page.NextCursor}
+	for _, listed := range page.Receipts {
+		response.Receipts = append(response.Receipts, ReceiptResponse{
+			ID:          listed.ID,
+			Points:      listed.Points,
+			Promotions:  listed.Promotions,
+			SubmittedBy: listed.SubmittedBy,
+			Receipt:     listed.Receipt,
+		})
+	}
+
+	logger.Info("Receipts listed", logrus.Fields{
+		"tenant":   tenantID,
+		"receipts": len(response.Receipts),
+		"endpoint": "/receipts",
+	})
+	utility.WriteJSON(w, response)
+}
+
+// parseReceiptQuery reads a services.ReceiptQuery from the query parameters of
+// r, failing on the first invalid parameter.
+func parseReceiptQuery(r *http.Request) (services.ReceiptQuery, error) {
+	params := r.URL.Query()
+	q := services.ReceiptQuery{
+		Retailer:   params.Get("retailer"),
+		CustomerID: params.Get("customerId"),
+		From:       params.Get("from"),
+		To:         params.Get("to"),
+		Currency:   params.Get("currency"),
+		Sort:       params.Get("sort"),
+		Cursor:     params.Get("cursor"),
+	}
+
+	for _, name := range []string{"from", "to"} {
+		if date := params.Get(name); date != "" {
+			if _, err := time.Parse("2006-01-02", date); err != nil {
+				return q, errors.New(name + " must be a date in YYYY-MM-DD format")
+			}
+		}
+	}
+	if q.Currency != "" && !utility.IsValidCurrency(q.Currency) {
+		return q, errors.New("currency must be an ISO 4217 code")
+	}
+	for _, bound := range []struct {
+		name   string
+		target **int64
+	}{{"minTotal", &q.MinTotal}, {"maxTotal", &q.MaxTotal}} {
+		if value := params.Get(bound.name); value != "" {
+			amount, ok := services.ParseAmount(value)
+			if !ok {
+				return q, errors.New(bound.name + " must be a non-negative amount")
+			}
+			*bound.target = &amount
+		}
+	}
+	if (q.MinTotal != nil || q.MaxTotal != nil) && q.Currency == "" {
+		return q, services.ErrTotalNeedsCurrency
+	}
+	for _, bound := range []struct {
+		name   string
+		target **int
+	}{{"minPoints", &q.MinPoints}, {"maxPoints", &q.MaxPoints}} {
+		if value := params.Get(bound.name); value != "" {
+			points, err := strconv.Atoi(value)
+			if err != nil {
+				return q, errors.New(bound.name + " must be an integer")
+			}
+			*bound.target = &points
+		}
+	}
+
+	switch q.Sort {
+	case "", services.SortDate, services.SortPoints, services.SortTotal:
+	default:
+		return q, errors.New("sort must be date, points or total")
+	}
+	switch params.Get("order") {
+	case "", "desc":
+		q.Descending = true
+	case "asc":
+	default:
+		return q, errors.New("order must be asc or desc")
+	}
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return q, errors.New("limit must be a positive integer")
+		}
+		q.Limit = limit
+	}
+	return q, nil
+}
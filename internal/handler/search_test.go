@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"receipt-processor/internal/auth"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/services"
+	"receipt-processor/internal/tenant"
+	"testing"
+)
+
+func TestListReceipts(t *testing.T) {
+	services.ResetStore()
+	defer services.ResetStore()
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("r%d", i)
+		receipt := model.Receipt{
+			Retailer:     []string{"Target", "Walgreens"}[i%2],
+			PurchaseDate: fmt.Sprintf("2022-01-0%d", i+1),
+			PurchaseTime: "12:00",
+			Total:        fmt.Sprintf("%d.00", 10*(i+1)),
+		}
+		if i == 2 {
+			receipt.Currency = "EUR"
+		}
+		services.StoreReceipt("list-test", id, id, model.ReceiptDetails{Points: 100 - i, Receipt: &receipt})
+	}
+
+	list := func(target string, key *auth.Key) (*httptest.ResponseRecorder, ReceiptList) {
+		t.Helper()
+		req := httptest.NewRequest("GET", target, nil)
+		ctx := tenant.WithTenant(req.Context(), "list-test")
+		if key != nil {
+			ctx = auth.WithKey(ctx, *key)
+		}
+		rr := httptest.NewRecorder()
+		ListReceipts(rr, req.WithContext(ctx))
+		var resp ReceiptList
+		if rr.Code == http.StatusOK {
+			if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return rr, resp
+	}
+	ids := func(resp ReceiptList) string {
+		var ids []string
+		for _, r := range resp.Receipts {
+			ids = append(ids, r.ID)
+		}
+		return fmt.Sprint(ids)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "[r4 r3 r2 r1 r0]"},
+		{"order=asc&sort=points", "[r4 r3 r2 r1 r0]"},
+		{"sort=total&order=asc&currency=USD&minTotal=20&maxTotal=40.00", "[r1 r3]"},
+		{"currency=EUR", "[r2]"},
+		{"retailer=target&from=2022-01-02", "[r4 r2]"},
+		{"minPoints=97&maxPoints=98", "[r3 r2]"},
+		{"customerId=nobody", "[]"},
+	}
+	for _, tt := range tests {
+		rr, resp := list("/receipts?"+tt.query, nil)
+		if rr.Code != http.StatusOK || ids(resp) != tt.want {
+			t.Errorf("%s: expected %s; got %d: %s", tt.query, tt.want, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Following the cursors returns every receipt once
+	_, first := list("/receipts?limit=2&order=asc", nil)
+	_, second := list("/receipts?limit=2&order=asc&cursor="+url.QueryEscape(first.NextCursor), nil)
+	_, last := list("/receipts?limit=2&order=asc&cursor="+url.QueryEscape(second.NextCursor), nil)
+	if ids(first) != "[r0 r1]" || ids(second) != "[r2 r3]" || ids(last) != "[r4]" || last.NextCursor != "" {
+		t.Errorf("unexpected pages %s %s %s", ids(first), ids(second), ids(last))
+	}
+	if first.Receipts[0].Receipt.Retailer != "Target" || first.Receipts[0].Points != 100 || first.Receipts[0].Explanation != nil {
+		t.Errorf("unexpected listed receipt %+v", first.Receipts[0])
+	}
+
+	for _, query := range []string{
+		"from=2022-13-01", "minTotal=-1", "maxTotal=40", "currency=usd", "maxPoints=many", "sort=retailer", "order=up", "limit=0",
+		"cursor=bogus", "cursor=" + url.QueryEscape(first.NextCursor), // issued for ascending dates
+	} {
+		if rr, _ := list("/receipts?"+query, nil); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400; got %d", query, rr.Code)
+		}
+	}
+
+	// The tenant parameter follows the X-Tenant-ID rules
+	if _, resp := list("/receipts?tenant=other", nil); ids(resp) != "[]" {
+		t.Errorf("expected no receipts for another tenant; got %s", ids(resp))
+	}
+	reader := &auth.Key{ID: "reader", Scopes: []string{auth.ScopeReceiptsRead}}
+	if rr, _ := list("/receipts?tenant=other", reader); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a key without the admin scope; got %d", rr.Code)
+	}
+	if rr, _ := list("/receipts?tenant=not+a+tenant", nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid tenant; got %d", rr.Code)
+	}
+}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"net/http"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/services"
+	"receipt-processor/internal/tenant"
+	"receipt-processor/internal/utility"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ListStores handles GET requests on /stores. It aggregates the caller's
+// receipts by store, optionally filtered by the storeId, retailer, region and
+// postalCode query parameters.
+func ListStores(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := services.StoreFilter{
+		StoreID:    query.Get("storeId"),
+		Retailer:   query.Get("retailer"),
+		Region:     query.Get("region"),
+		PostalCode: query.Get("postalCode"),
+	}
+
+	tenantID := tenant.FromContext(r.Context())
+	stats := services.StoreStats(tenantID, filter)
+
+	logger.Info("Store statistics retrieved", logrus.Fields{
+		"tenant":   tenantID,
+		"stores":   len(stats),
+		"endpoint": "/stores",
+	})
+	utility.WriteJSON(w, map[string]interface{}{"stores": stats})
+}
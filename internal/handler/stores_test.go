@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/services"
+	"receipt-processor/internal/tenant"
+	"testing"
+)
+
+func TestListStores(t *testing.T) {
+	services.ResetStore()
+	defer services.ResetStore()
+
+	store := func(id, region string) *model.Store { return &model.Store{ID: id, Region: region} }
+	for i, r := range []struct {
+		store  *model.Store
+		points int
+	}{
+		{store("101", "US-IL"), 10},
+		{store("101", "US-IL"), 30},
+		{store("s-202", "US-WI"), 5},
+		{store("S-202", "US-WI"), 15}, // the same store with a differently cased ID
+		{nil, 100},
+	} {
+		receipt := model.Receipt{Retailer: "Target", PurchaseDate: "2022-01-0" + string(rune('1'+i)), Store: r.store}
+		id := "r" + string(rune('1'+i))
+		services.StoreReceipt("stores-test", id, id, model.ReceiptDetails{Points: r.points, Receipt: &receipt})
+	}
+
+	get := func(target string) []services.StoreStat {
+		t.Helper()
+		req := httptest.NewRequest("GET", target, nil)
+		req = req.WithContext(tenant.WithTenant(req.Context(), "stores-test"))
+		rr := httptest.NewRecorder()
+		ListStores(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200; got %d: %s", rr.Code, rr.Body.String())
+		}
+		var resp struct {
+			Stores []services.StoreStat `json:"stores"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Stores
+	}
+
+	stats := get("/stores")
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 stores; got %+v", stats)
+	}
+	if s := stats[0]; s.StoreID != "101" || s.Receipts != 2 || s.Points != 40 || s.AveragePoints != 20 ||
+		s.FirstPurchase != "2022-01-01" || s.LastPurchase != "2022-01-02" {
+		t.Errorf("unexpected stats for store 101: %+v", s)
+	}
+
+	if stats := get("/stores?region=us-wi"); len(stats) != 1 || stats[0].StoreID != "S-202" || stats[0].Receipts != 2 {
+		t.Errorf("expected only store S-202 with both its receipts in US-WI; got %+v", stats)
+	}
+	if stats := get("/stores?retailer=Walgreens"); len(stats) != 0 {
+		t.Errorf("expected no stores for another retailer; got %+v", stats)
+	}
+}
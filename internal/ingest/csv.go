@@ -0,0 +1,266 @@
+package ingest
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/utility"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CSVColumns maps receipt fields to the CSV header names they are read from.
+// Fields are named as in the receipt JSON, plus "receipt" for the column that
+// groups rows into receipts.
+type CSVColumns map[string]string
+
+// Fields that may be mapped to a column. Receipt fields are read from every
+// row of a receipt and must agree; item fields make one item per row.
+var (
+	csvReceiptFields = []string{"retailer", "purchaseDate", "purchaseTime", "total", "customerId", "timezone",
+		"currency", "subtotal", "tax", "tip", "paymentMethod", "storeId"}
+	csvItemFields     = []string{"shortDescription", "price", "quantity", "unitPrice"}
+	csvRequiredFields = []string{"receipt", "retailer", "purchaseDate", "purchaseTime", "total", "shortDescription", "price"}
+)
+
+// DefaultCSVColumns reads each field from the column of the same name.
+func DefaultCSVColumns() CSVColumns {
+	columns := CSVColumns{"receipt": "receipt"}
+	for _, field := range append(csvReceiptFields, csvItemFields...) {
+		columns[field] = field
+	}
+	return columns
+}
+
+// ParseCSVColumns overlays a mapping in the form "field=header,..." on the
+// default columns, e.g. "receipt=Receipt No,retailer=Merchant".
+func ParseCSVColumns(spec string) (CSVColumns, error) {
+	return DefaultCSVColumns().Overlay(spec)
+}
+
+// Overlay returns a copy of c with the mapping in spec applied.
+func (c CSVColumns) Overlay(spec string) (CSVColumns, error) {
+	columns := CSVColumns{}
+	for field, header := range c {
+		columns[field] = header
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		field, header, ok := strings.Cut(entry, "=")
+		field, header = strings.TrimSpace(field), strings.TrimSpace(header)
+		if !ok || header == "" {
+			return nil, fmt.Errorf("invalid column mapping %q, expected field=header", entry)
+		}
+		if _, known := columns[field]; !known {
+			return nil, fmt.Errorf("unknown receipt field %q in column mapping", field)
+		}
+		columns[field] = header
+	}
+	return columns, nil
+}
+
+// String renders the mapping in the form ParseCSVColumns reads.
+func (c CSVColumns) String() string {
+	entries := make([]string, 0, len(c))
+	for field, header := range c {
+		entries = append(entries, field+"="+header)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// CSVHeader returns the default columns in the order CSVRows writes them.
+func CSVHeader() []string {
+	header := []string{"receipt"}
+	header = append(header, csvReceiptFields...)
+	return append(header, csvItemFields...)
+}
+
+// CSVRows renders a receipt as ParseCSV reads it with the default columns:
+// one row per item, each repeating key and the receipt fields. Discounts have
+// no columns and are left out.
+func CSVRows(key string, receipt model.Receipt) [][]string {
+	fields := []string{key}
+	for _, field := range csvReceiptFields {
+		fields = append(fields, *receiptField(&receipt, field))
+	}
+	rows := make([][]string, 0, len(receipt.Items))
+	for _, item := range receipt.Items {
+		row := append([]string(nil), fields...)
+		rows = append(rows, append(row, item.ShortDescription, item.Price, item.Quantity, item.UnitPrice))
+	}
+	return rows
+}
+
+// CSVReceipt is one receipt assembled from the rows sharing a receipt key.
+// Receipt is only meaningful when Errors is empty.
+type CSVReceipt struct {
+	Key     string        `json:"key"`
+	Lines   []int         `json:"lines"`
+	Receipt model.Receipt `json:"-"`
+	Errors  ParseErrors   `json:"errors,omitempty"`
+}
+
+// ParseCSV reads receipts exported one row per item. Rows are grouped by the
+// receipt column in order of first appearance; each row adds an item, and the
+// receipt fields must not differ between a receipt's rows (empty cells are
+// ignored). Cells escaped against formula injection, such as "'=1+1", are
+// read back unescaped. Row problems are reported on the receipt with their
+// line numbers.
+// The error is only for an unreadable file or a header missing a required
+// column. Receipts are not validated.
+func ParseCSV(r io.Reader, columns CSVColumns) ([]CSVReceipt, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("empty CSV file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading CSV header: %v", err)
+	}
+	index := map[string]int{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if _, seen := index[name]; !seen {
+			index[name] = i
+		}
+	}
+	position := map[string]int{}
+	var missing []string
+	for field, name := range columns {
+		if i, ok := index[strings.ToLower(name)]; ok {
+			position[field] = i
+		}
+	}
+	for _, field := range csvRequiredFields {
+		if _, ok := position[field]; !ok {
+			missing = append(missing, strconv.Quote(columns[field]))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("CSV header is missing the %s column(s)", strings.Join(missing, ", "))
+	}
+
+	var receipts []CSVReceipt
+	byKey := map[string]int{}
+	// first records the line each receipt field value was first seen on
+	first := map[string]map[string]int{}
+	var orphans ParseErrors
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !errors.As(err, &parseErr) {
+				return nil, fmt.Errorf("reading CSV: %v", err)
+			}
+			orphans = append(orphans, ParseError{Line: parseErr.Line, Message: parseErr.Err.Error()})
+			continue
+		}
+		line, _ := reader.FieldPos(0)
+		cell := func(field string) string {
+			if i, ok := position[field]; ok && i < len(row) {
+				return utility.UnescapeCSVCell(strings.TrimSpace(row[i]))
+			}
+			return ""
+		}
+
+		key := cell("receipt")
+		if key == "" {
+			if strings.TrimSpace(strings.Join(row, "")) != "" {
+				orphans = append(orphans, ParseError{Line: line, Message: "row has no " + strconv.Quote(columns["receipt"]) + " value"})
+			}
+			continue
+		}
+		i, ok := byKey[key]
+		if !ok {
+			i = len(receipts)
+			byKey[key] = i
+			receipts = append(receipts, CSVReceipt{Key: key})
+			first[key] = map[string]int{}
+		}
+		rc := &receipts[i]
+		rc.Lines = append(rc.Lines, line)
+
+		for _, field := range csvReceiptFields {
+			value := cell(field)
+			if value == "" {
+				continue
+			}
+			current := receiptField(&rc.Receipt, field)
+			if *current == "" {
+				*current = value
+				first[key][field] = line
+			} else if *current != value {
+				rc.Errors = append(rc.Errors, ParseError{Line: line, Message: fmt.Sprintf("%s %q differs from %q on line %d",
+					columns[field], value, *current, first[key][field])})
+			}
+		}
+
+		item := model.Item{
+			ShortDescription: cell("shortDescription"),
+			Price:            cell("price"),
+			Quantity:         cell("quantity"),
+			UnitPrice:        cell("unitPrice"),
+		}
+		if item.ShortDescription == "" || item.Price == "" {
+			rc.Errors = append(rc.Errors, ParseError{Line: line, Message: "item needs both " +
+				strconv.Quote(columns["shortDescription"]) + " and " + strconv.Quote(columns["price"])})
+			continue
+		}
+		rc.Receipt.Items = append(rc.Receipt.Items, item)
+	}
+
+	for i := range receipts {
+		receipts[i].Receipt.Normalize()
+	}
+	if len(orphans) > 0 {
+		receipts = append(receipts, CSVReceipt{Errors: orphans})
+	}
+	return receipts, nil
+}
+
+// receiptField returns the receipt string field a CSV receipt field is
+// stored in. storeId creates the store.
+func receiptField(receipt *model.Receipt, field string) *string {
+	switch field {
+	case "retailer":
+		return &receipt.Retailer
+	case "purchaseDate":
+		return &receipt.PurchaseDate
+	case "purchaseTime":
+		return &receipt.PurchaseTime
+	case "total":
+		return &receipt.Total
+	case "customerId":
+		return &receipt.CustomerID
+	case "timezone":
+		return &receipt.Timezone
+	case "currency":
+		return &receipt.Currency
+	case "subtotal":
+		return &receipt.Subtotal
+	case "tax":
+		return &receipt.Tax
+	case "tip":
+		return &receipt.Tip
+	case "paymentMethod":
+		return &receipt.PaymentMethod
+	case "storeId":
+		if receipt.Store == nil {
+			receipt.Store = &model.Store{}
+		}
+		return &receipt.Store.ID
+	}
+	panic("ingest: unknown receipt field " + field)
+}
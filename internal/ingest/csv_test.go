@@ -0,0 +1,83 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+)
+
+const financeCSV = `Receipt No,Merchant,Date,Time,Total,Item,Amount,Qty
+R-1,Target,2022-01-01,13:01,7.74,Mountain Dew 12PK,6.49,
+R-2,Walgreens,2022-01-02,08:13,2.65,Pepsi 12-PK,1.25,1
+R-1,Target,2022-01-01,13:01,7.74,Pepsi,1.25,
+R-2,Walgreens,2022-01-02,08:14,2.65,Dasani,1.40,
+,,,,,,,
+R-3,Shell,2022-01-03,09:00,40.00,,40.00,
+`
+
+func TestParseCSV(t *testing.T) {
+	columns, err := ParseCSVColumns("receipt=Receipt No,retailer=Merchant,purchaseDate=Date,purchaseTime=Time,total=Total," +
+		"shortDescription=Item,price=Amount,quantity=Qty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipts, err := ParseCSV(strings.NewReader(financeCSV), columns)
+	if err != nil {
+		t.Fatalf("ParseCSV() error: %v", err)
+	}
+	if len(receipts) != 3 {
+		t.Fatalf("expected 3 receipts; got %+v", receipts)
+	}
+
+	// Rows are grouped by key, in order of first appearance
+	r1 := receipts[0]
+	if r1.Key != "R-1" || len(r1.Errors) > 0 || len(r1.Receipt.Items) != 2 || r1.Lines[0] != 2 || r1.Lines[1] != 4 {
+		t.Errorf("unexpected first receipt: %+v", r1)
+	}
+	if err := r1.Receipt.Validate(); err != nil {
+		t.Errorf("expected R-1 to be valid; got %v", err)
+	}
+	if r1.Receipt.Retailer != "Target" || r1.Receipt.Total != "7.74" || r1.Receipt.Items[1].ShortDescription != "Pepsi" {
+		t.Errorf("unexpected receipt fields: %+v", r1.Receipt)
+	}
+
+	// Receipt fields that disagree between rows are row errors
+	r2 := receipts[1]
+	if len(r2.Errors) != 1 || r2.Errors[0].Line != 5 || !strings.Contains(r2.Errors[0].Message, `Time "08:14" differs from "08:13" on line 3`) {
+		t.Errorf("expected a conflicting time on line 5; got %+v", r2.Errors)
+	}
+	if r2.Receipt.Items[0].Quantity != "1" {
+		t.Errorf("expected the quantity column to be read; got %+v", r2.Receipt.Items[0])
+	}
+
+	r3 := receipts[2]
+	if len(r3.Errors) != 1 || r3.Errors[0].Line != 7 {
+		t.Errorf("expected a missing description on line 7; got %+v", r3.Errors)
+	}
+}
+
+func TestParseCSV_Unescape(t *testing.T) {
+	// Cells written by an export escaped against formula injection
+	input := "receipt,retailer,purchaseDate,purchaseTime,total,shortDescription,price\n" +
+		"R-1,'-Mart,2022-01-01,13:01,1.25,'=Pepsi,1.25\n"
+	receipts, err := ParseCSV(strings.NewReader(input), DefaultCSVColumns())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := receipts[0].Receipt; r.Retailer != "-Mart" || r.Items[0].ShortDescription != "=Pepsi" {
+		t.Errorf("expected the escaped cells to be restored; got %+v", r)
+	}
+}
+
+func TestParseCSV_Header(t *testing.T) {
+	if _, err := ParseCSV(strings.NewReader(financeCSV), DefaultCSVColumns()); err == nil || !strings.Contains(err.Error(), `"retailer"`) {
+		t.Errorf("expected the missing columns to be named; got %v", err)
+	}
+	if _, err := ParseCSV(strings.NewReader(""), DefaultCSVColumns()); err == nil {
+		t.Error("expected an empty file to be rejected")
+	}
+	for _, spec := range []string{"retailer", "shop=Merchant", "retailer="} {
+		if _, err := ParseCSVColumns(spec); err == nil {
+			t.Errorf("ParseCSVColumns(%q): expected an error", spec)
+		}
+	}
+}
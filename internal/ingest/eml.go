@@ -0,0 +1,551 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"receipt-processor/internal/model"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// maxEmailDepth bounds how deeply multipart bodies and attached messages may nest.
+const maxEmailDepth = 10
+
+// EmailTemplate describes the layout of the e-receipts sent from one domain.
+// Patterns are regular expressions matched against each line of the message
+// text (HTML bodies are converted to text first) and pick out their value
+// with a named group.
+type EmailTemplate struct {
+	// Domain is the sender domain; it also matches its subdomains
+	Domain string `json:"domain"`
+	// Retailer is used as the retailer name; when empty RetailerPattern's
+	// retailer group, then the sender's display name, is used
+	Retailer        string `json:"retailer,omitempty"`
+	RetailerPattern string `json:"retailerPattern,omitempty"`
+	// Date and Time have a date and time group. The value is parsed with
+	// DateLayout and TimeLayout (Go layouts) when set, and like a printed
+	// receipt otherwise. They default to the message's Date header.
+	Date       string `json:"date,omitempty"`
+	DateLayout string `json:"dateLayout,omitempty"`
+	Time       string `json:"time,omitempty"`
+	TimeLayout string `json:"timeLayout,omitempty"`
+	// Items are read from the lines after ItemsStart and before ItemsEnd,
+	// or from the whole message when these are empty
+	ItemsStart string `json:"itemsStart,omitempty"`
+	ItemsEnd   string `json:"itemsEnd,omitempty"`
+	// Item has description and price groups and an optional quantity group
+	Item  string `json:"item"`
+	Total string `json:"total"`
+
+	retailer, date, clock, itemsStart, itemsEnd, item, total *regexp.Regexp
+}
+
+// EmailTemplates holds the configured templates, looked up by sender domain.
+type EmailTemplates struct {
+	Templates []*EmailTemplate `json:"templates"`
+}
+
+// ParseEmailTemplates decodes and compiles a templates document. Unknown
+// fields are rejected.
+func ParseEmailTemplates(data []byte) (*EmailTemplates, error) {
+	var templates EmailTemplates
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&templates); err != nil {
+		return nil, fmt.Errorf("parsing email templates: %v", err)
+	}
+	seen := map[string]bool{}
+	for i, t := range templates.Templates {
+		t.Domain = strings.ToLower(strings.TrimSpace(t.Domain))
+		if t.Domain == "" {
+			return nil, fmt.Errorf("email template %d: domain is required", i+1)
+		}
+		if seen[t.Domain] {
+			return nil, fmt.Errorf("email template %d: duplicate domain %q", i+1, t.Domain)
+		}
+		seen[t.Domain] = true
+		if err := t.compile(); err != nil {
+			return nil, fmt.Errorf("email template for %s: %v", t.Domain, err)
+		}
+	}
+	return &templates, nil
+}
+
+// LoadEmailTemplates reads an email templates file. An empty path yields no
+// templates, so every message is parsed like a printed receipt.
+func LoadEmailTemplates(path string) (*EmailTemplates, error) {
+	if path == "" {
+		return &EmailTemplates{}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading email templates file: %v", err)
+	}
+	return ParseEmailTemplates(data)
+}
+
+// For returns the template for a sender domain, preferring the most specific
+// match, or nil when there is none.
+func (t *EmailTemplates) For(domain string) *EmailTemplate {
+	if t == nil {
+		return nil
+	}
+	domain = strings.ToLower(domain)
+	var match *EmailTemplate
+	for _, template := range t.Templates {
+		if domain != template.Domain && !strings.HasSuffix(domain, "."+template.Domain) {
+			continue
+		}
+		if match == nil || len(template.Domain) > len(match.Domain) {
+			match = template
+		}
+	}
+	return match
+}
+
+// compile compiles the patterns and checks each has the group it is read from.
+func (t *EmailTemplate) compile() error {
+	if t.Item == "" || t.Total == "" {
+		return errors.New("item and total patterns are required")
+	}
+	patterns := []struct {
+		name, pattern string
+		groups        []string
+		dst           **regexp.Regexp
+	}{
+		{"retailerPattern", t.RetailerPattern, []string{"retailer"}, &t.retailer},
+		{"date", t.Date, []string{"date"}, &t.date},
+		{"time", t.Time, []string{"time"}, &t.clock},
+		{"itemsStart", t.ItemsStart, nil, &t.itemsStart},
+		{"itemsEnd", t.ItemsEnd, nil, &t.itemsEnd},
+		{"item", t.Item, []string{"description", "price"}, &t.item},
+		{"total", t.Total, []string{"total"}, &t.total},
+	}
+	for _, p := range patterns {
+		if p.pattern == "" {
+			continue
+		}
+		re, err := regexp.Compile(p.pattern)
+		if err != nil {
+			return fmt.Errorf("%s: %v", p.name, err)
+		}
+		for _, group := range p.groups {
+			if re.SubexpIndex(group) < 0 {
+				return fmt.Errorf("%s: pattern has no (?P<%s>...) group", p.name, group)
+			}
+		}
+		*p.dst = re
+	}
+	return nil
+}
+
+// ParseEmail parses an e-receipt from an RFC 5322 message, such as a .eml
+// file. The text/plain body is preferred over text/html; quoted-printable and
+// base64 bodies and non-UTF-8 charsets are decoded. A receipt forwarded as an
+// attached message, or inline below a "Forwarded message" line, is read with
+// its original sender.
+//
+// When templates has one for the sender's domain the receipt is extracted
+// with it. Otherwise the text is parsed like a printed receipt, taking the
+// retailer from the sender's display name. Either way a missing date or time
+// comes from the Date header. Line numbers in ParseErrors count lines of the
+// message text. The result is not validated.
+func ParseEmail(r io.Reader, templates *EmailTemplates) (model.Receipt, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return model.Receipt{}, fmt.Errorf("reading email: %v", err)
+	}
+	content, err := readEmail(msg.Header, msg.Body, 0)
+	if err != nil {
+		return model.Receipt{}, err
+	}
+	for content.forwarded != nil && content.forwarded.text() != "" {
+		content = content.forwarded
+	}
+	text := content.text()
+	if text == "" {
+		return model.Receipt{}, errors.New("email has no text or HTML body")
+	}
+
+	var fallback model.Receipt
+	if date, err := content.header.Date(); err == nil {
+		fallback.PurchaseDate, fallback.PurchaseTime = date.Format("2006-01-02"), date.Format("15:04")
+	}
+	sender, _ := mail.ParseAddress(content.header.Get("From"))
+	if forward, ok := inlineForward(text); ok {
+		sender, text = forward.sender, forward.text
+		// Mail clients write the original Date in their own formats
+		if date, rest, ok, _ := findDate(forward.date); ok {
+			fallback.PurchaseDate = date
+			if purchaseTime, _, ok, _ := findTime(rest); ok {
+				fallback.PurchaseTime = purchaseTime
+			}
+		}
+	}
+	domain := ""
+	if sender != nil {
+		fallback.Retailer = strings.TrimSpace(sender.Name)
+		domain = sender.Address[strings.LastIndex(sender.Address, "@")+1:]
+	}
+
+	if template := templates.For(domain); template != nil {
+		return template.extract(text, fallback)
+	}
+	receipt, err := parseText(text, fallback)
+	if err != nil {
+		return model.Receipt{}, err
+	}
+	if fallback.Retailer != "" {
+		receipt.Retailer = fallback.Retailer
+		receipt.Normalize()
+	}
+	return receipt, nil
+}
+
+// extract reads a receipt from the message text with the template.
+func (t *EmailTemplate) extract(text string, fallback model.Receipt) (model.Receipt, error) {
+	receipt := model.Receipt{Retailer: t.Retailer}
+	var errs ParseErrors
+	fail := func(line int, message string) {
+		errs = append(errs, ParseError{Line: line, Message: message})
+	}
+
+	inItems := t.itemsStart == nil
+	for i, raw := range strings.Split(text, "\n") {
+		number := i + 1
+		line := strings.TrimSpace(spaceRegex.ReplaceAllString(raw, " "))
+		if line == "" {
+			continue
+		}
+		if receipt.Retailer == "" {
+			if value, ok := group(t.retailer, line, "retailer"); ok {
+				receipt.Retailer = value
+			}
+		}
+		if receipt.PurchaseDate == "" {
+			if value, ok := group(t.date, line, "date"); ok {
+				if date, err := parseTemplateDate(value, t.DateLayout); err != nil {
+					fail(number, err.Error())
+				} else {
+					receipt.PurchaseDate = date
+				}
+			}
+		}
+		if receipt.PurchaseTime == "" {
+			if value, ok := group(t.clock, line, "time"); ok {
+				if purchaseTime, err := parseTemplateTime(value, t.TimeLayout); err != nil {
+					fail(number, err.Error())
+				} else {
+					receipt.PurchaseTime = purchaseTime
+				}
+			}
+		}
+		if value, ok := group(t.total, line, "total"); ok {
+			if receipt.Total == "" {
+				receipt.Total = cleanAmount(value)
+			}
+			continue
+		}
+
+		switch {
+		case !inItems && t.itemsStart != nil && t.itemsStart.MatchString(line):
+			inItems = true
+		case inItems && t.itemsEnd != nil && t.itemsEnd.MatchString(line):
+			inItems = false
+		case inItems:
+			match := t.item.FindStringSubmatch(line)
+			if match == nil {
+				continue
+			}
+			item := model.Item{
+				ShortDescription: match[t.item.SubexpIndex("description")],
+				Price:            cleanAmount(match[t.item.SubexpIndex("price")]),
+			}
+			if i := t.item.SubexpIndex("quantity"); i >= 0 {
+				item.Quantity = strings.TrimSpace(match[i])
+			}
+			receipt.Items = append(receipt.Items, item)
+		}
+	}
+
+	if receipt.Retailer == "" {
+		receipt.Retailer = fallback.Retailer
+	}
+	if receipt.PurchaseDate == "" {
+		receipt.PurchaseDate = fallback.PurchaseDate
+	}
+	if receipt.PurchaseTime == "" {
+		receipt.PurchaseTime = fallback.PurchaseTime
+	}
+	if receipt.Retailer == "" {
+		fail(0, "no retailer name in the template or the sender")
+	}
+	if receipt.PurchaseDate == "" {
+		fail(0, "no purchase date found")
+	}
+	if receipt.PurchaseTime == "" {
+		fail(0, "no purchase time found")
+	}
+	if len(receipt.Items) == 0 {
+		fail(0, "no line matches the "+t.Domain+" item pattern")
+	}
+	if receipt.Total == "" {
+		fail(0, "no line matches the "+t.Domain+" total pattern")
+	}
+	if len(errs) > 0 {
+		return model.Receipt{}, errs
+	}
+	receipt.Normalize()
+	return receipt, nil
+}
+
+// group returns the named group of re's match in line.
+func group(re *regexp.Regexp, line, name string) (string, bool) {
+	if re == nil {
+		return "", false
+	}
+	match := re.FindStringSubmatch(line)
+	if match == nil {
+		return "", false
+	}
+	value := strings.TrimSpace(match[re.SubexpIndex(name)])
+	return value, value != ""
+}
+
+func parseTemplateDate(value, layout string) (string, error) {
+	if layout == "" {
+		date, _, ok, err := findDate(value)
+		if err == nil && !ok {
+			err = fmt.Errorf("no date in %q", value)
+		}
+		return date, err
+	}
+	date, err := time.Parse(layout, value)
+	if err != nil {
+		return "", fmt.Errorf("invalid date %q, expected the layout %q", value, layout)
+	}
+	return date.Format("2006-01-02"), nil
+}
+
+func parseTemplateTime(value, layout string) (string, error) {
+	if layout == "" {
+		purchaseTime, _, ok, err := findTime(value)
+		if err == nil && !ok {
+			err = fmt.Errorf("no time in %q", value)
+		}
+		return purchaseTime, err
+	}
+	purchaseTime, err := time.Parse(layout, value)
+	if err != nil {
+		return "", fmt.Errorf("invalid time %q, expected the layout %q", value, layout)
+	}
+	return purchaseTime.Format("15:04"), nil
+}
+
+// cleanAmount drops currency signs, thousands separators and spaces.
+func cleanAmount(amount string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' || r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, amount)
+}
+
+// emailContent is the readable body of a message, and of the first message
+// attached to it.
+type emailContent struct {
+	header    mail.Header
+	plain     string
+	html      string
+	forwarded *emailContent
+}
+
+// text returns the plain-text body, or the HTML body converted to text.
+func (c *emailContent) text() string {
+	if strings.TrimSpace(c.plain) != "" {
+		return c.plain
+	}
+	return htmlToText(c.html)
+}
+
+func readEmail(header mail.Header, body io.Reader, depth int) (*emailContent, error) {
+	content := &emailContent{header: header}
+	if err := content.readPart(header.Get, body, depth); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// readPart collects the first text/plain and text/html bodies of a part,
+// descending into multipart bodies and attached messages. Other attachments
+// are skipped.
+func (c *emailContent) readPart(header func(string) string, body io.Reader, depth int) error {
+	if depth > maxEmailDepth {
+		return errors.New("email parts are nested too deeply")
+	}
+	mediaType, params, err := mime.ParseMediaType(header("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+	body = decodeTransfer(header("Content-Transfer-Encoding"), body)
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("reading email part: %v", err)
+			}
+			if err := c.readPart(part.Header.Get, part, depth+1); err != nil {
+				return err
+			}
+		}
+	case mediaType == "message/rfc822":
+		if c.forwarded != nil {
+			return nil
+		}
+		msg, err := mail.ReadMessage(body)
+		if err != nil {
+			return fmt.Errorf("reading attached email: %v", err)
+		}
+		c.forwarded, err = readEmail(msg.Header, msg.Body, depth+1)
+		return err
+	}
+
+	if disposition, _, _ := mime.ParseMediaType(header("Content-Disposition")); disposition == "attachment" {
+		return nil
+	}
+	if mediaType != "text/plain" && mediaType != "text/html" {
+		return nil
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("reading email body: %v", err)
+	}
+	text := decodeCharset(data, params["charset"])
+	if mediaType == "text/plain" && c.plain == "" {
+		c.plain = text
+	} else if mediaType == "text/html" && c.html == "" {
+		c.html = text
+	}
+	return nil
+}
+
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	}
+	return body
+}
+
+// decodeCharset converts a body to UTF-8. Unknown charsets are kept as is.
+func decodeCharset(data []byte, charset string) string {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii":
+		return string(data)
+	}
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return string(data)
+	}
+	decoded, err := encoding.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+	return string(decoded)
+}
+
+var (
+	htmlSkipRegex  = regexp.MustCompile(`(?is)<!--.*?-->|<(?:head|script|style)\b.*?</(?:head|script|style)\s*>`)
+	htmlBreakRegex = regexp.MustCompile(`(?i)<br\b[^>]*>|</?(?:p|div|tr|li|ul|ol|table|h[1-6])\b[^>]*>`)
+	htmlCellRegex  = regexp.MustCompile(`(?i)</t[dh]\s*>`)
+	htmlTagRegex   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// htmlToText renders an HTML body as lines of text: block elements and table
+// rows end a line, table cells are separated by spaces.
+func htmlToText(body string) string {
+	body = htmlSkipRegex.ReplaceAllString(body, "")
+	body = strings.NewReplacer("\r", "", "\n", " ").Replace(body)
+	body = htmlBreakRegex.ReplaceAllString(body, "\n")
+	body = htmlCellRegex.ReplaceAllString(body, "  ")
+	body = htmlTagRegex.ReplaceAllString(body, "")
+	body = strings.ReplaceAll(html.UnescapeString(body), "\u00a0", " ")
+
+	var lines []string
+	for _, line := range strings.Split(body, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+var (
+	forwardMarkerRegex = regexp.MustCompile(`(?i)^(?:-+\s*(?:forwarded message|original message)\s*-+|begin forwarded message:?)$`)
+	headerLineRegex    = regexp.MustCompile(`^([A-Za-z-]+):\s*(.*)$`)
+)
+
+// forwardedMessage is a message forwarded inline: the sender and date from
+// its header block, and the text with everything up to its body blanked.
+type forwardedMessage struct {
+	sender *mail.Address
+	date   string
+	text   string
+}
+
+// inlineForward finds a message forwarded inline below a marker line such as
+// "---------- Forwarded message ---------".
+func inlineForward(text string) (forwardedMessage, bool) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		if !forwardMarkerRegex.MatchString(strings.TrimSpace(line)) {
+			continue
+		}
+		var forward forwardedMessage
+		j := i + 1
+		for j < len(lines) && strings.TrimSpace(lines[j]) == "" {
+			j++
+		}
+		for ; j < len(lines); j++ {
+			match := headerLineRegex.FindStringSubmatch(strings.TrimSpace(lines[j]))
+			if match == nil {
+				break
+			}
+			switch strings.ToLower(match[1]) {
+			case "from":
+				forward.sender, _ = mail.ParseAddress(match[2])
+			case "date", "sent":
+				forward.date = match[2]
+			}
+		}
+		if forward.sender == nil {
+			return forwardedMessage{}, false
+		}
+		// Blank out the lines above so line numbers still count from the top
+		forward.text = strings.Repeat("\n", j) + strings.Join(lines[j:], "\n")
+		return forward, true
+	}
+	return forwardedMessage{}, false
+}
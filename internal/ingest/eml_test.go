@@ -0,0 +1,75 @@
+package ingest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestParseEmail_Golden parses every message in testdata/eml with the
+// templates in testdata/eml/templates.json, like TestParseText_Golden.
+func TestParseEmail_Golden(t *testing.T) {
+	templates, err := LoadEmailTemplates(filepath.Join("testdata", "eml", "templates.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join("testdata", "eml", "*.eml"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no corpus files: %v", err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			f, err := os.Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			receipt, err := ParseEmail(f, templates)
+			checkGolden(t, strings.TrimSuffix(file, ".eml")+".golden.json", receipt, err)
+		})
+	}
+}
+
+func TestParseEmail_Errors(t *testing.T) {
+	if _, err := ParseEmail(strings.NewReader("not an email"), nil); err == nil || !strings.Contains(err.Error(), "reading email") {
+		t.Errorf("expected a header error; got %v", err)
+	}
+	attachmentOnly := "From: a@example.com\nContent-Type: multipart/mixed; boundary=x\n\n" +
+		"--x\nContent-Type: application/pdf\nContent-Disposition: attachment\n\n%PDF\n--x--\n"
+	if _, err := ParseEmail(strings.NewReader(attachmentOnly), nil); err == nil || !strings.Contains(err.Error(), "no text") {
+		t.Errorf("expected an error for a message without a body; got %v", err)
+	}
+}
+
+func TestParseEmailTemplates(t *testing.T) {
+	templates, err := ParseEmailTemplates([]byte(`{"templates": [
+		{"domain": "Example.com", "item": "(?P<description>.+) (?P<price>\\S+)", "total": "Total (?P<total>\\S+)"},
+		{"domain": "mail.example.com", "item": "(?P<description>.+) (?P<price>\\S+)", "total": "Due (?P<total>\\S+)"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for domain, want := range map[string]string{"example.com": "example.com", "shop.example.com": "example.com",
+		"mail.example.com": "mail.example.com", "notexample.com": ""} {
+		got := ""
+		if template := templates.For(domain); template != nil {
+			got = template.Domain
+		}
+		if got != want {
+			t.Errorf("For(%q) = %q; want %q", domain, got, want)
+		}
+	}
+
+	for _, bad := range []string{
+		`{"templates": [{"item": "(?P<description>.+) (?P<price>.+)", "total": "(?P<total>.+)"}]}`,
+		`{"templates": [{"domain": "a.com", "item": "(?P<description>.+)", "total": "(?P<total>.+)"}]}`,
+		`{"templates": [{"domain": "a.com", "item": "(?P<description>.+) (?P<price>.+)"}]}`,
+		`{"templates": [{"domain": "a.com", "item": "(?P<description>.+) (?P<price>.+)", "total": "(?P<total>.+)", "date": "("}]}`,
+		`{"templates": [{"domain": "a.com", "items": "x"}]}`,
+	} {
+		if _, err := ParseEmailTemplates([]byte(bad)); err == nil {
+			t.Errorf("expected an error for %s", bad)
+		}
+	}
+}
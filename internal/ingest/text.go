@@ -0,0 +1,330 @@
+package ingest
+
+import (
+	"errors"
+	"receipt-processor/internal/model"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseError points at the line of the input that could not be parsed. Line
+// is 0 for problems with the document as a whole, such as a missing total.
+type ParseError struct {
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e ParseError) Error() string {
+	if e.Line == 0 {
+		return e.Message
+	}
+	return "line " + strconv.Itoa(e.Line) + ": " + e.Message
+}
+
+// ParseErrors is every problem found in one document, in line order.
+type ParseErrors []ParseError
+
+func (e ParseErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "; ")
+}
+
+var (
+	// A price at the end of a line, optionally with a currency sign, a minus
+	// sign before or after (a discount) and a one-letter tax flag
+	priceLineRegex = regexp.MustCompile(`^(.*?)\s+(-?)\$?(\d{1,7}\.\d{2})(-?)(?:\s+[A-Za-z])?$`)
+	// An optional quantity before the description: "2 x", "2 @" or "2X"
+	quantityRegex = regexp.MustCompile(`^(\d{1,4})\s*[xX@]\s+(.+)$`)
+
+	isoDateRegex   = regexp.MustCompile(`\b(\d{4})-(\d{1,2})-(\d{1,2})\b`)
+	slashDateRegex = regexp.MustCompile(`\b(\d{1,2})[/.](\d{1,2})[/.](\d{4}|\d{2})\b`)
+	namedDateRegex = regexp.MustCompile(`(?i)\b(?:(\d{1,2})\s+([a-z]{3,9})\.?,?\s+(\d{4})|([a-z]{3,9})\.?\s+(\d{1,2}),?\s+(\d{4}))\b`)
+	timeRegex      = regexp.MustCompile(`(?i)\b(\d{1,2}):(\d{2})(?::\d{2})?\s*([ap]\.?m\.?)?(?:\s|$)`)
+
+	separatorRegex = regexp.MustCompile(`^[-=*_#~.\s]+$`)
+	spaceRegex     = regexp.MustCompile(`\s+`)
+)
+
+// Keywords of the summary lines, matched against the upper-cased text before
+// the amount.
+var (
+	subtotalWords = []string{"SUBTOTAL", "SUB TOTAL", "SUB-TOTAL"}
+	totalWords    = []string{"TOTAL", "TOTAL DUE", "AMOUNT DUE", "BALANCE DUE", "GRAND TOTAL"}
+	taxWords      = []string{"SALES TAX", "TAX", "VAT", "GST", "HST"}
+	tipWords      = []string{"GRATUITY", "TIP"}
+	// Amounts tendered after the total; the first one found sets paymentMethod
+	tenderWords = []struct{ word, method string }{
+		{"GIFT CARD", "gift_card"},
+		{"CASH", "cash"},
+		{"DEBIT", "debit"},
+		{"CREDIT", "credit"},
+		{"VISA", "credit"},
+		{"MASTERCARD", "credit"},
+		{"AMEX", "credit"},
+		{"DISCOVER", "credit"},
+		{"APPLE PAY", "mobile"},
+		{"GOOGLE PAY", "mobile"},
+		{"CHECK", "check"},
+	}
+)
+
+var months = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April,
+	"may": time.May, "jun": time.June, "jul": time.July, "aug": time.August,
+	"sep": time.September, "sept": time.September, "oct": time.October, "nov": time.November, "dec": time.December,
+}
+
+// ParseText parses the text of a printed receipt, as produced by OCR. The
+// first line that is not a date, time, price or separator is the retailer.
+// Lines ending in a price are items until the TOTAL line; SUBTOTAL, TAX and
+// TIP lines and lines with a negative amount (discounts) fill in the totals
+// breakdown. Priced lines after the total are only read for the payment method.
+//
+// Dates may be written 2022-01-31, 01/31/2022, 31.01.22 or Jan 31, 2022;
+// slashed and dotted dates are month first unless the first number is over
+// 12. Times may be 13:01, 13:01:45 or 1:01 PM. Any problem is reported as
+// ParseErrors with line numbers. The result is not validated.
+func ParseText(text string) (model.Receipt, error) {
+	return parseText(text, model.Receipt{})
+}
+
+// parseText is ParseText taking the retailer, date and time from fallback
+// when the text has none.
+func parseText(text string, fallback model.Receipt) (model.Receipt, error) {
+	var receipt model.Receipt
+	var errs ParseErrors
+	fail := func(line int, message string) {
+		errs = append(errs, ParseError{Line: line, Message: message})
+	}
+
+	totalLine := 0
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, raw := range lines {
+		number := i + 1
+		line := strings.TrimSpace(spaceRegex.ReplaceAllString(raw, " "))
+		if line == "" || separatorRegex.MatchString(line) {
+			continue
+		}
+
+		// Dates and times may share a line with each other or with the header
+		rest := line
+		if receipt.PurchaseDate == "" {
+			if date, remaining, ok, err := findDate(rest); err != nil {
+				fail(number, err.Error())
+			} else if ok {
+				receipt.PurchaseDate = date
+				rest = remaining
+			}
+		}
+		if receipt.PurchaseTime == "" {
+			if purchaseTime, remaining, ok, err := findTime(rest); err != nil {
+				fail(number, err.Error())
+			} else if ok {
+				receipt.PurchaseTime = purchaseTime
+				rest = remaining
+			}
+		}
+		if rest != line {
+			if !priceLineRegex.MatchString(rest) {
+				continue
+			}
+			line = rest
+		}
+
+		match := priceLineRegex.FindStringSubmatch(line)
+		if match == nil {
+			if receipt.Retailer == "" && totalLine == 0 && len(receipt.Items) == 0 {
+				receipt.Retailer = line
+			}
+			continue
+		}
+		label, amount := strings.TrimSpace(match[1]), match[3]
+		negative := match[2] == "-" || match[4] == "-"
+		upper := strings.ToUpper(label)
+
+		if totalLine > 0 {
+			switch {
+			case isTotal(upper):
+				fail(number, "second TOTAL line, the first is on line "+strconv.Itoa(totalLine))
+			case receipt.PaymentMethod == "":
+				receipt.PaymentMethod = tenderMethod(upper)
+			}
+			continue
+		}
+
+		switch {
+		case hasWord(upper, subtotalWords):
+			receipt.Subtotal = amount
+		case isTotal(upper):
+			receipt.Total = amount
+			totalLine = number
+		case hasWord(upper, taxWords):
+			receipt.Tax = amount
+		case hasWord(upper, tipWords):
+			receipt.Tip = amount
+		case negative:
+			receipt.Discounts = append(receipt.Discounts, model.Discount{Description: label, Amount: amount})
+		case label == "":
+			fail(number, "price without a description")
+		default:
+			item := model.Item{ShortDescription: label, Price: amount}
+			if q := quantityRegex.FindStringSubmatch(label); q != nil {
+				item.ShortDescription, item.Quantity = q[2], q[1]
+			}
+			receipt.Items = append(receipt.Items, item)
+		}
+	}
+
+	if receipt.Retailer == "" {
+		receipt.Retailer = fallback.Retailer
+	}
+	if receipt.PurchaseDate == "" {
+		receipt.PurchaseDate = fallback.PurchaseDate
+	}
+	if receipt.PurchaseTime == "" {
+		receipt.PurchaseTime = fallback.PurchaseTime
+	}
+	if receipt.Retailer == "" {
+		fail(0, "no retailer name before the first item")
+	}
+	if receipt.PurchaseDate == "" {
+		fail(0, "no purchase date found")
+	}
+	if receipt.PurchaseTime == "" {
+		fail(0, "no purchase time found")
+	}
+	if len(receipt.Items) == 0 {
+		fail(0, "no item lines found")
+	}
+	if totalLine == 0 {
+		fail(0, "no TOTAL line found")
+	}
+	if len(errs) > 0 {
+		return model.Receipt{}, errs
+	}
+	receipt.Normalize()
+	return receipt, nil
+}
+
+// isTotal reports whether the label is exactly a total keyword, so that
+// "TOTAL SAVINGS" and "TOTAL ITEMS" are not mistaken for the total.
+func isTotal(label string) bool {
+	label = strings.TrimSpace(strings.TrimSuffix(label, ":"))
+	for _, word := range totalWords {
+		if label == word {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWord reports whether text starts with one of words followed by the end
+// of the text or a non-letter, so "TAX" matches "TAX 8%" but not "TAXI".
+func hasWord(text string, words []string) bool {
+	for _, word := range words {
+		if rest, ok := strings.CutPrefix(text, word); ok && (rest == "" || !isLetter(rest[0])) {
+			return true
+		}
+	}
+	return false
+}
+
+// tenderMethod returns the payment method a tender line names, if any.
+func tenderMethod(text string) string {
+	for _, tender := range tenderWords {
+		if strings.Contains(text, tender.word) {
+			return tender.method
+		}
+	}
+	return ""
+}
+
+func isLetter(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+// findDate looks for a date in line and returns it as YYYY-MM-DD along with
+// the line without it. A date-shaped value that is not a real date is an error.
+func findDate(line string) (string, string, bool, error) {
+	var year, month, day int
+	var loc []int
+	if loc = isoDateRegex.FindStringSubmatchIndex(line); loc != nil {
+		year, month, day = atoi(line[loc[2]:loc[3]]), atoi(line[loc[4]:loc[5]]), atoi(line[loc[6]:loc[7]])
+	} else if loc = slashDateRegex.FindStringSubmatchIndex(line); loc != nil {
+		month, day, year = atoi(line[loc[2]:loc[3]]), atoi(line[loc[4]:loc[5]]), atoi(line[loc[6]:loc[7]])
+		if month > 12 {
+			month, day = day, month
+		}
+		if year < 100 {
+			year += 2000
+		}
+	} else if loc = namedDateRegex.FindStringSubmatchIndex(line); loc != nil {
+		var name string
+		if loc[2] >= 0 {
+			day, name, year = atoi(line[loc[2]:loc[3]]), line[loc[4]:loc[5]], atoi(line[loc[6]:loc[7]])
+		} else {
+			name, day, year = line[loc[8]:loc[9]], atoi(line[loc[10]:loc[11]]), atoi(line[loc[12]:loc[13]])
+		}
+		m, ok := lookupMonth(name)
+		if !ok {
+			return "", line, false, nil
+		}
+		month = int(m)
+	} else {
+		return "", line, false, nil
+	}
+
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if month < 1 || month > 12 || date.Day() != day {
+		return "", line, false, errors.New("invalid date " + strconv.Quote(line[loc[0]:loc[1]]))
+	}
+	return date.Format("2006-01-02"), strings.TrimSpace(line[:loc[0]] + " " + line[loc[1]:]), true, nil
+}
+
+// findTime looks for a time of day in line and returns it as HH:MM along
+// with the line without it.
+func findTime(line string) (string, string, bool, error) {
+	loc := timeRegex.FindStringSubmatchIndex(line)
+	if loc == nil {
+		return "", line, false, nil
+	}
+	hour, minute := atoi(line[loc[2]:loc[3]]), atoi(line[loc[4]:loc[5]])
+	if loc[6] >= 0 {
+		if hour < 1 || hour > 12 {
+			return "", line, false, errors.New("invalid time " + strconv.Quote(strings.TrimSpace(line[loc[0]:loc[1]])))
+		}
+		pm := strings.EqualFold(line[loc[6]:loc[6]+1], "p")
+		hour %= 12
+		if pm {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return "", line, false, errors.New("invalid time " + strconv.Quote(strings.TrimSpace(line[loc[0]:loc[1]])))
+	}
+	purchaseTime := time.Date(0, 1, 1, hour, minute, 0, 0, time.UTC).Format("15:04")
+	return purchaseTime, strings.TrimSpace(line[:loc[0]] + " " + line[loc[1]:]), true, nil
+}
+
+func lookupMonth(name string) (time.Month, bool) {
+	name = strings.ToLower(name)
+	if m, ok := months[name]; ok {
+		return m, true
+	}
+	if len(name) > 3 {
+		if m, ok := months[name[:3]]; ok && strings.HasPrefix(strings.ToLower(m.String()), name) {
+			return m, true
+		}
+	}
+	return 0, false
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,107 @@
+package ingest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"receipt-processor/internal/model"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// golden is the expected outcome of parsing one corpus file.
+type golden struct {
+	Receipt any         `json:"receipt,omitempty"`
+	Errors  ParseErrors `json:"errors,omitempty"`
+}
+
+// TestParseText_Golden parses every receipt in testdata/text and compares the
+// result with the .golden.json file next to it. Run with -update after
+// changing the parser to regenerate them.
+func TestParseText_Golden(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "text", "*.txt"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no corpus files: %v", err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			text, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			receipt, err := ParseText(string(text))
+			checkGolden(t, strings.TrimSuffix(file, ".txt")+".golden.json", receipt, err)
+		})
+	}
+}
+
+// checkGolden compares a parse result with the golden file at path, or
+// rewrites the file when -update is set.
+func checkGolden(t *testing.T, path string, receipt model.Receipt, err error) {
+	t.Helper()
+	var want golden
+	if err == nil {
+		// Everything the parsers accept in the corpus is also valid
+		if err := receipt.Validate(); err != nil {
+			t.Errorf("parsed receipt is invalid: %v", err)
+		}
+		want.Receipt = receipt
+	} else if !errors.As(err, &want.Errors) {
+		t.Fatalf("expected ParseErrors; got %T: %v", err, err)
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(want); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.Bytes()
+
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("parse result differs from %s:\n%s", path, got)
+	}
+}
+
+func TestParseText_Formats(t *testing.T) {
+	tests := []struct {
+		header, date, time string
+	}{
+		{"2022-01-31 13:01", "2022-01-31", "13:01"},
+		{"1/31/22 1:01pm", "2022-01-31", "13:01"},
+		{"31/01/2022 12:05 AM", "2022-01-31", "00:05"},
+		{"31 January 2022 08:15:59", "2022-01-31", "08:15"},
+		{"Sept. 3, 2022 12:30 p.m.", "2022-09-03", "12:30"},
+	}
+	for _, test := range tests {
+		receipt, err := ParseText("Target\n" + test.header + "\nPepsi 1.25\nTOTAL 1.25\n")
+		if err != nil {
+			t.Errorf("%q: %v", test.header, err)
+			continue
+		}
+		if receipt.PurchaseDate != test.date || receipt.PurchaseTime != test.time {
+			t.Errorf("%q: got %s %s; want %s %s", test.header, receipt.PurchaseDate, receipt.PurchaseTime, test.date, test.time)
+		}
+	}
+
+	_, err := ParseText("Target\n2022-01-31 13:75\nPepsi 1.25\nTOTAL 1.25\n")
+	var errs ParseErrors
+	if !errors.As(err, &errs) || errs[0].Line != 2 || !strings.Contains(errs[0].Message, "invalid time") {
+		t.Errorf("expected an invalid time on line 2; got %v", err)
+	}
+}
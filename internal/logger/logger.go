@@ -42,6 +42,16 @@ func InitLogger(logLevel string) {
 	})
 }
 
+// SetLevel changes the log level of a running process.
+func SetLevel(logLevel string) error {
+	level, err := logrus.ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(level)
+	return nil
+}
+
 func Info(message string, fields logrus.Fields) {
 	log.WithFields(fields).Info(message)
 }
@@ -57,3 +67,17 @@ func Error(message string, fields logrus.Fields) {
 func Fatal(message string, fields logrus.Fields) {
 	log.WithFields(fields).Fatal(message)
 }
+
+// InitCLILogger configures logging for command-line tools. Messages at or above
+// logLevel go to stderr only, so stdout stays free for command output.
+func InitCLILogger(logLevel string) {
+	log.Out = os.Stderr
+	level, err := logrus.ParseLevel(logLevel)
+	if err != nil {
+		level = logrus.FatalLevel
+	}
+	log.SetLevel(level)
+	log.SetFormatter(&logrus.TextFormatter{
+		FullTimestamp: true,
+	})
+}
@@ -1,38 +1,177 @@
 package model
 
 import (
+	"bytes"
+	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"receipt-processor/internal/logger"
 	"receipt-processor/internal/utility"
 	"strconv"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
 type Receipt struct {
-	Retailer     string `json:"retailer"`
-	PurchaseDate string `json:"purchaseDate"`
-	PurchaseTime string `json:"purchaseTime"`
-	Items        []Item `json:"items"`
-	Total        string `json:"total"`
+	Retailer     string `json:"retailer" xml:"retailer"`
+	PurchaseDate string `json:"purchaseDate" xml:"purchaseDate"`
+	PurchaseTime string `json:"purchaseTime" xml:"purchaseTime"`
+	Items        []Item `json:"items" xml:"items>item"`
+	Total        string `json:"total" xml:"total"`
+	CustomerID   string `json:"customerId,omitempty" xml:"customerId,omitempty"` // optional loyalty customer, used by per-customer promotion limits
+	Timezone     string `json:"timezone,omitempty" xml:"timezone,omitempty"`     // optional IANA time zone of the purchase date and time
+	Currency     string `json:"currency,omitempty" xml:"currency,omitempty"`     // optional ISO 4217 code of every amount, USD when empty
+	Store        *Store `json:"store,omitempty" xml:"store,omitempty"`           // optional branch where the purchase was made
+
+	// Optional totals breakdown. When any of these is given, Validate checks
+	// subtotal + tax - discounts + tip = total instead of items = total.
+	Subtotal      string     `json:"subtotal,omitempty" xml:"subtotal,omitempty"` // sum of the item prices
+	Tax           string     `json:"tax,omitempty" xml:"tax,omitempty"`
+	Discounts     []Discount `json:"discounts,omitempty" xml:"discounts>discount,omitempty"`
+	Tip           string     `json:"tip,omitempty" xml:"tip,omitempty"`
+	PaymentMethod string     `json:"paymentMethod,omitempty" xml:"paymentMethod,omitempty"` // one of PaymentMethods
 }
 
 type Item struct {
-	ShortDescription string `json:"shortDescription"`
-	Price            string `json:"price"`
+	ShortDescription string `json:"shortDescription" xml:"shortDescription"`
+	Price            string `json:"price" xml:"price"`                             // line total
+	Quantity         string `json:"quantity,omitempty" xml:"quantity,omitempty"`   // optional, e.g. "3" or "1.25" for weighed goods
+	UnitPrice        string `json:"unitPrice,omitempty" xml:"unitPrice,omitempty"` // optional, price = quantity * unitPrice
+}
+
+// Discount is a coupon or markdown applied to the whole receipt.
+type Discount struct {
+	Description string `json:"description" xml:"description"`
+	Amount      string `json:"amount" xml:"amount"` // positive, subtracted from the total
 }
 
+// PaymentMethods are the accepted paymentMethod values.
+var PaymentMethods = []string{"cash", "credit", "debit", "gift_card", "mobile", "check", "other"}
+
 // ReceiptDetails holds the results of processing a receipt, including points and explanation.
 type ReceiptDetails struct {
-	Points      int    `json:"points"`
-	Explanation string `json:"explanation"`
+	Points      int      `json:"points"`
+	Explanation string   `json:"explanation"`
+	SubmittedBy string   `json:"submittedBy,omitempty"` // ID of the API key that submitted the receipt
+	Receipt     *Receipt `json:"receipt,omitempty"`     // the submitted receipt, kept for export
+	Promotions  []string `json:"promotions,omitempty"`  // IDs of the promotions that awarded points
+}
+
+// FieldError is a validation error for one field. Field is the path of its
+// JSON name, e.g. "items[1].price" when returned by Receipt.Validate.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+func fieldError(field, message string) error {
+	return &FieldError{Field: field, Message: message}
+}
+
+// within places err, from validating the nested value at path, under path
+// with prefix added to its message.
+func within(path, prefix string, err error) error {
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) {
+		return fmt.Errorf("%s%w", prefix, err)
+	}
+	return &FieldError{Field: path + "." + fieldErr.Field, Message: prefix + fieldErr.Message}
+}
+
+// Errors returned by DecodeReceipt and DecodeReceiptXML.
+var (
+	ErrInvalidJSON   = errors.New("invalid JSON format")
+	ErrInvalidXML    = errors.New("invalid XML format")
+	ErrUnknownFields = errors.New("incorrect receipt data")
+)
+
+// DecodeReceipt parses a JSON receipt document. Unknown top-level fields are
+// rejected with ErrUnknownFields; field values are not validated, use Validate.
+// The retailer and descriptions are normalized (see utility.NormalizeText) so
+// equivalent spellings validate, score and deduplicate alike.
+func DecodeReceipt(body []byte) (Receipt, error) {
+	var receipt Receipt
+
+	var dataMap map[string]interface{}
+	if err := utility.ParseJSON(body, &dataMap); err != nil {
+		return receipt, fmt.Errorf("%w: %v", ErrInvalidJSON, err)
+	}
+	if err := receipt.ValidateReceiptMap(dataMap); err != nil {
+		return receipt, ErrUnknownFields
+	}
+	if err := utility.ParseJSON(body, &receipt); err != nil {
+		return receipt, fmt.Errorf("invalid receipt JSON: %v", err)
+	}
+	receipt.Normalize()
+	return receipt, nil
+}
+
+// DecodeReceiptXML is DecodeReceipt for an XML receipt document. The root
+// element is <receipt>, its children are named like the JSON fields, and
+// items and discounts are wrapped as <items><item>...</item></items>.
+func DecodeReceiptXML(body []byte) (Receipt, error) {
+	var receipt Receipt
+
+	// Collect the root and top-level element names to reject unknown fields
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	fields := map[string]interface{}{}
+	root, depth := "", 0
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return receipt, fmt.Errorf("%w: %v", ErrInvalidXML, err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 && root == "" {
+				root = t.Name.Local
+			} else if depth == 2 {
+				fields[t.Name.Local] = nil
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if root == "" {
+		return receipt, fmt.Errorf("%w: no root element", ErrInvalidXML)
+	}
+	if root != "receipt" || receipt.ValidateReceiptMap(fields) != nil {
+		return receipt, ErrUnknownFields
+	}
+	if err := xml.Unmarshal(body, &receipt); err != nil {
+		return receipt, fmt.Errorf("invalid receipt XML: %v", err)
+	}
+	receipt.Normalize()
+	return receipt, nil
+}
+
+// Normalize normalizes the free-text fields checked by the validation
+// profile. Decoders for other formats call it like DecodeReceipt does.
+func (r *Receipt) Normalize() {
+	r.Retailer = utility.NormalizeText(r.Retailer)
+	for i := range r.Items {
+		r.Items[i].ShortDescription = utility.NormalizeText(r.Items[i].ShortDescription)
+	}
+	for i := range r.Discounts {
+		r.Discounts[i].Description = utility.NormalizeText(r.Discounts[i].Description)
+	}
 }
 
 // ValidateReceiptMap checks if the provided data map has all the required keys for a Receipt.
 func (r Receipt) ValidateReceiptMap(dataMap map[string]interface{}) error {
-	validKeys := []string{"retailer", "purchaseDate", "purchaseTime", "items", "total"}
+	validKeys := []string{"retailer", "purchaseDate", "purchaseTime", "items", "total", "customerId", "timezone",
+		"subtotal", "tax", "discounts", "tip", "paymentMethod", "currency", "store"}
 	for key := range dataMap {
 		if !contains(validKeys, key) {
 			logger.Error("Invalid key in data map", logrus.Fields{
@@ -45,92 +184,261 @@ func (r Receipt) ValidateReceiptMap(dataMap map[string]interface{}) error {
 	return nil
 }
 
-// Validate checks the integrity of the receipt data.
+// Validate checks the integrity of the receipt data. Without a receipt time
+// zone, the purchase date may be today anywhere in the world.
 func (r Receipt) Validate() error {
+	return r.ValidateIn(nil)
+}
+
+// ValidateIn is Validate for a receipt whose time zone, unless it names one,
+// is fallback (for instance the retailer's). A nil fallback means unknown.
+func (r Receipt) ValidateIn(fallback *time.Location) error {
 	if !utility.IsValidRetailerName(r.Retailer) {
 		logger.Error("Invalid retailer name", logrus.Fields{
 			"retailer": r.Retailer,
 		})
-		return errors.New("retailer field is invalid")
+		return fieldError("retailer", "retailer field is invalid")
+	}
+	if r.Timezone != "" {
+		if _, err := utility.LoadLocation(r.Timezone); err != nil {
+			logger.Error("Invalid timezone", logrus.Fields{
+				"timezone": r.Timezone,
+				"error":    err,
+			})
+			return fieldError("timezone", "timezone must be an IANA time zone name such as America/Chicago")
+		}
 	}
-	if !utility.IsValidDate(r.PurchaseDate) {
+	if !utility.IsValidDateIn(r.PurchaseDate, r.Location(fallback)) {
 		logger.Error("Invalid purchase date", logrus.Fields{
 			"purchaseDate": r.PurchaseDate,
 		})
-		return errors.New("purchase date field is required and must be in YYYY-MM-DD format")
+		return fieldError("purchaseDate", "purchase date field is required and must be in YYYY-MM-DD format")
 	}
 	if !utility.IsValidTime(r.PurchaseTime) {
 		logger.Error("Invalid purchase time", logrus.Fields{
 			"purchaseTime": r.PurchaseTime,
 		})
-		return errors.New("purchase time field is required and must be in HH:MM format")
+		return fieldError("purchaseTime", "purchase time field is required and must be in HH:MM format")
+	}
+	if r.Currency != "" && !utility.IsValidCurrency(r.Currency) {
+		logger.Error("Invalid currency", logrus.Fields{
+			"currency": r.Currency,
+		})
+		return fieldError("currency", "currency must be an ISO 4217 code such as USD")
 	}
-	if !utility.IsValidPrice(r.Total) {
+	if !utility.IsValidAmount(r.Total, r.Currency) {
 		logger.Error("Invalid total price format", logrus.Fields{
 			"total": r.Total,
 		})
-		return errors.New("total price format is invalid, should be numeric with two decimal places")
+		return fieldError("total", "total price format is invalid, should be numeric with "+utility.AmountFormat(r.Currency))
+	}
+	if r.CustomerID != "" && !utility.IsValidCustomerID(r.CustomerID) {
+		logger.Error("Invalid customer ID", logrus.Fields{
+			"customerId": r.CustomerID,
+		})
+		return fieldError("customerId", "customer ID is invalid")
+	}
+	if r.Store != nil {
+		if err := r.Store.Validate(); err != nil {
+			return within("store", "", err)
+		}
 	}
 	if len(r.Items) == 0 {
 		logger.Error("No items found in receipt", logrus.Fields{})
-		return errors.New("at least one item is required")
+		return fieldError("items", "at least one item is required")
 	}
 
-	total, err := strconv.ParseFloat(r.Total, 64)
+	if r.PaymentMethod != "" && !contains(PaymentMethods, r.PaymentMethod) {
+		logger.Error("Invalid payment method", logrus.Fields{
+			"paymentMethod": r.PaymentMethod,
+		})
+		return fieldError("paymentMethod", fmt.Sprintf("payment method must be one of %v", PaymentMethods))
+	}
+
+	// Amounts are compared in minor units (cents for USD) to avoid rounding
+	total, err := utility.ParseMinorUnits(r.Total, r.Currency)
 	if err != nil {
 		logger.Error("Error parsing total price", logrus.Fields{
 			"total": r.Total,
 		})
-		return errors.New("total price is not a valid number")
+		return fieldError("total", "total price is not a valid number")
 	}
-
-	var sum float64 = 0
-	for _, item := range r.Items {
-		if err := item.Validate(); err != nil {
+	var sum int64
+	for i, item := range r.Items {
+		if err := item.validate(r.Currency); err != nil {
 			logger.Error("Item validation error", logrus.Fields{
 				"item":  item,
 				"error": err,
 			})
-			return fmt.Errorf("item validation error: %v", err)
+			return within(fmt.Sprintf("items[%d]", i), "item validation error: ", err)
 		}
-		price, err := strconv.ParseFloat(item.Price, 64)
+		price, err := utility.ParseMinorUnits(item.Price, r.Currency)
 		if err != nil {
 			logger.Error("Error parsing item price", logrus.Fields{
 				"price": item.Price,
 			})
-			return errors.New("item price is not a valid number")
+			return fieldError(fmt.Sprintf("items[%d].price", i), "item price is not a valid number")
 		}
 		sum += price
 	}
 
-	if math.Abs(total-sum) > 0.001 {
-		logger.Error("Total does not match sum of items", logrus.Fields{
-			"total": total,
-			"sum":   sum,
+	if !r.HasTotalsBreakdown() {
+		if total != sum {
+			logger.Error("Total does not match sum of items", logrus.Fields{
+				"total": r.Total,
+				"sum":   sum,
+			})
+			return fieldError("total", "total does not match the sum of item prices")
+		}
+		return nil
+	}
+	return r.reconcile(total, sum)
+}
+
+// HasTotalsBreakdown reports whether the receipt gives a subtotal, tax,
+// discounts or tip.
+func (r Receipt) HasTotalsBreakdown() bool {
+	return r.Subtotal != "" || r.Tax != "" || len(r.Discounts) > 0 || r.Tip != ""
+}
+
+// reconcile checks subtotal + tax - discounts + tip = total, in minor units.
+// A missing subtotal is the sum of the items, and missing tax or tip are zero.
+func (r Receipt) reconcile(total, itemSum int64) error {
+	amounts := map[string]int64{"subtotal": itemSum}
+	for _, field := range []struct{ name, value string }{{"subtotal", r.Subtotal}, {"tax", r.Tax}, {"tip", r.Tip}} {
+		if field.value == "" {
+			continue
+		}
+		amount, err := utility.ParseMinorUnits(field.value, r.Currency)
+		if err != nil {
+			logger.Error("Invalid amount format", logrus.Fields{
+				"field":  field.name,
+				"amount": field.value,
+			})
+			return fieldError(field.name, fmt.Sprintf("%s format is invalid, should be numeric with %s", field.name, utility.AmountFormat(r.Currency)))
+		}
+		amounts[field.name] = amount
+	}
+	if amounts["subtotal"] != itemSum {
+		logger.Error("Subtotal does not match sum of items", logrus.Fields{
+			"subtotal": r.Subtotal,
+			"sum":      itemSum,
 		})
-		return errors.New("total does not match the sum of item prices")
+		return fieldError("subtotal", "subtotal does not match the sum of item prices")
+	}
+
+	var discounts int64
+	for i, discount := range r.Discounts {
+		if err := discount.validate(r.Currency); err != nil {
+			logger.Error("Discount validation error", logrus.Fields{
+				"discount": discount,
+				"error":    err,
+			})
+			return within(fmt.Sprintf("discounts[%d]", i), "discount validation error: ", err)
+		}
+		amount, _ := utility.ParseMinorUnits(discount.Amount, r.Currency)
+		discounts += amount
 	}
 
+	expected := amounts["subtotal"] + amounts["tax"] - discounts + amounts["tip"]
+	if total != expected {
+		logger.Error("Total does not reconcile", logrus.Fields{
+			"total":    total,
+			"expected": expected,
+		})
+		return fieldError("total", "total does not match subtotal + tax - discounts + tip")
+	}
 	return nil
 }
 
-// Validate checks the integrity of item data.
+// Location returns the receipt's time zone, or fallback when it names none.
+func (r Receipt) Location(fallback *time.Location) *time.Location {
+	if r.Timezone == "" {
+		return fallback
+	}
+	loc, err := utility.LoadLocation(r.Timezone)
+	if err != nil {
+		return fallback
+	}
+	return loc
+}
+
+// Validate checks the integrity of item data, with amounts in DefaultCurrency.
 func (i Item) Validate() error {
+	return i.validate(utility.DefaultCurrency)
+}
+
+func (i Item) validate(currency string) error {
 	if !utility.IsValidShortDescription(i.ShortDescription) {
 		logger.Error("Invalid short description", logrus.Fields{
 			"shortDescription": i.ShortDescription,
 		})
-		return errors.New("item short description is invalid")
+		return fieldError("shortDescription", "item short description is invalid")
 	}
-	if !utility.IsValidPrice(i.Price) {
+	if !utility.IsValidAmount(i.Price, currency) {
 		logger.Error("Invalid item price format", logrus.Fields{
 			"price": i.Price,
 		})
-		return errors.New("item price format is invalid, should be numeric with two decimal places")
+		return fieldError("price", "item price format is invalid, should be numeric with "+utility.AmountFormat(currency))
+	}
+	if i.Quantity != "" && !utility.IsValidQuantity(i.Quantity) {
+		logger.Error("Invalid item quantity", logrus.Fields{
+			"quantity": i.Quantity,
+		})
+		return fieldError("quantity", "item quantity must be a positive number with up to three decimal places")
+	}
+	if i.UnitPrice == "" {
+		return nil
+	}
+	unitPrice, err := utility.ParseMinorUnits(i.UnitPrice, currency)
+	if err != nil {
+		logger.Error("Invalid item unit price format", logrus.Fields{
+			"unitPrice": i.UnitPrice,
+		})
+		return fieldError("unitPrice", "item unit price format is invalid, should be numeric with "+utility.AmountFormat(currency))
+	}
+	quantity := 1.0
+	if i.Quantity != "" {
+		quantity, _ = strconv.ParseFloat(i.Quantity, 64)
+	}
+	price, _ := utility.ParseMinorUnits(i.Price, currency)
+	if int64(math.Round(quantity*float64(unitPrice))) != price {
+		logger.Error("Item price does not match quantity * unit price", logrus.Fields{
+			"price":     i.Price,
+			"quantity":  i.Quantity,
+			"unitPrice": i.UnitPrice,
+		})
+		return fieldError("price", "item price does not match quantity * unit price")
 	}
 	return nil
 }
 
+// Validate checks the integrity of discount data, with the amount in
+// DefaultCurrency.
+func (d Discount) Validate() error {
+	return d.validate(utility.DefaultCurrency)
+}
+
+func (d Discount) validate(currency string) error {
+	if !utility.IsValidShortDescription(d.Description) {
+		return fieldError("description", "discount description is invalid")
+	}
+	if !utility.IsValidAmount(d.Amount, currency) {
+		return fieldError("amount", "discount amount format is invalid, should be numeric with "+utility.AmountFormat(currency))
+	}
+	return nil
+}
+
+// String identifies the item for duplicate detection. Items without a
+// quantity or unit price render as they always have, so receipts stored by
+// earlier releases keep their hashes.
+func (i Item) String() string {
+	if i.Quantity == "" && i.UnitPrice == "" {
+		return "{" + i.ShortDescription + " " + i.Price + "}"
+	}
+	return "{" + i.ShortDescription + " " + i.Price + " " + i.Quantity + " " + i.UnitPrice + "}"
+}
+
 // contains checks if a string is present in a slice of strings.
 func contains(slice []string, str string) bool {
 	for _, v := range slice {
@@ -141,6 +449,17 @@ func contains(slice []string, str string) bool {
 	return false
 }
 
+// String identifies the purchase for duplicate detection. The customer is left
+// out so the same receipt cannot be claimed by two customers. The currency is
+// only included when it is not the default, and the store only when given, so
+// receipts stored by earlier releases keep their hashes.
 func (r Receipt) String() string {
-	return fmt.Sprintf("%s-%s-%s-%s-%v", r.Retailer, r.PurchaseDate, r.PurchaseTime, r.Total, r.Items)
+	key := fmt.Sprintf("%s-%s-%s-%s-%v", r.Retailer, r.PurchaseDate, r.PurchaseTime, r.Total, r.Items)
+	if r.Currency != "" && r.Currency != utility.DefaultCurrency {
+		key += "-" + r.Currency
+	}
+	if r.Store != nil {
+		key += "-store:" + r.Store.ID
+	}
+	return key
 }
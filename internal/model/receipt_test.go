@@ -1,6 +1,8 @@
 package model
 
 import (
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -102,3 +104,229 @@ func TestContains(t *testing.T) {
 		}
 	}
 }
+
+func TestDecodeReceipt(t *testing.T) {
+	receipt, err := DecodeReceipt([]byte(`{"retailer": "Target", "total": "1.00"}`))
+	if err != nil || receipt.Retailer != "Target" || receipt.Total != "1.00" {
+		t.Errorf("DecodeReceipt() = %+v, %v", receipt, err)
+	}
+
+	if _, err := DecodeReceipt([]byte(`{not json`)); !errors.Is(err, ErrInvalidJSON) {
+		t.Errorf("expected ErrInvalidJSON; got %v", err)
+	}
+	if _, err := DecodeReceipt([]byte(`{"retailer": "Target", "extra": 1}`)); !errors.Is(err, ErrUnknownFields) {
+		t.Errorf("expected ErrUnknownFields; got %v", err)
+	}
+	if _, err := DecodeReceipt([]byte(`{"retailer": 5}`)); err == nil {
+		t.Errorf("expected error for wrongly typed field")
+	}
+
+	// Text is NFC-normalized, so both spellings of "Café" are the same receipt
+	composed, _ := DecodeReceipt([]byte(`{"retailer": "Caf\u00e9", "items": [{"shortDescription": "Cr\u00e8me", "price": "1.00"}]}`))
+	decomposed, _ := DecodeReceipt([]byte(`{"retailer": "Cafe\u0301", "items": [{"shortDescription": "Cre\u0300me", "price": "1.00"}]}`))
+	if composed.String() != decomposed.String() || decomposed.Retailer != "Café" {
+		t.Errorf("expected normalized text; got %q and %q", composed.String(), decomposed.String())
+	}
+}
+
+func TestDecodeReceiptXML(t *testing.T) {
+	receipt, err := DecodeReceiptXML([]byte(`<?xml version="1.0"?>
+<receipt>
+  <retailer>M&amp;M Corner Market</retailer>
+  <purchaseDate>2022-03-20</purchaseDate>
+  <purchaseTime>14:33</purchaseTime>
+  <items>
+    <item><shortDescription>Gatorade</shortDescription><price>2.25</price></item>
+    <item><shortDescription>Gatorade</shortDescription><price>2.25</price><quantity>1</quantity></item>
+  </items>
+  <total>4.50</total>
+  <store><id>42</id></store>
+</receipt>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	json, _ := DecodeReceipt([]byte(`{"retailer": "M&M Corner Market", "purchaseDate": "2022-03-20", "purchaseTime": "14:33",
+		"items": [{"shortDescription": "Gatorade", "price": "2.25"}, {"shortDescription": "Gatorade", "price": "2.25", "quantity": "1"}],
+		"total": "4.50", "store": {"id": "42"}}`))
+	if receipt.String() != json.String() || receipt.Items[1].Quantity != "1" {
+		t.Errorf("expected the XML and JSON receipts to match; got %+v", receipt)
+	}
+
+	if _, err := DecodeReceiptXML([]byte(`<receipt><retailer>Target`)); !errors.Is(err, ErrInvalidXML) {
+		t.Errorf("expected ErrInvalidXML; got %v", err)
+	}
+	if _, err := DecodeReceiptXML([]byte(`<receipt><retailer>Target</retailer><extra>1</extra></receipt>`)); !errors.Is(err, ErrUnknownFields) {
+		t.Errorf("expected ErrUnknownFields for an unknown element; got %v", err)
+	}
+	if _, err := DecodeReceiptXML([]byte(`<order><retailer>Target</retailer></order>`)); !errors.Is(err, ErrUnknownFields) {
+		t.Errorf("expected ErrUnknownFields for another root element; got %v", err)
+	}
+}
+
+func TestReceipt_ValidateCustomerID(t *testing.T) {
+	receipt := Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items:        []Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}},
+		Total:        "6.49",
+	}
+	for id, valid := range map[string]bool{"": true, "cust-42": true, "a@b.com": true, "-leading": false, "has space": false} {
+		receipt.CustomerID = id
+		if err := receipt.Validate(); (err == nil) != valid {
+			t.Errorf("customerId %q: expected valid=%v; got %v", id, valid, err)
+		}
+	}
+}
+
+func TestReceipt_ValidateTotalsBreakdown(t *testing.T) {
+	base := func() Receipt {
+		return Receipt{
+			Retailer:     "Target",
+			PurchaseDate: "2022-01-01",
+			PurchaseTime: "13:01",
+			Items: []Item{
+				{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+				{ShortDescription: "Emils Cheese Pizza", Price: "12.25", Quantity: "1"},
+				{ShortDescription: "Bananas", Price: "1.86", Quantity: "2.35", UnitPrice: "0.79"},
+			},
+			Total: "20.60",
+		}
+	}
+	tests := []struct {
+		name  string
+		edit  func(r *Receipt)
+		valid bool
+	}{
+		{"items only", func(r *Receipt) {}, true},
+		{"items do not add up", func(r *Receipt) { r.Total = "21.60" }, false},
+		{"tax and tip", func(r *Receipt) { r.Tax, r.Tip, r.Total = "1.65", "3.00", "25.25" }, true},
+		{"subtotal given", func(r *Receipt) { r.Subtotal, r.Tax, r.Total = "20.60", "1.65", "22.25" }, true},
+		{"subtotal wrong", func(r *Receipt) { r.Subtotal, r.Tax, r.Total = "20.00", "2.25", "22.25" }, false},
+		{"discounts", func(r *Receipt) {
+			r.Discounts = []Discount{{Description: "Coupon", Amount: "1.00"}, {Description: "Member price", Amount: "0.60"}}
+			r.Total = "19.00"
+		}, true},
+		{"does not reconcile", func(r *Receipt) { r.Tax, r.Total = "1.65", "20.60" }, false},
+		{"bad tax format", func(r *Receipt) { r.Tax, r.Total = "1.6", "22.20" }, false},
+		{"bad discount", func(r *Receipt) { r.Discounts, r.Total = []Discount{{Description: "Coupon", Amount: "-1.00"}}, "21.60" }, false},
+		{"payment method", func(r *Receipt) { r.PaymentMethod = "credit" }, true},
+		{"unknown payment method", func(r *Receipt) { r.PaymentMethod = "barter" }, false},
+		{"unit price mismatch", func(r *Receipt) { r.Items[2].UnitPrice = "0.80" }, false},
+		{"unit price without quantity", func(r *Receipt) { r.Items[0].UnitPrice = "6.49" }, true},
+		{"zero quantity", func(r *Receipt) { r.Items[1].Quantity = "0" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := base()
+			tt.edit(&r)
+			if err := r.Validate(); (err == nil) != tt.valid {
+				t.Errorf("expected valid=%v; got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestReceipt_StringUnchangedForPlainItems(t *testing.T) {
+	r := Receipt{Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01",
+		Items: []Item{{ShortDescription: "Pepsi", Price: "1.25"}}, Total: "1.25"}
+	if got, want := r.String(), "Target-2022-01-01-13:01-1.25-[{Pepsi 1.25}]"; got != want {
+		t.Errorf("String() = %q; want %q", got, want)
+	}
+}
+
+func TestReceipt_ValidateCurrency(t *testing.T) {
+	tests := []struct {
+		name     string
+		currency string
+		price    string
+		total    string
+		valid    bool
+	}{
+		{"default is USD", "", "6.49", "6.49", true},
+		{"yen has no minor units", "JPY", "980", "980", true},
+		{"yen with decimals", "JPY", "980.00", "980.00", false},
+		{"dinar has three", "KWD", "1.250", "1.250", true},
+		{"dinar with two", "KWD", "1.25", "1.25", false},
+		{"unknown currency", "ABC", "6.49", "6.49", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Receipt{
+				Retailer:     "Target",
+				PurchaseDate: "2022-01-01",
+				PurchaseTime: "13:01",
+				Items:        []Item{{ShortDescription: "Mountain Dew 12PK", Price: tt.price}},
+				Total:        tt.total,
+				Currency:     tt.currency,
+			}
+			if err := r.Validate(); (err == nil) != tt.valid {
+				t.Errorf("expected valid=%v; got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestStore_Validate(t *testing.T) {
+	lat, lng, bad := 41.88, -87.62, 123.0
+	tests := []struct {
+		name  string
+		store Store
+		valid bool
+	}{
+		{"id only", Store{ID: "101"}, true},
+		{"full", Store{ID: "T-101", Address: "1 S State St, Chicago", PostalCode: "60603", Region: "US-IL", Latitude: &lat, Longitude: &lng}, true},
+		{"missing id", Store{Region: "US-IL"}, false},
+		{"bad postal code", Store{ID: "101", PostalCode: "6"}, false},
+		{"bad region", Store{ID: "101", Region: "Illinois, USA"}, false},
+		{"latitude only", Store{ID: "101", Latitude: &lat}, false},
+		{"out of range", Store{ID: "101", Latitude: &bad, Longitude: &lng}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.store.Validate(); (err == nil) != tt.valid {
+				t.Errorf("expected valid=%v; got %v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestReceipt_ValidateFieldErrors(t *testing.T) {
+	base := func() Receipt {
+		return Receipt{
+			Retailer:     "Target",
+			PurchaseDate: "2022-01-01",
+			PurchaseTime: "13:01",
+			Items:        []Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}, {ShortDescription: "Pepsi", Price: "1.25"}},
+			Total:        "7.74",
+		}
+	}
+	tests := []struct {
+		edit    func(r *Receipt)
+		field   string
+		message string
+	}{
+		{func(r *Receipt) { r.Retailer = "" }, "retailer", "retailer field is invalid"},
+		{func(r *Receipt) { r.Items = nil }, "items", "at least one item is required"},
+		{func(r *Receipt) { r.Items[1].Price = "1.2" }, "items[1].price", "item validation error: item price format is invalid"},
+		{func(r *Receipt) { r.Total = "7.75" }, "total", "total does not match the sum of item prices"},
+		{func(r *Receipt) {
+			r.Discounts, r.Total = []Discount{{Description: "", Amount: "1.00"}}, "6.74"
+		}, "discounts[0].description", "discount validation error: discount description is invalid"},
+		{func(r *Receipt) { r.Store = &Store{ID: "101", PostalCode: "6"} }, "store.postalCode", "store postal code is invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			r := base()
+			tt.edit(&r)
+			err := r.Validate()
+			var fieldErr *FieldError
+			if !errors.As(err, &fieldErr) {
+				t.Fatalf("expected a FieldError; got %v", err)
+			}
+			if fieldErr.Field != tt.field || !strings.HasPrefix(err.Error(), tt.message) {
+				t.Errorf("expected %s: %s; got %s: %v", tt.field, tt.message, fieldErr.Field, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/utility"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Store identifies the branch of the retailer where a purchase was made.
+type Store struct {
+	ID         string `json:"id" xml:"id"`                                     // retailer's own store number or code
+	Address    string `json:"address,omitempty" xml:"address,omitempty"`       // street address, one line
+	PostalCode string `json:"postalCode,omitempty" xml:"postalCode,omitempty"` // e.g. "60601" or "SW1A 1AA"
+	Region     string `json:"region,omitempty" xml:"region,omitempty"`         // state, province or other area code, e.g. "US-IL"
+
+	// Latitude and Longitude are decimal degrees. Both or neither are set.
+	Latitude  *float64 `json:"latitude,omitempty" xml:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty" xml:"longitude,omitempty"`
+}
+
+// Validate checks the integrity of store data.
+func (s Store) Validate() error {
+	if !utility.IsValidStoreID(s.ID) {
+		logger.Error("Invalid store ID", logrus.Fields{
+			"storeId": s.ID,
+		})
+		return fieldError("id", "store id is required and may contain letters, digits, dots, dashes and underscores")
+	}
+	if s.Address != "" && !utility.IsValidAddress(s.Address) {
+		return fieldError("address", "store address is invalid")
+	}
+	if s.PostalCode != "" && !utility.IsValidPostalCode(s.PostalCode) {
+		return fieldError("postalCode", "store postal code is invalid")
+	}
+	if s.Region != "" && !utility.IsValidRegion(s.Region) {
+		return fieldError("region", "store region is invalid")
+	}
+	if s.Latitude == nil && s.Longitude != nil {
+		return fieldError("latitude", "store latitude and longitude must be given together")
+	}
+	if s.Latitude != nil && s.Longitude == nil {
+		return fieldError("longitude", "store latitude and longitude must be given together")
+	}
+	if s.Latitude != nil && (*s.Latitude < -90 || *s.Latitude > 90 || *s.Longitude < -180 || *s.Longitude > 180) {
+		logger.Error("Invalid store coordinates", logrus.Fields{
+			"latitude":  *s.Latitude,
+			"longitude": *s.Longitude,
+		})
+		field := "latitude"
+		if *s.Latitude >= -90 && *s.Latitude <= 90 {
+			field = "longitude"
+		}
+		return fieldError(field, "store coordinates are out of range")
+	}
+	return nil
+}
@@ -0,0 +1,309 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"receipt-processor/internal/auth"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/utility"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// Rule is a token-bucket limit: Burst tokens refilled at RPS tokens per second.
+// A rule with a non-positive RPS disables limiting.
+type Rule struct {
+	RPS   float64
+	Burst int
+}
+
+// Config controls how the Limiter keys and limits requests.
+type Config struct {
+	// Default applies to every route without an entry in Routes.
+	Default Rule
+	// Routes holds per-route overrides keyed by mux path template, e.g.
+	// "/receipts/process", or by full gRPC method name.
+	Routes map[string]Rule
+	// TrustedProxies lists the proxies whose X-Forwarded-For header is honoured.
+	TrustedProxies []*net.IPNet
+	// IdleTTL is how long an unused bucket is kept before it is evicted.
+	IdleTTL time.Duration
+	// Authenticator identifies callers by API key. Without it, or for keys it
+	// does not know, callers are identified by client IP.
+	Authenticator *auth.Authenticator
+}
+
+type bucket struct {
+	tokens   float64
+	last     time.Time
+	lastSeen time.Time
+}
+
+// Limiter is an in-memory, per-client token-bucket rate limiter.
+type Limiter struct {
+	cfg     Config
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+	stop    chan struct{}
+}
+
+// Result describes the outcome of a single Allow call.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// New creates a Limiter with the given configuration.
+func New(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:     cfg,
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+		stop:    make(chan struct{}),
+	}
+}
+
+// ParseTrustedProxies converts a list of IPs or CIDRs into networks. Plain IPs
+// are treated as single-host networks.
+func ParseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", entry, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// Allow takes a token from the bucket identified by key, creating it full if needed.
+func (l *Limiter) Allow(key string, rule Rule) Result {
+	if rule.RPS <= 0 {
+		return Result{Allowed: true}
+	}
+	burst := rule.Burst
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*rule.RPS)
+	b.last = now
+	b.lastSeen = now
+
+	result := Result{Limit: burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / rule.RPS)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = secondsToDuration((float64(burst) - b.tokens) / rule.RPS)
+	return result
+}
+
+// Evict removes buckets that have not been used for longer than the idle TTL.
+func (l *Limiter) Evict() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := l.now().Add(-l.cfg.IdleTTL)
+	evicted := 0
+	for key, b := range l.buckets {
+		if b.lastSeen.Before(cutoff) {
+			delete(l.buckets, key)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// StartEviction periodically evicts idle buckets until Stop is called.
+func (l *Limiter) StartEviction(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if n := l.Evict(); n > 0 {
+					logger.Info("Evicted idle rate limit buckets", logrus.Fields{
+						"evicted": n,
+					})
+				}
+			case <-l.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the eviction loop started by StartEviction.
+func (l *Limiter) Stop() {
+	close(l.stop)
+}
+
+// Middleware enforces the configured limits for each matched mux route.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+		rule := l.ruleFor(route)
+		if rule.RPS <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		client := l.ClientKey(r)
+		result := l.Allow(route+"|"+client, rule)
+
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			logger.Warn("Rate limit exceeded", logrus.Fields{
+				"route":  route,
+				"client": client,
+			})
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			utility.WriteError(w, "Rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// SetRules replaces the default and per-route limits. Existing buckets keep
+// their tokens, capped at the new burst on their next request.
+func (l *Limiter) SetRules(def Rule, routes map[string]Rule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cfg.Default = def
+	l.cfg.Routes = routes
+}
+
+func (l *Limiter) ruleFor(route string) Rule {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if rule, ok := l.cfg.Routes[route]; ok {
+		return rule
+	}
+	return l.cfg.Default
+}
+
+// AllowRoute takes a token from client's bucket for route under the route's
+// rule. It is used for calls that are not mux routes, such as gRPC methods.
+func (l *Limiter) AllowRoute(route, client string) Result {
+	return l.Allow(route+"|"+client, l.ruleFor(route))
+}
+
+// ClientKey identifies the caller: by key ID when a known API key is sent,
+// otherwise by client IP. Unknown keys share their IP's bucket, so sending a
+// new made-up key with each request does not get around the limit.
+func (l *Limiter) ClientKey(r *http.Request) string {
+	return l.ClientKeyFor(r.Header.Get(auth.APIKeyHeader), ClientIP(r, l.cfg.TrustedProxies))
+}
+
+// ClientKeyFor is ClientKey for a caller that sent apiKey from address ip.
+func (l *Limiter) ClientKeyFor(apiKey, ip string) string {
+	if l.cfg.Authenticator != nil {
+		if key, ok := l.cfg.Authenticator.Authenticate(apiKey); ok {
+			return "key:" + key.ID
+		}
+	}
+	return "ip:" + ip
+}
+
+// ClientIP returns the address of the client that made the request. The
+// X-Forwarded-For header is only consulted when the direct peer is a trusted
+// proxy; it is then walked right to left, skipping trusted hops.
+func ClientIP(r *http.Request, trusted []*net.IPNet) string {
+	remote := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if !isTrusted(remote, trusted) {
+		return remote
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if hop == "" {
+			continue
+		}
+		if !isTrusted(hop, trusted) {
+			return hop
+		}
+		remote = hop
+	}
+	return remote
+}
+
+func isTrusted(addr string, trusted []*net.IPNet) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			return tmpl
+		}
+	}
+	return r.URL.Path
+}
+
+func secondsToDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
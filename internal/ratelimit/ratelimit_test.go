@@ -0,0 +1,192 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"receipt-processor/internal/auth"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// newTestLimiter returns a limiter whose clock is controlled by the returned pointer.
+func newTestLimiter(cfg Config) (*Limiter, *time.Time) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := New(cfg)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestAllow(t *testing.T) {
+	l, now := newTestLimiter(Config{})
+	rule := Rule{RPS: 1, Burst: 2}
+
+	for i := 0; i < 2; i++ {
+		if res := l.Allow("client", rule); !res.Allowed {
+			t.Fatalf("request %d: expected to be allowed", i+1)
+		}
+	}
+	res := l.Allow("client", rule)
+	if res.Allowed {
+		t.Fatalf("expected third request to be limited")
+	}
+	if res.RetryAfter != time.Second {
+		t.Errorf("expected RetryAfter of 1s; got %v", res.RetryAfter)
+	}
+
+	// Tokens are refilled over time
+	*now = now.Add(time.Second)
+	if res := l.Allow("client", rule); !res.Allowed {
+		t.Errorf("expected request to be allowed after refill")
+	}
+
+	// Buckets are independent per key
+	if res := l.Allow("other", rule); !res.Allowed || res.Remaining != 1 {
+		t.Errorf("expected a fresh bucket for another client; got %+v", res)
+	}
+}
+
+func TestAllow_Disabled(t *testing.T) {
+	l, _ := newTestLimiter(Config{})
+	for i := 0; i < 100; i++ {
+		if res := l.Allow("client", Rule{}); !res.Allowed {
+			t.Fatalf("expected requests to be allowed when limiting is disabled")
+		}
+	}
+}
+
+func TestEvict(t *testing.T) {
+	l, now := newTestLimiter(Config{IdleTTL: time.Minute})
+	l.Allow("idle", Rule{RPS: 1, Burst: 1})
+	*now = now.Add(2 * time.Minute)
+	l.Allow("active", Rule{RPS: 1, Burst: 1})
+
+	if n := l.Evict(); n != 1 {
+		t.Errorf("expected 1 bucket to be evicted; got %d", n)
+	}
+	if _, ok := l.buckets["active"]; !ok {
+		t.Errorf("expected active bucket to be kept")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		expected   string
+	}{
+		{"direct client", "203.0.113.5:1234", "", "203.0.113.5"},
+		{"untrusted peer ignores XFF", "203.0.113.5:1234", "1.2.3.4", "203.0.113.5"},
+		{"trusted proxy uses XFF", "10.1.2.3:1234", "1.2.3.4", "1.2.3.4"},
+		{"skips trusted hops", "10.1.2.3:1234", "1.2.3.4, 192.168.1.1", "1.2.3.4"},
+		{"spoofed left-most entry ignored", "10.1.2.3:1234", "6.6.6.6, 1.2.3.4", "1.2.3.4"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.xff != "" {
+			req.Header.Set("X-Forwarded-For", test.xff)
+		}
+		if got := ClientIP(req, trusted); got != test.expected {
+			t.Errorf("%s: ClientIP() = %q; want %q", test.name, got, test.expected)
+		}
+	}
+}
+
+func TestParseTrustedProxies_Invalid(t *testing.T) {
+	if _, err := ParseTrustedProxies([]string{"not-an-ip"}); err == nil {
+		t.Errorf("expected error for invalid proxy entry")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	authenticator, err := auth.NewAuthenticator([]auth.Key{
+		{ID: "pos", Hash: auth.HashKey("secret"), Scopes: []string{auth.ScopeReceiptsWrite}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, _ := newTestLimiter(Config{
+		Default:       Rule{RPS: 100, Burst: 100},
+		Routes:        map[string]Rule{"/receipts/process": {RPS: 1, Burst: 1}},
+		Authenticator: authenticator,
+	})
+
+	r := mux.NewRouter()
+	r.Use(l.Middleware)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	r.HandleFunc("/receipts/process", ok).Methods("POST")
+	r.HandleFunc("/receipts/{id}/points", ok).Methods("GET")
+
+	send := func(method, path, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "203.0.113.5:1234"
+		if apiKey != "" {
+			req.Header.Set(auth.APIKeyHeader, apiKey)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := send("POST", "/receipts/process", ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected first request to succeed; got %d", rr.Code)
+	}
+	rr := send("POST", "/receipts/process", "")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429; got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After of 1; got %q", rr.Header().Get("Retry-After"))
+	}
+	if rr.Header().Get("RateLimit-Limit") != "1" || rr.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("unexpected RateLimit headers: %v", rr.Header())
+	}
+
+	// Other routes use their own limit
+	if rr := send("GET", "/receipts/abc/points", ""); rr.Code != http.StatusOK {
+		t.Errorf("expected points route to be allowed; got %d", rr.Code)
+	}
+
+	// Requests with a known API key are limited separately from the client IP
+	if rr := send("POST", "/receipts/process", "secret"); rr.Code != http.StatusOK {
+		t.Errorf("expected request with API key to be allowed; got %d", rr.Code)
+	}
+	if rr := send("POST", "/receipts/process", "secret"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the key's second request to be limited; got %d", rr.Code)
+	}
+
+	// Unknown keys are limited by client IP, so rotating them does not help
+	for i := 0; i < 5; i++ {
+		if rr := send("POST", "/receipts/process", fmt.Sprintf("bogus-%d", i)); rr.Code != http.StatusTooManyRequests {
+			t.Errorf("expected a made-up key to be limited by IP; got %d", rr.Code)
+		}
+	}
+	if len(l.buckets) != 3 {
+		t.Errorf("expected one bucket per route and client; got %d", len(l.buckets))
+	}
+}
+
+func TestSetRules(t *testing.T) {
+	l, _ := newTestLimiter(Config{
+		Default: Rule{RPS: 1, Burst: 1},
+		Routes:  map[string]Rule{"/receipts/process": {RPS: 2, Burst: 2}},
+	})
+
+	l.SetRules(Rule{RPS: 5, Burst: 5}, map[string]Rule{"/receipts/{id}/points": {RPS: 3, Burst: 3}})
+	if rule := l.ruleFor("/receipts/process"); rule != (Rule{RPS: 5, Burst: 5}) {
+		t.Errorf("expected a dropped route to use the new default; got %+v", rule)
+	}
+	if rule := l.ruleFor("/receipts/{id}/points"); rule != (Rule{RPS: 3, Burst: 3}) {
+		t.Errorf("expected the new route rule; got %+v", rule)
+	}
+}
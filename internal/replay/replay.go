@@ -0,0 +1,227 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"receipt-processor/internal/capture"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/services"
+	"sort"
+)
+
+// ErrUnsupportedVersion is reported for records written by a newer capture format.
+var ErrUnsupportedVersion = errors.New("unsupported capture format version")
+
+// Record is one recorded /receipts/process request: the receipt and tenant
+// fields of a capture.Record. A line holding a bare receipt document (no
+// "receipt" key) is also accepted and replayed for the default tenant.
+type Record struct {
+	FormatVersion int             `json:"formatVersion,omitempty"`
+	Tenant        string          `json:"tenant,omitempty"`
+	Receipt       json.RawMessage `json:"receipt"`
+}
+
+// Options controls a replay run.
+type Options struct {
+	// Rulesets scores every accepted receipt.
+	Rulesets *services.RulesetSet
+	// Compare, when set, scores every accepted receipt a second time so the
+	// per-receipt difference can be reported.
+	Compare *services.RulesetSet
+}
+
+// Summary is the outcome of replaying a recording.
+type Summary struct {
+	Total      int            `json:"total"`
+	Accepted   int            `json:"accepted"`
+	Duplicates int            `json:"duplicates"`
+	Rejected   map[string]int `json:"rejected"` // count by rejection reason
+	Points     Distribution   `json:"points"`
+
+	// Set only when comparing rulesets
+	ComparePoints *Distribution `json:"comparePoints,omitempty"`
+	Changes       []Change      `json:"changes,omitempty"`
+}
+
+// Distribution summarises the points awarded to accepted receipts.
+type Distribution struct {
+	Count   int      `json:"count"`
+	Sum     int      `json:"sum"`
+	Min     int      `json:"min"`
+	Max     int      `json:"max"`
+	Mean    float64  `json:"mean"`
+	Median  int      `json:"median"`
+	P90     int      `json:"p90"`
+	Buckets []Bucket `json:"buckets"`
+}
+
+// Bucket counts receipts whose points fall in [Min, Max]. Max of -1 means unbounded.
+type Bucket struct {
+	Min   int `json:"min"`
+	Max   int `json:"max"`
+	Count int `json:"count"`
+}
+
+// Change describes a receipt whose points differ between the two rulesets.
+type Change struct {
+	Line          int    `json:"line"`
+	Tenant        string `json:"tenant"`
+	Retailer      string `json:"retailer"`
+	PurchaseDate  string `json:"purchaseDate"`
+	Points        int    `json:"points"`
+	ComparePoints int    `json:"comparePoints"`
+	Delta         int    `json:"delta"`
+}
+
+// bucketBounds are the lower bounds of the points histogram buckets.
+var bucketBounds = []int{0, 25, 50, 100, 200}
+
+// Run replays every record read from r through decoding, validation,
+// per-tenant deduplication and scoring, entirely in memory.
+func Run(r io.Reader, opts Options) (*Summary, error) {
+	if opts.Rulesets == nil {
+		return nil, errors.New("replay: no rulesets given")
+	}
+
+	summary := &Summary{Rejected: map[string]int{}}
+	seen := map[string]map[string]bool{} // tenant -> receipt hash
+	var points, comparePoints []int
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		summary.Total++
+
+		record, err := parseRecord(text)
+		if err != nil {
+			summary.Rejected[rejectionReason(err)]++
+			continue
+		}
+		receipt, err := model.DecodeReceipt(record.Receipt)
+		if err != nil {
+			summary.Rejected[rejectionReason(err)]++
+			continue
+		}
+		if err := services.ValidateReceipt(receipt, opts.Rulesets.For(record.Tenant)); err != nil {
+			summary.Rejected[err.Error()]++
+			continue
+		}
+
+		hash := services.GenerateHash(receipt)
+		if seen[record.Tenant] == nil {
+			seen[record.Tenant] = map[string]bool{}
+		}
+		if seen[record.Tenant][hash] {
+			summary.Duplicates++
+			continue
+		}
+		seen[record.Tenant][hash] = true
+		summary.Accepted++
+
+		score := services.ScoreReceipt(receipt, opts.Rulesets.For(record.Tenant))
+		points = append(points, score.Points)
+
+		if opts.Compare != nil {
+			compare := services.ScoreReceipt(receipt, opts.Compare.For(record.Tenant))
+			comparePoints = append(comparePoints, compare.Points)
+			if compare.Points != score.Points {
+				summary.Changes = append(summary.Changes, Change{
+					Line:          line,
+					Tenant:        record.Tenant,
+					Retailer:      receipt.Retailer,
+					PurchaseDate:  receipt.PurchaseDate,
+					Points:        score.Points,
+					ComparePoints: compare.Points,
+					Delta:         compare.Points - score.Points,
+				})
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("replay: reading input: %v", err)
+	}
+
+	summary.Points = distribution(points)
+	if opts.Compare != nil {
+		d := distribution(comparePoints)
+		summary.ComparePoints = &d
+	}
+	return summary, nil
+}
+
+// parseRecord decodes a line as a Record, falling back to a bare receipt.
+func parseRecord(line []byte) (Record, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return Record{}, fmt.Errorf("%w: %v", model.ErrInvalidJSON, err)
+	}
+
+	record := Record{Tenant: services.DefaultTenant, Receipt: line}
+	if _, ok := fields["receipt"]; ok {
+		if err := json.Unmarshal(line, &record); err != nil {
+			return Record{}, fmt.Errorf("%w: %v", model.ErrInvalidJSON, err)
+		}
+		if record.FormatVersion > capture.FormatVersion {
+			return Record{}, ErrUnsupportedVersion
+		}
+		if record.Tenant == "" {
+			record.Tenant = services.DefaultTenant
+		}
+	}
+	return record, nil
+}
+
+func rejectionReason(err error) string {
+	switch {
+	case errors.Is(err, model.ErrInvalidJSON):
+		return model.ErrInvalidJSON.Error()
+	case errors.Is(err, model.ErrUnknownFields):
+		return model.ErrUnknownFields.Error()
+	case errors.Is(err, ErrUnsupportedVersion):
+		return ErrUnsupportedVersion.Error()
+	default:
+		return err.Error()
+	}
+}
+
+func distribution(points []int) Distribution {
+	d := Distribution{Count: len(points)}
+	for i, lower := range bucketBounds {
+		upper := -1
+		if i+1 < len(bucketBounds) {
+			upper = bucketBounds[i+1] - 1
+		}
+		d.Buckets = append(d.Buckets, Bucket{Min: lower, Max: upper})
+	}
+	if len(points) == 0 {
+		return d
+	}
+
+	sorted := append([]int(nil), points...)
+	sort.Ints(sorted)
+	d.Min = sorted[0]
+	d.Max = sorted[len(sorted)-1]
+	d.Median = sorted[len(sorted)/2]
+	d.P90 = sorted[(len(sorted)*9)/10]
+	for _, p := range sorted {
+		d.Sum += p
+		for i := len(d.Buckets) - 1; i >= 0; i-- {
+			if p >= d.Buckets[i].Min {
+				d.Buckets[i].Count++
+				break
+			}
+		}
+	}
+	d.Mean = float64(d.Sum) / float64(len(sorted))
+	return d
+}
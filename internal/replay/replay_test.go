@@ -0,0 +1,95 @@
+package replay
+
+import (
+	"receipt-processor/internal/services"
+	"strings"
+	"testing"
+)
+
+const receipt = `{"retailer": "Target", "purchaseDate": "2022-01-01", "purchaseTime": "13:01", "items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}, {"shortDescription": "Emils Cheese Pizza", "price": "12.25"}, {"shortDescription": "Knorr Creamy Chicken", "price": "1.26"}, {"shortDescription": "Doritos Nacho Cheese", "price": "3.35"}, {"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ", "price": "12.00"}], "total": "35.35"}`
+
+const evenDayReceipt = `{"retailer": "M&M Corner Market", "purchaseDate": "2022-03-20", "purchaseTime": "14:33", "items": [{"shortDescription": "Gatorade", "price": "2.25"}, {"shortDescription": "Gatorade", "price": "2.25"}, {"shortDescription": "Gatorade", "price": "2.25"}, {"shortDescription": "Gatorade", "price": "2.25"}], "total": "9.00"}`
+
+func recording(lines ...string) *strings.Reader {
+	return strings.NewReader(strings.Join(lines, "\n") + "\n")
+}
+
+func TestRun(t *testing.T) {
+	input := recording(
+		receipt,
+		`{"tenant": "partner-a", "receipt": `+receipt+`}`,
+		receipt, // duplicate for the default tenant
+		evenDayReceipt,
+		"",
+		`not json`,
+		`{"retailer": "Target", "extra": true}`,
+		`{"retailer": "Target"}`,
+	)
+
+	summary, err := Run(input, Options{Rulesets: &services.RulesetSet{Default: services.DefaultRuleset()}})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if summary.Total != 7 || summary.Accepted != 3 || summary.Duplicates != 1 {
+		t.Errorf("unexpected counts: %+v", summary)
+	}
+	if summary.Rejected["invalid JSON format"] != 1 || summary.Rejected["incorrect receipt data"] != 1 || len(summary.Rejected) != 3 {
+		t.Errorf("unexpected rejection reasons: %v", summary.Rejected)
+	}
+	if summary.Points.Count != 3 || summary.Points.Min != 28 || summary.Points.Max != 109 || summary.Points.Sum != 165 {
+		t.Errorf("unexpected points distribution: %+v", summary.Points)
+	}
+	if summary.Points.Buckets[1].Count != 2 || summary.Points.Buckets[3].Count != 1 {
+		t.Errorf("unexpected buckets: %+v", summary.Points.Buckets)
+	}
+	if summary.ComparePoints != nil || summary.Changes != nil {
+		t.Errorf("expected no comparison without a second ruleset")
+	}
+}
+
+func TestRun_Compare(t *testing.T) {
+	compare := services.DefaultRuleset()
+	compare.OddDayPoints = 20
+
+	summary, err := Run(recording(receipt, evenDayReceipt), Options{
+		Rulesets: &services.RulesetSet{Default: services.DefaultRuleset()},
+		Compare:  &services.RulesetSet{Default: compare},
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// Only the receipt with an odd purchase day is affected
+	if len(summary.Changes) != 1 {
+		t.Fatalf("expected 1 changed receipt; got %+v", summary.Changes)
+	}
+	change := summary.Changes[0]
+	if change.Line != 1 || change.Points != 28 || change.ComparePoints != 42 || change.Delta != 14 {
+		t.Errorf("unexpected change: %+v", change)
+	}
+	if summary.ComparePoints == nil || summary.ComparePoints.Sum != 151 {
+		t.Errorf("unexpected comparison distribution: %+v", summary.ComparePoints)
+	}
+}
+
+func TestRun_NoRulesets(t *testing.T) {
+	if _, err := Run(recording(receipt), Options{}); err == nil {
+		t.Errorf("expected error without rulesets")
+	}
+}
+
+func TestRun_CaptureRecords(t *testing.T) {
+	input := recording(
+		`{"formatVersion": 1, "capturedAt": "2024-05-01T12:00:00Z", "tenant": "partner-a", "receipt": `+receipt+`, "response": {"status": 200, "id": "abc", "points": 28}}`,
+		`{"formatVersion": 99, "tenant": "partner-a", "receipt": `+receipt+`}`,
+	)
+
+	summary, err := Run(input, Options{Rulesets: &services.RulesetSet{Default: services.DefaultRuleset()}})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if summary.Accepted != 1 || summary.Rejected[ErrUnsupportedVersion.Error()] != 1 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+}
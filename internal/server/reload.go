@@ -0,0 +1,113 @@
+package server
+
+import (
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/handler"
+	"receipt-processor/internal/ingest"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/ratelimit"
+	"receipt-processor/internal/services"
+	"receipt-processor/internal/utility"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reloader applies new rulesets, validation profile, CSV import columns, email
+// templates, log level and rate limits to a running server. A reload either
+// applies completely or not at all: everything is loaded and validated first,
+// and the running settings are kept on failure.
+type reloader struct {
+	mu      sync.Mutex
+	load    func() (*config.Config, error)
+	running *config.Config
+	limiter *ratelimit.Limiter
+	status  handler.ReloadStatus
+}
+
+func newReloader(running *config.Config, load func() (*config.Config, error), limiter *ratelimit.Limiter) *reloader {
+	return &reloader{
+		load:    load,
+		running: running,
+		limiter: limiter,
+		status: handler.ReloadStatus{
+			OK:             true,
+			LoadedAt:       time.Now().UTC(),
+			RulesetVersion: services.ActiveRulesets().Default.Version,
+		},
+	}
+}
+
+// Reload re-reads the configuration and rulesets file and swaps them in.
+// Requests already being scored keep the ruleset they started with.
+func (r *reloader) Reload(trigger string) handler.ReloadStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	r.status.Trigger = trigger
+	r.status.AttemptedAt = &now
+
+	cfg, err := r.load()
+	if err != nil {
+		return r.reject(err)
+	}
+	rulesets, err := services.LoadRulesets(cfg.RulesetsFile)
+	if err != nil {
+		return r.reject(err)
+	}
+	profile, err := cfg.ValidationRules()
+	if err != nil {
+		return r.reject(err)
+	}
+	columns, err := cfg.ImportColumns()
+	if err != nil {
+		return r.reject(err)
+	}
+	emailTemplates, err := ingest.LoadEmailTemplates(cfg.EmailTemplatesFile)
+	if err != nil {
+		return r.reject(err)
+	}
+
+	// Everything is valid; apply it. The level was checked by cfg.Validate.
+	_ = logger.SetLevel(cfg.LogLevel)
+	r.limiter.SetRules(ratelimit.Rule(cfg.RateLimit), rateLimitRules(cfg.RateLimitRoutes))
+	services.SetRulesets(rulesets)
+	utility.SetValidationProfile(profile)
+	handler.SetImportColumns(columns)
+	handler.SetEmailTemplates(emailTemplates)
+
+	r.status.OK = true
+	r.status.Error = ""
+	r.status.LoadedAt = now
+	r.status.RulesetVersion = rulesets.Default.Version
+	r.status.RestartRequired = r.running.RestartRequired(cfg)
+	logger.Info("Reloaded configuration", logrus.Fields{
+		"trigger":          trigger,
+		"log_level":        cfg.LogLevel,
+		"rulesets_file":    cfg.RulesetsFile,
+		"ruleset_version":  rulesets.Default.Version,
+		"validation":       profile.Name,
+		"email_templates":  len(emailTemplates.Templates),
+		"restart_required": r.status.RestartRequired,
+	})
+	return r.status
+}
+
+func (r *reloader) reject(err error) handler.ReloadStatus {
+	r.status.OK = false
+	r.status.Error = err.Error()
+	logger.Error("Reload rejected, keeping the current configuration", logrus.Fields{
+		"trigger": r.status.Trigger,
+		"error":   err,
+	})
+	return r.status
+}
+
+// Status returns the outcome of the most recent reload.
+func (r *reloader) Status() handler.ReloadStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
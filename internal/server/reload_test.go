@@ -0,0 +1,81 @@
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"receipt-processor/internal/config"
+	"receipt-processor/internal/ratelimit"
+	"receipt-processor/internal/services"
+	"receipt-processor/internal/utility"
+	"testing"
+)
+
+func TestReloader(t *testing.T) {
+	defer services.SetRulesets(&services.RulesetSet{Default: services.DefaultRuleset()})
+	defer utility.SetValidationProfile(utility.CurrentValidationProfile())
+
+	path := filepath.Join(t.TempDir(), "rulesets.json")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"default": {"version": "v1"}}`)
+	rulesets, err := services.LoadRulesets(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	services.SetRulesets(rulesets)
+
+	running := config.Default()
+	running.RulesetsFile = path
+	next := *running
+	var loadErr error
+	load := func() (*config.Config, error) {
+		cfg := next
+		return &cfg, loadErr
+	}
+	r := newReloader(running, load, ratelimit.New(ratelimit.Config{}))
+
+	// A valid file is swapped in
+	write(`{"default": {"version": "v2", "oddDayPoints": 8}}`)
+	next.AppPort = "9000"
+	next.ValidationProfile = utility.ProfileStrict
+	status := r.Reload("test")
+	if !status.OK || status.RulesetVersion != "v2" || services.RulesetFor(services.DefaultTenant).OddDayPoints != 8 {
+		t.Fatalf("expected the new rulesets to be active; got %+v", status)
+	}
+	if utility.CurrentValidationProfile().Name != utility.ProfileStrict {
+		t.Errorf("expected the strict validation profile to be active")
+	}
+	if len(status.RestartRequired) != 1 || status.RestartRequired[0] != "app_port" {
+		t.Errorf("expected app_port to need a restart; got %v", status.RestartRequired)
+	}
+
+	// An invalid file is rejected and the old rulesets kept
+	write(`{"default": {"descriptionLengthMultiple": 0}}`)
+	status = r.Reload("test")
+	if status.OK || status.Error == "" {
+		t.Errorf("expected the reload to be rejected; got %+v", status)
+	}
+	if services.ActiveRulesets().Default.Version != "v2" || status.RulesetVersion != "v2" {
+		t.Errorf("expected v2 to stay active; got %s", services.ActiveRulesets().Default.Version)
+	}
+
+	// As is one with a misspelt setting
+	write(`{"default": {"version": "v3", "maxReceiptPoint": 100}}`)
+	if status = r.Reload("test"); status.OK || services.ActiveRulesets().Default.Version != "v2" {
+		t.Errorf("expected an unknown field to be rejected; got %+v", status)
+	}
+
+	// So is an invalid config
+	write(`{"default": {"version": "v3"}}`)
+	loadErr = errors.New("log_level: invalid")
+	if status = r.Reload("test"); status.OK || services.ActiveRulesets().Default.Version != "v2" {
+		t.Errorf("expected an invalid config to be rejected; got %+v", status)
+	}
+	if got := r.Status(); got.Error != "log_level: invalid" {
+		t.Errorf("expected Status to report the last failure; got %+v", got)
+	}
+}
@@ -2,36 +2,180 @@ package server
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"receipt-processor/internal/auth"
+	"receipt-processor/internal/capture"
 	"receipt-processor/internal/config"
+	"receipt-processor/internal/grpcapi"
 	"receipt-processor/internal/handler"
+	"receipt-processor/internal/ingest"
 	"receipt-processor/internal/logger"
+	"receipt-processor/internal/ratelimit"
+	"receipt-processor/internal/services"
+	"receipt-processor/internal/tenant"
+	"receipt-processor/internal/utility"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 )
 
-// Run sets up and starts the HTTP server.
-func Run() error {
-	// Load configuration
-	cfg := config.LoadConfig()
+// Run sets up and starts the HTTP server with the given configuration. On
+// SIGHUP or POST /admin/reload, load is called for the new configuration and
+// the rulesets, validation profile, import settings, log level and rate
+// limits are swapped in. A nil load only re-reads the rulesets file.
+func Run(cfg *config.Config, load func() (*config.Config, error)) error {
+	keys, err := auth.LoadKeys(cfg.APIKeysFile, cfg.APIKeys)
+	if err != nil {
+		return err
+	}
+	authenticator, err := auth.NewAuthenticator(keys)
+	if err != nil {
+		return err
+	}
+	if !authenticator.Enabled() {
+		logger.Warn("No API keys configured, receipt endpoints are unauthenticated", logrus.Fields{})
+	}
+
+	rulesets, err := services.LoadRulesets(cfg.RulesetsFile)
+	if err != nil {
+		return err
+	}
+	services.SetRulesets(rulesets)
+	profile, err := cfg.ValidationRules()
+	if err != nil {
+		return err
+	}
+	utility.SetValidationProfile(profile)
+	columns, err := cfg.ImportColumns()
+	if err != nil {
+		return err
+	}
+	handler.SetImportColumns(columns)
+	emailTemplates, err := ingest.LoadEmailTemplates(cfg.EmailTemplatesFile)
+	if err != nil {
+		return err
+	}
+	handler.SetEmailTemplates(emailTemplates)
+
+	// Restore persisted receipts and keep the snapshot up to date
+	if cfg.StoreFile != "" {
+		if err := services.LoadSnapshot(cfg.StoreFile); err != nil {
+			return err
+		}
+		stopFlusher := startStoreFlusher(cfg.StoreFile, cfg.StoreFlushInterval)
+		defer stopFlusher()
+	}
+
+	trustedProxies, err := ratelimit.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	limiter := ratelimit.New(ratelimit.Config{
+		Default:        ratelimit.Rule(cfg.RateLimit),
+		Routes:         rateLimitRules(cfg.RateLimitRoutes),
+		TrustedProxies: trustedProxies,
+		IdleTTL:        cfg.RateLimitIdleTTL,
+		Authenticator:  authenticator,
+	})
+	limiter.StartEviction(time.Minute)
+	defer limiter.Stop()
+
+	// Optionally capture sampled process requests for later replay
+	processReceipt := http.Handler(http.HandlerFunc(handler.ProcessReceipt))
+	if cfg.CaptureFile != "" {
+		captureWriter, err := capture.NewRotatingWriter(cfg.CaptureFile, cfg.CaptureMaxBytes, cfg.CaptureMaxBackups)
+		if err != nil {
+			return err
+		}
+		defer captureWriter.Close()
+		recorder := capture.NewRecorder(captureWriter, capture.Config{
+			SampleRate: cfg.CaptureSampleRate,
+			Redact:     cfg.CaptureRedact,
+		})
+		processReceipt = recorder.Middleware(processReceipt)
+		logger.Info("Capturing process requests", logrus.Fields{
+			"file":        cfg.CaptureFile,
+			"sample_rate": cfg.CaptureSampleRate,
+		})
+	}
+
+	if load == nil {
+		load = func() (*config.Config, error) { return cfg, nil }
+	}
+	reload := newReloader(cfg, load, limiter)
+	handler.SetReloader(reload)
 
 	// Initialize router and handlers
 	r := mux.NewRouter()
 	r.Use(loggingMiddleware)
+	r.Use(maxBodyMiddleware(cfg.MaxBodyBytes))
+
+	// Receipt API routes are rate limited; health probes are not
+	api := r.PathPrefix("/receipts").Subrouter()
+	api.Use(limiter.Middleware)
+	protect := func(scope string, h http.Handler) http.Handler {
+		return authenticator.Require(scope, tenant.Middleware(h))
+	}
+	api.Handle("/process", protect(auth.ScopeReceiptsWrite, processReceipt)).Methods("POST")
+	api.Handle("/email", protect(auth.ScopeReceiptsWrite, http.HandlerFunc(handler.ProcessEmail))).Methods("POST")
+	api.Handle("/import", protect(auth.ScopeReceiptsWrite, http.HandlerFunc(handler.ImportReceipts))).Methods("POST")
+	api.Handle("/score", protect(auth.ScopeReceiptsRead, http.HandlerFunc(handler.ScoreReceipt))).Methods("POST")
+	api.Handle("/{id}/points", protect(auth.ScopeReceiptsRead, http.HandlerFunc(handler.GetPoints))).Methods("GET")
+	api.Handle("/{id}", protect(auth.ScopeReceiptsRead, http.HandlerFunc(handler.GetReceipt))).Methods("GET")
+	api.Handle("", protect(auth.ScopeReceiptsRead, http.HandlerFunc(handler.ListReceipts))).Methods("GET")
+
+	stores := r.PathPrefix("/stores").Subrouter()
+	stores.Use(limiter.Middleware)
+	stores.Handle("", protect(auth.ScopeReceiptsRead, http.HandlerFunc(handler.ListStores))).Methods("GET")
+
+	admin := r.PathPrefix("/admin").Subrouter()
+	admin.Use(limiter.Middleware)
+	admin.Handle("/reload", authenticator.Require(auth.ScopeAdmin, http.HandlerFunc(handler.Reload))).Methods("POST")
+	admin.Handle("/reload", authenticator.Require(auth.ScopeAdmin, http.HandlerFunc(handler.GetReloadStatus))).Methods("GET")
 
-	r.HandleFunc("/receipts/process", handler.ProcessReceipt).Methods("POST")
-	r.HandleFunc("/receipts/{id}/points", handler.GetPoints).Methods("GET")
 	r.HandleFunc("/health", handler.HealthCheck).Methods("GET")
+	r.HandleFunc("/livez", handler.Livez).Methods("GET")
+	r.HandleFunc("/readyz", handler.Readyz).Methods("GET")
+
+	handler.RegisterReadinessCheck("store", services.CheckStore)
+	handler.RegisterReadinessCheck("ruleset", services.CheckRulesets)
 
 	// Configure HTTP server
 	server := &http.Server{
-		Addr:    ":" + cfg.AppPort,
-		Handler: r,
+		Addr:              ":" + cfg.AppPort,
+		Handler:           r,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+
+	// The gRPC API shares the services, keys, tenants and rate limiter with
+	// the REST routes, so reloaded limits apply to both
+	var grpcServer *grpc.Server
+	if cfg.GRPCPort != "" {
+		listener, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+		if err != nil {
+			return err
+		}
+		grpcServer = grpcapi.NewServer(authenticator, limiter, int(cfg.MaxBodyBytes))
+		go func() {
+			logger.Info("gRPC server starting", logrus.Fields{
+				"port": cfg.GRPCPort,
+			})
+			if err := grpcServer.Serve(listener); err != nil {
+				logger.Error("Error starting gRPC server", logrus.Fields{
+					"error": err,
+				})
+			}
+		}()
 	}
 
 	// Channel to handle system signals for graceful shutdown
@@ -49,13 +193,32 @@ func Run() error {
 		}
 	}()
 
+	// Reload rulesets and reloadable config on SIGHUP
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	defer signal.Stop(hupChan)
+	go func() {
+		for range hupChan {
+			reload.Reload("sighup")
+		}
+	}()
+
 	<-stopChan
-	logger.Info("Shutting down server", logrus.Fields{})
+	logger.Info("Shutting down server", logrus.Fields{
+		"drain_delay": cfg.ShutdownDrainDelay.String(),
+	})
+
+	// Fail readiness first so load balancers stop routing new traffic to us
+	handler.SetShuttingDown(true)
+	time.Sleep(cfg.ShutdownDrainDelay)
 
 	// Graceful shutdown with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	if grpcServer != nil {
+		stopGRPC(ctx, grpcServer)
+	}
 	if err := server.Shutdown(ctx); err != nil {
 		logger.Error("Server shutdown failed", logrus.Fields{
 			"error": err,
@@ -67,6 +230,63 @@ func Run() error {
 	return nil
 }
 
+// startStoreFlusher periodically saves the store to path when it has changed.
+// The returned function stops the flusher and performs a final save.
+func startStoreFlusher(path string, interval time.Duration) func() {
+	saved := services.StoreRevision()
+	flush := func() {
+		if services.StoreRevision() == saved {
+			return
+		}
+		revision, err := services.SaveSnapshot(path)
+		if err != nil {
+			logger.Error("Failed to save store snapshot", logrus.Fields{
+				"path":  path,
+				"error": err,
+			})
+			return
+		}
+		saved = revision
+	}
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				flush()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+		flush()
+	}
+}
+
+// stopGRPC lets in-flight gRPC calls finish, stopping the server outright if
+// ctx expires first.
+func stopGRPC(ctx context.Context, server *grpc.Server) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
+
 // loggingMiddleware logs the HTTP requests.
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -77,3 +297,25 @@ func loggingMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// rateLimitRules converts per-route limits from the config into limiter rules.
+func rateLimitRules(routes map[string]config.RateLimit) map[string]ratelimit.Rule {
+	rules := make(map[string]ratelimit.Rule, len(routes))
+	for route, limit := range routes {
+		rules[route] = ratelimit.Rule(limit)
+	}
+	return rules
+}
+
+// maxBodyMiddleware caps the size of request bodies so a huge upload cannot
+// exhaust memory. Reads past the limit fail with *http.MaxBytesError.
+func maxBodyMiddleware(limit int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"receipt-processor/internal/model"
+	"strings"
+	"testing"
+)
+
+func yenReceipt() model.Receipt {
+	return model.Receipt{
+		Retailer:     "Lawson",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "10:00",
+		Items:        []model.Item{{ShortDescription: "Onigiri", Price: "1500"}}, // 7 characters
+		Total:        "1500",
+		Currency:     "JPY",
+	}
+}
+
+func TestScoreReceipt_Currency(t *testing.T) {
+	rs := DefaultRuleset()
+	rs.DescriptionLengthMultiple = 7
+	rs.CurrencyRates = map[string]float64{"JPY": 0.0067}
+
+	score := ScoreReceipt(yenReceipt(), rs)
+	// 6 retailer + ceil(1500*0.0067*0.2) = 3; yen has no minor units, so the
+	// round total and quarter multiple rules do not apply
+	if score.Points != 6+3 {
+		t.Errorf("expected %d points; got %d\n%s", 6+3, score.Points, score.Explanation())
+	}
+	if hasRule(score, RuleRoundTotal) || hasRule(score, RuleQuarterMultiple) {
+		t.Errorf("expected no total rules for yen; got\n%s", score.Explanation())
+	}
+	if !strings.Contains(score.Explanation(), "item price of 1500 JPY = 10.05 USD") {
+		t.Errorf("expected explanation to convert the item price; got %q", score.Explanation())
+	}
+
+	// A ruleset whose base currency is the receipt's needs no rate
+	rs.CurrencyRates = nil
+	rs.BaseCurrency = "JPY"
+	if score := ScoreReceipt(yenReceipt(), rs); score.Points != 6+300 {
+		t.Errorf("expected %d points in yen; got %d\n%s", 6+300, score.Points, score.Explanation())
+	}
+
+	// Currencies with three decimals keep both rules
+	receipt := yenReceipt()
+	receipt.Currency, receipt.Total, receipt.Items[0].Price = "KWD", "2.000", "2.000"
+	rs = DefaultRuleset()
+	rs.CurrencyRates = map[string]float64{"KWD": 3.25}
+	score = ScoreReceipt(receipt, rs)
+	if !hasRule(score, RuleRoundTotal) || !hasRule(score, RuleQuarterMultiple) ||
+		!strings.Contains(score.Explanation(), "total is a whole number of KWD") {
+		t.Errorf("expected both total rules for a whole KWD amount; got\n%s", score.Explanation())
+	}
+}
+
+func TestScoreReceipt_MinSpendConverted(t *testing.T) {
+	rs := DefaultRuleset()
+	rs.CurrencyRates = map[string]float64{"JPY": 0.0067}
+	rs.MinSpend = 20 // dollars; 1500 yen is 10.05
+	score := ScoreReceipt(yenReceipt(), rs)
+	if score.Points != 0 || !strings.Contains(score.Explanation(), "1500 JPY (10.05 USD) is below the minimum spend of 20.00") {
+		t.Errorf("expected the minimum spend to apply in USD; got %d\n%s", score.Points, score.Explanation())
+	}
+}
+
+func TestValidateReceipt_Currency(t *testing.T) {
+	rs := DefaultRuleset()
+	if err := ValidateReceipt(yenReceipt(), rs); err == nil || !strings.Contains(err.Error(), "no exchange rate") {
+		t.Errorf("expected a currency without a rate to be rejected; got %v", err)
+	}
+	rs.CurrencyRates = map[string]float64{"JPY": 0.0067}
+	if err := ValidateReceipt(yenReceipt(), rs); err != nil {
+		t.Errorf("expected the receipt to be accepted; got %v", err)
+	}
+
+	for name, edit := range map[string]func(rs *Ruleset){
+		"unknown base":  func(rs *Ruleset) { rs.BaseCurrency = "ABC" },
+		"unknown rate":  func(rs *Ruleset) { rs.CurrencyRates = map[string]float64{"ABC": 1} },
+		"negative rate": func(rs *Ruleset) { rs.CurrencyRates = map[string]float64{"JPY": -1} },
+	} {
+		rs := DefaultRuleset()
+		edit(&rs)
+		if err := rs.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
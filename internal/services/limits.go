@@ -0,0 +1,80 @@
+package services
+
+import (
+	"receipt-processor/internal/model"
+	"sort"
+	"strconv"
+)
+
+// applyRuleCaps limits the points of each rule named in caps, adding a
+// negative cap line for every rule over its cap. The promotion rule is capped
+// separately, after promotions have been evaluated.
+func applyRuleCaps(score *Score, caps map[string]int, promotions bool) {
+	rules := make([]string, 0, len(caps))
+	for rule := range caps {
+		if (rule == RulePromotion) == promotions {
+			rules = append(rules, rule)
+		}
+	}
+	sort.Strings(rules)
+
+	for _, rule := range rules {
+		earned := 0
+		for _, result := range score.Breakdown {
+			if result.Rule == rule {
+				earned += result.Points
+			}
+		}
+		if limit := caps[rule]; earned > limit {
+			score.add(RuleResult{
+				Rule:   RuleCap,
+				Points: limit - earned,
+				Reason: rule + " points capped at " + strconv.Itoa(limit),
+				Detail: strconv.Itoa(earned) + " points earned before the cap",
+			})
+		}
+	}
+}
+
+// applyLimits applies the receipt-wide limits of rs, in order: the minimum
+// spend, the per-receipt maximum and the customer's daily maximum.
+func applyLimits(score *Score, receipt model.Receipt, rs Ruleset, history CustomerHistory) {
+	if rs.MinSpend > 0 {
+		total, err := strconv.ParseFloat(receipt.Total, 64)
+		base, ok := rs.ToBaseCurrency(total, receipt.Currency)
+		if err != nil || !ok || base < rs.MinSpend {
+			totalText := receipt.Total
+			if currency := receiptCurrency(receipt); currency != rs.baseCurrency() {
+				totalText += " " + currency + " (" + strconv.FormatFloat(base, 'f', 2, 64) + " " + rs.baseCurrency() + ")"
+			}
+			capPoints(score, 0, "total of "+totalText+" is below the minimum spend of "+strconv.FormatFloat(rs.MinSpend, 'f', 2, 64))
+			score.Promotions = nil // nothing was awarded, so no promotion was used
+			return
+		}
+	}
+	if rs.MaxReceiptPoints > 0 {
+		capPoints(score, rs.MaxReceiptPoints, "receipt points capped at "+strconv.Itoa(rs.MaxReceiptPoints))
+	}
+	if rs.MaxCustomerDailyPoints > 0 && receipt.CustomerID != "" && history != nil {
+		earned := history.PointsOn(receipt.CustomerID, receipt.PurchaseDate)
+		capPoints(score, max(rs.MaxCustomerDailyPoints-earned, 0),
+			"customer daily maximum of "+strconv.Itoa(rs.MaxCustomerDailyPoints)+" points ("+
+				strconv.Itoa(earned)+" already earned on "+receipt.PurchaseDate+")")
+	}
+	if score.Points == 0 {
+		// A receipt capped to nothing does not use up a promotion either
+		score.Promotions = nil
+	}
+}
+
+// capPoints adds a cap line bringing the score down to limit, if it is above.
+func capPoints(score *Score, limit int, reason string) {
+	if score.Points <= limit {
+		return
+	}
+	score.add(RuleResult{
+		Rule:   RuleCap,
+		Points: limit - score.Points,
+		Reason: reason,
+	})
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"fmt"
+	"receipt-processor/internal/model"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// dailyHistory reports the same points for every customer and date.
+type dailyHistory int
+
+func (h dailyHistory) PromotionUses(customerID, promotionID string) int {
+	return 0
+}
+
+func (h dailyHistory) PointsOn(customerID, date string) int {
+	return int(h)
+}
+
+func TestScoreReceipt_Limits(t *testing.T) {
+	// promotionTestReceipt scores 109: 14 retailer_name, 50 round_total,
+	// 25 quarter_multiple, 10 item_pairs and 10 afternoon_window.
+	tests := []struct {
+		name    string
+		edit    func(rs *Ruleset)
+		history CustomerHistory
+		want    int
+		reason  string
+	}{
+		{"no limits", func(rs *Ruleset) {}, nil, 109, ""},
+		{"rule cap", func(rs *Ruleset) { rs.RuleCaps = map[string]int{RuleRetailerName: 5} }, nil, 100, "retailer_name points capped at 5"},
+		{"rule cap not reached", func(rs *Ruleset) { rs.RuleCaps = map[string]int{RuleRoundTotal: 50} }, nil, 109, ""},
+		{"promotion cap", func(rs *Ruleset) {
+			rs.Promotions = []Promotion{{ID: "big", Bonus: 500}}
+			rs.RuleCaps = map[string]int{RulePromotion: 100}
+		}, nil, 209, "promotion points capped at 100"},
+		{"multiplier uses capped base", func(rs *Ruleset) {
+			rs.Promotions = []Promotion{{ID: "double", Multiplier: 2}}
+			rs.RuleCaps = map[string]int{RuleRoundTotal: 0}
+		}, nil, 118, "round_total points capped at 0"},
+		{"receipt maximum", func(rs *Ruleset) { rs.MaxReceiptPoints = 60 }, nil, 60, "receipt points capped at 60"},
+		{"below minimum spend", func(rs *Ruleset) { rs.MinSpend = 10 }, nil, 0, "below the minimum spend of 10.00"},
+		{"meets minimum spend", func(rs *Ruleset) { rs.MinSpend = 9 }, nil, 109, ""},
+		{"daily maximum", func(rs *Ruleset) { rs.MaxCustomerDailyPoints = 150 }, dailyHistory(100), 50, "customer daily maximum of 150 points"},
+		{"daily maximum used up", func(rs *Ruleset) { rs.MaxCustomerDailyPoints = 150 }, dailyHistory(200), 0, "200 already earned on 2022-03-20"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := DefaultRuleset()
+			tt.edit(&rs)
+			if err := rs.Validate(); err != nil {
+				t.Fatalf("invalid ruleset: %v", err)
+			}
+			receipt := promotionTestReceipt
+			receipt.CustomerID = "cust-1"
+			score := ScoreReceiptFor(receipt, rs, tt.history)
+			if score.Points != tt.want {
+				t.Errorf("expected %d points; got %d\n%s", tt.want, score.Points, score.Explanation())
+			}
+			if tt.reason != "" && !strings.Contains(score.Explanation(), tt.reason) {
+				t.Errorf("expected explanation to contain %q; got %q", tt.reason, score.Explanation())
+			}
+		})
+	}
+}
+
+func TestScoreReceipt_MinSpendDropsPromotions(t *testing.T) {
+	rs := DefaultRuleset()
+	rs.MinSpend = 20
+	rs.Promotions = []Promotion{{ID: "bonus", Bonus: 100}}
+	score := ScoreReceipt(promotionTestReceipt, rs)
+	if score.Points != 0 || len(score.Promotions) != 0 {
+		t.Errorf("expected 0 points and no promotions; got %d %v", score.Points, score.Promotions)
+	}
+}
+
+func TestProcessReceipt_DailyMaximumKeepsPromotion(t *testing.T) {
+	ResetStore()
+	defer ResetStore()
+	rs := DefaultRuleset()
+	rs.MaxCustomerDailyPoints = 100
+	rs.Promotions = []Promotion{{ID: "target", Retailers: []string{"Target"}, Bonus: 100, PerCustomerLimit: 1}}
+
+	receipt := func(retailer, date string) model.Receipt {
+		r := promotionTestReceipt
+		r.Retailer, r.PurchaseDate, r.CustomerID = retailer, date, "cust-1"
+		return r
+	}
+	// The first receipt uses up the day; the second is capped to 0 points
+	ProcessReceipt("daily-promo", receipt("M&M Corner Market", "2022-03-20"), rs, "")
+	_, capped, _ := ProcessReceipt("daily-promo", receipt("Target", "2022-03-20"), rs, "")
+	if capped.Points != 0 || len(capped.Promotions) != 0 {
+		t.Errorf("expected a receipt capped to 0 to use no promotion; got %d %v", capped.Points, capped.Promotions)
+	}
+
+	// The promotion is still available on another day
+	_, next, _ := ProcessReceipt("daily-promo", receipt("Target", "2022-03-21"), rs, "")
+	if len(next.Promotions) != 1 || !strings.Contains(next.Explanation, "100 bonus points") {
+		t.Errorf("expected the promotion to apply on the next day; got %v\n%s", next.Promotions, next.Explanation)
+	}
+}
+
+func TestCustomerHistoryFor_PointsOn(t *testing.T) {
+	ResetStore()
+	defer ResetStore()
+
+	receipt := promotionTestReceipt
+	receipt.CustomerID = "cust-1"
+	StoreReceipt("acme", "r1", "h1", model.ReceiptDetails{Points: 40, Receipt: &receipt})
+	StoreReceipt("acme", "r2", "h2", model.ReceiptDetails{Points: 60, Receipt: &receipt})
+
+	history := CustomerHistoryFor("acme")
+	if got := history.PointsOn("cust-1", receipt.PurchaseDate); got != 100 {
+		t.Errorf("expected 100 points; got %d", got)
+	}
+	if got := history.PointsOn("cust-1", "2022-03-21"); got != 0 {
+		t.Errorf("expected 0 points on another day; got %d", got)
+	}
+}
+
+func TestRuleset_ValidateLimits(t *testing.T) {
+	for name, edit := range map[string]func(rs *Ruleset){
+		"unknown rule":      func(rs *Ruleset) { rs.RuleCaps = map[string]int{"bogus": 1} },
+		"negative cap":      func(rs *Ruleset) { rs.RuleCaps = map[string]int{RuleOddDay: -1} },
+		"negative maximum":  func(rs *Ruleset) { rs.MaxReceiptPoints = -1 },
+		"negative minSpend": func(rs *Ruleset) { rs.MinSpend = -0.01 },
+	} {
+		rs := DefaultRuleset()
+		edit(&rs)
+		if err := rs.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+// Test that concurrent receipts of one customer on one day cannot exceed the
+// daily maximum between them. Run with -race.
+func TestProcessReceipt_DailyMaximumConcurrent(t *testing.T) {
+	ResetStore()
+	defer ResetStore()
+	rs := DefaultRuleset()
+	rs.MaxCustomerDailyPoints = 50
+
+	// Several threads make the submissions overlap even on a single CPU
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			// Each receipt scores at least 6 points for the retailer name
+			ProcessReceipt("daily", model.Receipt{
+				Retailer:     "Target",
+				PurchaseDate: "2022-03-20",
+				PurchaseTime: "10:00",
+				Items:        []model.Item{{ShortDescription: "Pepsi", Price: fmt.Sprintf("%d.01", i+1)}},
+				Total:        fmt.Sprintf("%d.01", i+1),
+				CustomerID:   "cust-1",
+			}, rs, "")
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	total := 0
+	for _, details := range receiptDetails["daily"] {
+		total += details.Points
+	}
+	if total != 50 {
+		t.Errorf("expected the customer's receipts to earn the daily maximum of 50 points; got %d", total)
+	}
+}
@@ -4,29 +4,118 @@ import (
 	"math"
 	"receipt-processor/internal/logger"
 	"receipt-processor/internal/model"
-	"regexp"
+	"receipt-processor/internal/utility"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/sirupsen/logrus"
 )
 
-func CalculatePoints(receipt model.Receipt) (int, string) {
-	points := 0
-	explanation := "Breakdown:\n"
-
-	// Alphanumeric characters in the retailer name
-	retailerChars := regexp.MustCompile(`[a-zA-Z0-9]+`).FindAllString(receipt.Retailer, -1)
-	numChars := 0
-	for _, match := range retailerChars {
-		numChars += len(match) // Count characters in each match
+// Names of the scoring rules as they appear in a structured breakdown.
+const (
+	RuleRetailerName    = "retailer_name"
+	RuleRoundTotal      = "round_total"
+	RuleQuarterMultiple = "quarter_multiple"
+	RuleItemPairs       = "item_pairs"
+	RuleItemDescription = "item_description"
+	RuleOddDay          = "odd_day"
+	RuleAfternoon       = "afternoon_window"
+	RulePaymentMethod   = "payment_method"
+	RuleCap             = "cap" // negative adjustment made by a limit
+)
+
+// knownRules are the rule names that ruleCaps may refer to.
+var knownRules = map[string]bool{
+	RuleRetailerName:    true,
+	RuleRoundTotal:      true,
+	RuleQuarterMultiple: true,
+	RuleItemPairs:       true,
+	RuleItemDescription: true,
+	RuleOddDay:          true,
+	RuleAfternoon:       true,
+	RulePaymentMethod:   true,
+	RulePromotion:       true,
+}
+
+// RuleResult is one line of a points breakdown.
+type RuleResult struct {
+	Rule      string `json:"rule"`
+	Points    int    `json:"points"`
+	Reason    string `json:"reason"`
+	Detail    string `json:"detail,omitempty"`
+	Promotion string `json:"promotion,omitempty"` // promotion ID for promotion lines
+}
+
+// Score is the outcome of applying a ruleset to a receipt.
+type Score struct {
+	Points     int          `json:"points"`
+	Breakdown  []RuleResult `json:"breakdown"`
+	Promotions []string     `json:"promotions,omitempty"` // IDs of promotions that awarded points
+}
+
+// Explanation renders the breakdown in the human-readable form returned by the
+// points endpoint when detailed=true.
+func (s Score) Explanation() string {
+	var b strings.Builder
+	b.WriteString("Breakdown:\n")
+	for _, result := range s.Breakdown {
+		// Item description lines have always said "Points", and clients match
+		// on the explanation text
+		label := " points - "
+		if result.Rule == RuleItemDescription {
+			label = " Points - "
+		}
+		b.WriteString(strconv.Itoa(result.Points) + label + result.Reason + "\n")
+		if result.Detail != "" {
+			b.WriteString("          " + result.Detail + "\n")
+		}
 	}
-	points += numChars
-	explanation += strconv.Itoa(numChars) + " points - retailer name has " + strconv.Itoa(numChars) + " alphanumeric characters\n"
+	b.WriteString("  + ---------\n  = " + strconv.Itoa(s.Points) + " points")
+	return b.String()
+}
+
+func (s *Score) add(result RuleResult) {
+	s.Points += result.Points
+	s.Breakdown = append(s.Breakdown, result)
+}
+
+// CalculatePoints scores a receipt with the active default ruleset.
+func CalculatePoints(receipt model.Receipt) (int, string) {
+	return CalculatePointsWithRuleset(receipt, RulesetFor(DefaultTenant))
+}
+
+// CalculatePointsWithRuleset scores a receipt with the given ruleset and
+// returns the points along with a human-readable breakdown.
+func CalculatePointsWithRuleset(receipt model.Receipt, rs Ruleset) (int, string) {
+	score := ScoreReceipt(receipt, rs)
+	return score.Points, score.Explanation()
+}
+
+// ScoreReceipt applies every rule in rs to the receipt and returns the total
+// points with a structured breakdown. Per-customer limits are not enforced;
+// use ScoreReceiptFor for that.
+func ScoreReceipt(receipt model.Receipt, rs Ruleset) Score {
+	return ScoreReceiptFor(receipt, rs, nil)
+}
+
+// ScoreReceiptFor is ScoreReceipt with the customer's history, which is
+// consulted for per-customer promotion and daily limits. history may be nil.
+func ScoreReceiptFor(receipt model.Receipt, rs Ruleset, history CustomerHistory) Score {
+	var score Score
+
+	// Alphanumeric characters in the retailer name, in any script unless the
+	// strict validation profile is active
+	numChars := utility.CountAlphanumeric(receipt.Retailer)
+	score.add(RuleResult{
+		Rule:   RuleRetailerName,
+		Points: numChars * rs.RetailerCharPoints,
+		Reason: "retailer name has " + strconv.Itoa(numChars) + " alphanumeric characters",
+	})
 	logger.Info("Calculated points for retailer name", logrus.Fields{
 		"retailer": receipt.Retailer,
-		"points":   numChars,
+		"points":   numChars * rs.RetailerCharPoints,
 	})
 
 	// Round dollar amount
@@ -36,47 +125,82 @@ func CalculatePoints(receipt model.Receipt) (int, string) {
 			"total": receipt.Total,
 			"error": err,
 		})
+	} else if minor, _ := utility.MinorUnits(receiptCurrency(receipt)); minor == 0 {
+		// Every amount in a currency without minor units, such as JPY, would be
+		// both round and a multiple of 0.25, so neither rule applies
+		logger.Info("Skipped total rules for currency without minor units", logrus.Fields{
+			"currency": receiptCurrency(receipt),
+			"total":    total,
+		})
 	} else {
+		// Both total rules look at the amount in the receipt's own currency
 		if total == math.Floor(total) {
-			points += 50
-			explanation += "50 points - total is a round dollar amount\n"
+			score.add(RuleResult{
+				Rule:   RuleRoundTotal,
+				Points: rs.RoundTotalPoints,
+				Reason: roundTotalReason(receiptCurrency(receipt)),
+			})
 		}
 		if math.Mod(total*100, 25) == 0 {
-			points += 25
-			explanation += "25 points - total is a multiple of 0.25\n"
+			score.add(RuleResult{
+				Rule:   RuleQuarterMultiple,
+				Points: rs.QuarterMultiplePoints,
+				Reason: "total is a multiple of 0.25",
+			})
 		}
 		logger.Info("Added points for total", logrus.Fields{
-			"round_total_points":      50,
-			"multiple_of_0.25_points": 25,
+			"round_total_points":      rs.RoundTotalPoints,
+			"multiple_of_0.25_points": rs.QuarterMultiplePoints,
 			"total":                   total,
 		})
 	}
 
 	// Points for every two items
 	itemPairs := len(receipt.Items) / 2
-	points += itemPairs * 5
-	explanation += strconv.Itoa(itemPairs*5) + " points - " + strconv.Itoa(len(receipt.Items)) + " items (2 pairs @ 5 points each)\n"
+	score.add(RuleResult{
+		Rule:   RuleItemPairs,
+		Points: itemPairs * rs.ItemPairPoints,
+		Reason: strconv.Itoa(len(receipt.Items)) + " items (" + strconv.Itoa(itemPairs) + " pairs @ " +
+			strconv.Itoa(rs.ItemPairPoints) + " points each)",
+	})
 	logger.Info("Added points for item pairs", logrus.Fields{
 		"item_count": len(receipt.Items),
-		"points":     itemPairs * 5,
+		"points":     itemPairs * rs.ItemPairPoints,
 	})
 
 	// Points based on item descriptions
 	for _, item := range receipt.Items {
+		// Length is in characters, which for ASCII is the byte length
 		trimmedDescription := strings.TrimSpace(item.ShortDescription)
-		if len(trimmedDescription)%3 == 0 {
+		descriptionLength := utf8.RuneCountInString(trimmedDescription)
+		if descriptionLength%rs.DescriptionLengthMultiple == 0 {
 			itemPrice, err := strconv.ParseFloat(item.Price, 64)
 			if err != nil {
 				logger.Error("Error parsing item price", logrus.Fields{
 					"price": item.Price,
 					"error": err,
 				})
+			} else if basePrice, ok := rs.ToBaseCurrency(itemPrice, receipt.Currency); !ok {
+				logger.Error("No exchange rate for item price", logrus.Fields{
+					"currency":      receipt.Currency,
+					"base_currency": rs.baseCurrency(),
+				})
 			} else {
-				itemPoints := int(math.Ceil(itemPrice * 0.2))
-				points += itemPoints
-				explanation += strconv.Itoa(itemPoints) + " Points - \"" + trimmedDescription + "\" is " +
-					strconv.Itoa(len(trimmedDescription)) + " characters (a multiple of 3)\n" +
-					"          item price of " + item.Price + " * 0.2 = " + strconv.FormatFloat(itemPrice*0.2, 'f', 2, 64) + ", rounded up is " + strconv.Itoa(itemPoints) + " points\n"
+				priceText := item.Price
+				if currency := receiptCurrency(receipt); currency != rs.baseCurrency() {
+					priceText += " " + currency + " = " + strconv.FormatFloat(basePrice, 'f', 2, 64) + " " + rs.baseCurrency()
+				}
+				itemPrice = basePrice
+				itemPoints := int(math.Ceil(itemPrice * rs.DescriptionPriceMultiplier))
+				score.add(RuleResult{
+					Rule:   RuleItemDescription,
+					Points: itemPoints,
+					Reason: "\"" + trimmedDescription + "\" is " + strconv.Itoa(descriptionLength) +
+						" characters (a multiple of " + strconv.Itoa(rs.DescriptionLengthMultiple) + ")",
+					Detail: "item price of " + priceText + " * " + strconv.FormatFloat(rs.DescriptionPriceMultiplier, 'f', -1, 64) +
+						" = " + strconv.FormatFloat(itemPrice*rs.DescriptionPriceMultiplier, 'f', 2, 64) +
+						", rounded up is " + strconv.Itoa(itemPoints) + " points",
+				})
 				logger.Info("Added points for item description", logrus.Fields{
 					"item_description": trimmedDescription,
 					"item_price":       itemPrice,
@@ -86,6 +210,15 @@ func CalculatePoints(receipt model.Receipt) (int, string) {
 		}
 	}
 
+	// The date and time rules use the purchase's local time: purchaseDate and
+	// purchaseTime are wall-clock values in the receipt or retailer time zone,
+	// scored exactly as submitted. The zone is only named in the reasons; it is
+	// never used to build an instant, which would move times in a DST gap.
+	zone := ""
+	if loc := receipt.Location(rs.RetailerLocation(receipt.Retailer)); loc != nil {
+		zone = " (" + loc.String() + ")"
+	}
+
 	// Points for odd purchase date
 	date, err := time.Parse("2006-01-02", receipt.PurchaseDate)
 	if err != nil {
@@ -94,11 +227,14 @@ func CalculatePoints(receipt model.Receipt) (int, string) {
 			"error":         err,
 		})
 	} else if date.Day()%2 != 0 {
-		points += 6
-		explanation += "6 points - purchase day is odd\n"
+		score.add(RuleResult{
+			Rule:   RuleOddDay,
+			Points: rs.OddDayPoints,
+			Reason: "purchase day is odd" + zone,
+		})
 		logger.Info("Added points for odd purchase day", logrus.Fields{
 			"purchase_date": receipt.PurchaseDate,
-			"points":        6,
+			"points":        rs.OddDayPoints,
 		})
 	}
 
@@ -111,20 +247,64 @@ func CalculatePoints(receipt model.Receipt) (int, string) {
 		})
 	} else {
 		hour := purchaseTime.Hour()
-		if hour >= 14 && hour < 16 {
-			points += 10
-			explanation += "10 points - time of purchase is between 2:00pm and 4:00pm\n"
+		if hour >= rs.AfternoonStartHour && hour < rs.AfternoonEndHour {
+			score.add(RuleResult{
+				Rule:   RuleAfternoon,
+				Points: rs.AfternoonPoints,
+				Reason: "time of purchase is between " + formatHour(rs.AfternoonStartHour) + " and " + formatHour(rs.AfternoonEndHour) + zone,
+			})
 			logger.Info("Added points for time of purchase", logrus.Fields{
 				"purchase_time": receipt.PurchaseTime,
-				"points":        10,
+				"points":        rs.AfternoonPoints,
 			})
 		}
 	}
 
-	explanation += "  + ---------\n  = " + strconv.Itoa(points) + " points"
+	// Points for the payment method
+	if points := rs.PaymentMethodPoints[receipt.PaymentMethod]; points != 0 {
+		score.add(RuleResult{
+			Rule:   RulePaymentMethod,
+			Points: points,
+			Reason: "paid by " + strings.ReplaceAll(receipt.PaymentMethod, "_", " "),
+		})
+		logger.Info("Added points for payment method", logrus.Fields{
+			"payment_method": receipt.PaymentMethod,
+			"points":         points,
+		})
+	}
+
+	// Promotions are evaluated after the base rules, which are capped first so
+	// multipliers scale the capped points
+	applyRuleCaps(&score, rs.RuleCaps, false)
+	applyPromotions(&score, receipt, rs.Promotions, score.Points, history)
+	applyRuleCaps(&score, rs.RuleCaps, true)
+	applyLimits(&score, receipt, rs, history)
+
 	logger.Info("Total points calculated", logrus.Fields{
-		"total_points": points,
-		"explanation":  explanation,
+		"total_points": score.Points,
+		"ruleset":      rs.Version,
 	})
-	return points, explanation
+	return score
+}
+
+// receiptCurrency returns the currency of the receipt's amounts.
+func receiptCurrency(receipt model.Receipt) string {
+	if receipt.Currency == "" {
+		return utility.DefaultCurrency
+	}
+	return receipt.Currency
+}
+
+// roundTotalReason names the whole-unit amount of the currency, keeping the
+// original wording for dollars.
+func roundTotalReason(currency string) string {
+	if currency == "" || currency == "USD" {
+		return "total is a round dollar amount"
+	}
+	return "total is a whole number of " + currency
+}
+
+// formatHour renders an hour of the day as it appears in explanations, e.g. 14 -> "2:00pm".
+func formatHour(hour int) string {
+	return time.Date(0, 1, 1, hour, 0, 0, 0, time.UTC).Format("3:04pm")
 }
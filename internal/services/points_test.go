@@ -62,3 +62,92 @@ func TestCalculatePoints_InvalidData(t *testing.T) {
 func containsSubstring(str, substring string) bool {
 	return strings.Contains(str, substring)
 }
+
+func TestScoreReceipt_Breakdown(t *testing.T) {
+	receipt := model.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-01",
+		PurchaseTime: "13:01",
+		Items: []model.Item{
+			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
+			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
+			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+		},
+		Total: "35.35",
+	}
+
+	score := ScoreReceipt(receipt, DefaultRuleset())
+	if score.Points != 28 {
+		t.Errorf("expected 28 points; got %d", score.Points)
+	}
+
+	sum := 0
+	rules := map[string]int{}
+	for _, result := range score.Breakdown {
+		sum += result.Points
+		rules[result.Rule] += result.Points
+	}
+	if sum != score.Points {
+		t.Errorf("expected breakdown to sum to %d; got %d", score.Points, sum)
+	}
+	if rules[RuleItemDescription] != 6 || rules[RuleOddDay] != 6 || rules[RuleRetailerName] != 6 {
+		t.Errorf("unexpected per-rule points: %v", rules)
+	}
+
+	explanation := score.Explanation()
+	expected := "3 Points - \"Emils Cheese Pizza\" is 18 characters (a multiple of 3)\n" +
+		"          item price of 12.25 * 0.2 = 2.45, rounded up is 3 points\n"
+	if !containsSubstring(explanation, expected) {
+		t.Errorf("expected explanation to contain %q; got %q", expected, explanation)
+	}
+}
+
+func TestScoreReceipt_PaymentMethod(t *testing.T) {
+	receipt := model.Receipt{
+		Retailer:      "Target",
+		PurchaseDate:  "2022-01-02",
+		PurchaseTime:  "13:01",
+		Items:         []model.Item{{ShortDescription: "Pepsi", Price: "1.30"}},
+		Total:         "1.30",
+		PaymentMethod: "mobile",
+	}
+	rs := DefaultRuleset()
+	rs.PaymentMethodPoints = map[string]int{"mobile": 15}
+	score := ScoreReceipt(receipt, rs)
+	if score.Points != 6+15 {
+		t.Errorf("expected %d points; got %d\n%s", 6+15, score.Points, score.Explanation())
+	}
+	if !strings.Contains(score.Explanation(), "15 points - paid by mobile") {
+		t.Errorf("expected the payment method line; got %q", score.Explanation())
+	}
+
+	rs.PaymentMethodPoints = map[string]int{"barter": 1}
+	if err := rs.Validate(); err == nil {
+		t.Error("expected an unknown payment method to be rejected")
+	}
+}
+
+func TestScoreReceipt_UnicodeText(t *testing.T) {
+	receipt := model.Receipt{
+		Retailer:     "Café Olé",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "13:01",
+		Items:        []model.Item{{ShortDescription: "Crème brûlée", Price: "5.00"}},
+		Total:        "5.00",
+	}
+	if err := ValidateReceipt(receipt, DefaultRuleset()); err != nil {
+		t.Fatalf("expected a Unicode receipt to be valid; got %v", err)
+	}
+
+	// 7 letters, a round total and a quarter multiple; "Crème brûlée" is 12
+	// characters (15 bytes), so it earns ceil(5.00 * 0.2) = 1 point
+	score := ScoreReceipt(receipt, DefaultRuleset())
+	if score.Points != 7+50+25+1 {
+		t.Errorf("expected %d points; got %d\n%s", 7+50+25+1, score.Points, score.Explanation())
+	}
+	if !strings.Contains(score.Explanation(), "\"Crème brûlée\" is 12 characters") {
+		t.Errorf("expected the description length in characters; got %q", score.Explanation())
+	}
+}
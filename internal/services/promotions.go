@@ -0,0 +1,280 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/utility"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// RulePromotion is the breakdown rule name for points awarded by a promotion.
+const RulePromotion = "promotion"
+
+// Promotion is a campaign that awards extra points on matching receipts, e.g.
+// "2x points at Target this weekend" or "+100 points for Mountain Dew".
+// Promotions are evaluated after the base rules. Every condition that is set
+// must match.
+type Promotion struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+
+	// StartDate and EndDate bound the purchase date, inclusive (YYYY-MM-DD).
+	StartDate string `json:"startDate,omitempty"`
+	EndDate   string `json:"endDate,omitempty"`
+	// Retailers match the retailer name ignoring case, spaces and punctuation.
+	Retailers []string `json:"retailers,omitempty"`
+	// ItemContains and ItemPattern match at least one item description, by
+	// case-insensitive substring or by regular expression.
+	ItemContains []string `json:"itemContains,omitempty"`
+	ItemPattern  string   `json:"itemPattern,omitempty"`
+	// Stores and Regions match the receipt's store ID and region, ignoring
+	// case. Near matches stores whose coordinates are within a radius.
+	// Receipts without store metadata never match these conditions.
+	Stores  []string `json:"stores,omitempty"`
+	Regions []string `json:"regions,omitempty"`
+	Near    *GeoArea `json:"near,omitempty"`
+
+	// Bonus is a flat number of points. Multiplier scales the base rule
+	// points, so 2 doubles them; multipliers of several promotions add up.
+	Bonus      int     `json:"bonus,omitempty"`
+	Multiplier float64 `json:"multiplier,omitempty"`
+
+	// PerCustomerLimit caps how many receipts of one customer the promotion
+	// applies to. Zero means no limit; receipts without a customerId are not
+	// limited.
+	PerCustomerLimit int `json:"perCustomerLimit,omitempty"`
+}
+
+// GeoArea is a circle on the map.
+type GeoArea struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	RadiusKm  float64 `json:"radiusKm"`
+}
+
+// CustomerHistory answers questions about a customer's earlier receipts, for
+// rules that limit what one customer can earn.
+type CustomerHistory interface {
+	// PromotionUses returns how many stored receipts of the customer were
+	// awarded points by the promotion.
+	PromotionUses(customerID, promotionID string) int
+	// PointsOn returns the points of the customer's stored receipts with the
+	// given purchase date.
+	PointsOn(customerID, date string) int
+}
+
+// itemPatterns caches compiled ItemPattern expressions.
+var itemPatterns sync.Map
+
+// Validate checks that the promotion can be evaluated.
+func (p Promotion) Validate() error {
+	if p.ID == "" {
+		return errors.New("promotion id is required")
+	}
+	for _, date := range []string{p.StartDate, p.EndDate} {
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("promotion %s: dates must be YYYY-MM-DD", p.ID)
+		}
+	}
+	if p.StartDate != "" && p.EndDate != "" && p.EndDate < p.StartDate {
+		return fmt.Errorf("promotion %s: endDate is before startDate", p.ID)
+	}
+	if p.ItemPattern != "" {
+		if _, err := itemPattern(p.ItemPattern); err != nil {
+			return fmt.Errorf("promotion %s: invalid itemPattern: %v", p.ID, err)
+		}
+	}
+	if p.Near != nil && (p.Near.Latitude < -90 || p.Near.Latitude > 90 ||
+		p.Near.Longitude < -180 || p.Near.Longitude > 180 || p.Near.RadiusKm <= 0) {
+		return fmt.Errorf("promotion %s: near needs a valid latitude, longitude and a positive radiusKm", p.ID)
+	}
+	if p.Bonus < 0 || p.PerCustomerLimit < 0 {
+		return fmt.Errorf("promotion %s: bonus and perCustomerLimit must not be negative", p.ID)
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return fmt.Errorf("promotion %s: multiplier must be at least 1", p.ID)
+	}
+	if p.Bonus == 0 && p.Multiplier == 0 {
+		return fmt.Errorf("promotion %s: a bonus or a multiplier is required", p.ID)
+	}
+	return nil
+}
+
+func itemPattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := itemPatterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	itemPatterns.Store(pattern, re)
+	return re, nil
+}
+
+// NormalizeRetailer reduces a retailer name to lower-case letters and digits,
+// so "Target", "TARGET " and "target." all match. Names are NFC-normalized
+// first so accented names match however they were typed.
+func NormalizeRetailer(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(utility.NormalizeText(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// matches reports whether the promotion applies to the receipt. For item
+// conditions it also returns the first matching description.
+func (p Promotion) matches(receipt model.Receipt) (bool, string) {
+	if p.StartDate != "" && receipt.PurchaseDate < p.StartDate {
+		return false, ""
+	}
+	if p.EndDate != "" && receipt.PurchaseDate > p.EndDate {
+		return false, ""
+	}
+	if len(p.Retailers) > 0 {
+		retailer := NormalizeRetailer(receipt.Retailer)
+		found := false
+		for _, candidate := range p.Retailers {
+			if NormalizeRetailer(candidate) == retailer {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, ""
+		}
+	}
+	if !p.matchesStore(receipt.Store) {
+		return false, ""
+	}
+	if len(p.ItemContains) == 0 && p.ItemPattern == "" {
+		return true, ""
+	}
+
+	re, _ := itemPattern(p.ItemPattern) // validated with the ruleset
+	for _, item := range receipt.Items {
+		description := strings.TrimSpace(item.ShortDescription)
+		if len(p.ItemContains) > 0 && !containsAny(strings.ToLower(description), p.ItemContains) {
+			continue
+		}
+		if p.ItemPattern != "" && !re.MatchString(description) {
+			continue
+		}
+		return true, description
+	}
+	return false, ""
+}
+
+// matchesStore checks the store conditions of the promotion.
+func (p Promotion) matchesStore(store *model.Store) bool {
+	if len(p.Stores) == 0 && len(p.Regions) == 0 && p.Near == nil {
+		return true
+	}
+	if store == nil {
+		return false
+	}
+	if len(p.Stores) > 0 && !equalsAny(store.ID, p.Stores) {
+		return false
+	}
+	if len(p.Regions) > 0 && !equalsAny(store.Region, p.Regions) {
+		return false
+	}
+	if p.Near != nil {
+		if store.Latitude == nil || store.Longitude == nil {
+			return false
+		}
+		if distanceKm(p.Near.Latitude, p.Near.Longitude, *store.Latitude, *store.Longitude) > p.Near.RadiusKm {
+			return false
+		}
+	}
+	return true
+}
+
+// distanceKm returns the great-circle distance between two points.
+func distanceKm(lat1, lng1, lat2, lng2 float64) float64 {
+	const earthRadiusKm = 6371.0
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+func equalsAny(s string, candidates []string) bool {
+	for _, candidate := range candidates {
+		if strings.EqualFold(s, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, strings.ToLower(sub)) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyPromotions adds a breakdown line for every matching promotion.
+// basePoints are the points from the base rules, which multipliers scale.
+func applyPromotions(score *Score, receipt model.Receipt, promotions []Promotion, basePoints int, history CustomerHistory) {
+	for _, p := range promotions {
+		matched, item := p.matches(receipt)
+		if !matched {
+			continue
+		}
+		name := p.Name
+		if name == "" {
+			name = p.ID
+		}
+
+		if p.PerCustomerLimit > 0 && receipt.CustomerID != "" && history != nil &&
+			history.PromotionUses(receipt.CustomerID, p.ID) >= p.PerCustomerLimit {
+			score.add(RuleResult{
+				Rule:      RulePromotion,
+				Promotion: p.ID,
+				Reason:    "promotion \"" + name + "\" already used " + strconv.Itoa(p.PerCustomerLimit) + " times by this customer",
+			})
+			continue
+		}
+
+		points := p.Bonus
+		var parts []string
+		if p.Multiplier != 0 {
+			extra := int(math.Round(float64(basePoints) * (p.Multiplier - 1)))
+			points += extra
+			parts = append(parts, strconv.FormatFloat(p.Multiplier, 'f', -1, 64)+"x base points (+"+strconv.Itoa(extra)+")")
+		}
+		if p.Bonus != 0 {
+			parts = append(parts, strconv.Itoa(p.Bonus)+" bonus points")
+		}
+		result := RuleResult{
+			Rule:      RulePromotion,
+			Promotion: p.ID,
+			Points:    points,
+			Reason:    "promotion \"" + name + "\": " + strings.Join(parts, " and "),
+		}
+		if item != "" {
+			result.Detail = "matched item \"" + item + "\""
+		}
+		score.add(result)
+		score.Promotions = append(score.Promotions, p.ID)
+	}
+}
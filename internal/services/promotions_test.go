@@ -0,0 +1,199 @@
+package services
+
+import (
+	"receipt-processor/internal/model"
+	"strings"
+	"testing"
+)
+
+// promotionTestReceipt scores 109 points under the default ruleset.
+var promotionTestReceipt = model.Receipt{
+	Retailer:     "M&M Corner Market",
+	PurchaseDate: "2022-03-20",
+	PurchaseTime: "14:33",
+	Items: []model.Item{
+		{ShortDescription: "Gatorade", Price: "2.25"},
+		{ShortDescription: "Gatorade", Price: "2.25"},
+		{ShortDescription: "Mountain Dew 12PK", Price: "2.25"},
+		{ShortDescription: "Gatorade", Price: "2.25"},
+	},
+	Total: "9.00",
+}
+
+// fakeHistory reports a fixed number of uses for every promotion.
+type fakeHistory int
+
+func (h fakeHistory) PromotionUses(customerID, promotionID string) int {
+	return int(h)
+}
+
+func (h fakeHistory) PointsOn(customerID, date string) int {
+	return 0
+}
+
+func TestScoreReceipt_Promotions(t *testing.T) {
+	base := ScoreReceipt(promotionTestReceipt, DefaultRuleset()).Points
+
+	tests := []struct {
+		name      string
+		promotion Promotion
+		want      int
+	}{
+		{"double points", Promotion{ID: "double", Multiplier: 2}, base * 2},
+		{"bonus", Promotion{ID: "bonus", Bonus: 100}, base + 100},
+		{"both", Promotion{ID: "both", Multiplier: 1.5, Bonus: 10}, base + 55 + 10},
+		{"retailer matches", Promotion{ID: "r", Retailers: []string{"m&m corner market"}, Bonus: 5}, base + 5},
+		{"retailer ignores punctuation", Promotion{ID: "r", Retailers: []string{"MM Corner Market."}, Bonus: 5}, base + 5},
+		{"other retailer", Promotion{ID: "r", Retailers: []string{"Target"}, Bonus: 5}, base},
+		{"in date range", Promotion{ID: "d", StartDate: "2022-03-19", EndDate: "2022-03-20", Bonus: 5}, base + 5},
+		{"before start", Promotion{ID: "d", StartDate: "2022-03-21", Bonus: 5}, base},
+		{"after end", Promotion{ID: "d", EndDate: "2022-03-19", Bonus: 5}, base},
+		{"item contains", Promotion{ID: "i", ItemContains: []string{"mountain dew"}, Bonus: 100}, base + 100},
+		{"item missing", Promotion{ID: "i", ItemContains: []string{"doritos"}, Bonus: 100}, base},
+		{"item pattern", Promotion{ID: "i", ItemPattern: `(?i)^mountain dew \d+pk$`, Bonus: 100}, base + 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := DefaultRuleset()
+			rs.Promotions = []Promotion{tt.promotion}
+			if err := rs.Validate(); err != nil {
+				t.Fatalf("invalid ruleset: %v", err)
+			}
+			score := ScoreReceipt(promotionTestReceipt, rs)
+			if score.Points != tt.want {
+				t.Errorf("expected %d points; got %d\n%s", tt.want, score.Points, score.Explanation())
+			}
+			applied := len(score.Promotions) == 1
+			if applied != (tt.want != base) {
+				t.Errorf("unexpected promotions %v", score.Promotions)
+			}
+		})
+	}
+}
+
+func TestScoreReceipt_PromotionExplanation(t *testing.T) {
+	rs := DefaultRuleset()
+	rs.Promotions = []Promotion{{ID: "dew", Name: "Dew Days", ItemContains: []string{"dew"}, Bonus: 100}}
+	explanation := ScoreReceipt(promotionTestReceipt, rs).Explanation()
+	for _, want := range []string{`promotion "Dew Days": 100 bonus points`, `matched item "Mountain Dew 12PK"`} {
+		if !strings.Contains(explanation, want) {
+			t.Errorf("expected explanation to contain %q; got %q", want, explanation)
+		}
+	}
+}
+
+func TestScoreReceipt_PerCustomerLimit(t *testing.T) {
+	rs := DefaultRuleset()
+	rs.Promotions = []Promotion{{ID: "once", Bonus: 100, PerCustomerLimit: 1}}
+	base := ScoreReceipt(promotionTestReceipt, DefaultRuleset()).Points
+
+	receipt := promotionTestReceipt
+	receipt.CustomerID = "cust-1"
+	if got := ScoreReceiptFor(receipt, rs, fakeHistory(0)).Points; got != base+100 {
+		t.Errorf("first use: expected %d points; got %d", base+100, got)
+	}
+	score := ScoreReceiptFor(receipt, rs, fakeHistory(1))
+	if score.Points != base || len(score.Promotions) != 0 {
+		t.Errorf("limit reached: expected %d points and no promotions; got %d %v", base, score.Points, score.Promotions)
+	}
+	if !strings.Contains(score.Explanation(), "already used 1 times") {
+		t.Errorf("expected explanation to mention the limit; got %q", score.Explanation())
+	}
+
+	// Anonymous receipts are not limited.
+	if got := ScoreReceiptFor(promotionTestReceipt, rs, fakeHistory(1)).Points; got != base+100 {
+		t.Errorf("anonymous: expected %d points; got %d", base+100, got)
+	}
+}
+
+func TestCustomerHistoryFor(t *testing.T) {
+	ResetStore()
+	defer ResetStore()
+
+	receipt := promotionTestReceipt
+	receipt.CustomerID = "cust-1"
+	StoreReceipt("acme", "r1", "h1", model.ReceiptDetails{Receipt: &receipt, Promotions: []string{"once"}})
+	StoreReceipt("acme", "r2", "h2", model.ReceiptDetails{Receipt: &receipt, Promotions: []string{"once", "twice"}})
+
+	history := CustomerHistoryFor("acme")
+	if got := history.PromotionUses("cust-1", "once"); got != 2 {
+		t.Errorf("expected 2 uses; got %d", got)
+	}
+	if got := history.PromotionUses("cust-2", "once"); got != 0 {
+		t.Errorf("expected 0 uses for another customer; got %d", got)
+	}
+	if got := CustomerHistoryFor("other").PromotionUses("cust-1", "once"); got != 0 {
+		t.Errorf("expected tenants to be isolated; got %d", got)
+	}
+}
+
+func TestPromotion_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		promotion Promotion
+		wantErr   string
+	}{
+		{"missing id", Promotion{Bonus: 1}, "id is required"},
+		{"bad date", Promotion{ID: "p", StartDate: "03/20/2022", Bonus: 1}, "YYYY-MM-DD"},
+		{"end before start", Promotion{ID: "p", StartDate: "2022-03-20", EndDate: "2022-03-01", Bonus: 1}, "before startDate"},
+		{"bad pattern", Promotion{ID: "p", ItemPattern: "(", Bonus: 1}, "invalid itemPattern"},
+		{"negative bonus", Promotion{ID: "p", Bonus: -1}, "must not be negative"},
+		{"small multiplier", Promotion{ID: "p", Multiplier: 0.5}, "at least 1"},
+		{"no reward", Promotion{ID: "p"}, "bonus or a multiplier"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.promotion.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q; got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	rs := DefaultRuleset()
+	rs.Promotions = []Promotion{{ID: "p", Bonus: 1}, {ID: "p", Bonus: 2}}
+	if err := rs.Validate(); err == nil {
+		t.Error("expected duplicate promotion IDs to be rejected")
+	}
+}
+
+func TestScoreReceipt_StorePromotions(t *testing.T) {
+	lat, lng := 41.8827, -87.6233 // Chicago Loop
+	receipt := promotionTestReceipt
+	receipt.Store = &model.Store{ID: "T-101", Region: "US-IL", Latitude: &lat, Longitude: &lng}
+	base := ScoreReceipt(promotionTestReceipt, DefaultRuleset()).Points
+
+	tests := []struct {
+		name      string
+		promotion Promotion
+		applies   bool
+	}{
+		{"store", Promotion{ID: "p", Stores: []string{"t-101"}, Bonus: 5}, true},
+		{"other store", Promotion{ID: "p", Stores: []string{"T-202"}, Bonus: 5}, false},
+		{"region", Promotion{ID: "p", Regions: []string{"US-IL"}, Bonus: 5}, true},
+		{"other region", Promotion{ID: "p", Regions: []string{"US-WI"}, Bonus: 5}, false},
+		{"near", Promotion{ID: "p", Near: &GeoArea{Latitude: 41.8781, Longitude: -87.6298, RadiusKm: 5}, Bonus: 5}, true},
+		{"far", Promotion{ID: "p", Near: &GeoArea{Latitude: 43.0389, Longitude: -87.9065, RadiusKm: 50}, Bonus: 5}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rs := DefaultRuleset()
+			rs.Promotions = []Promotion{tt.promotion}
+			want := base
+			if tt.applies {
+				want += 5
+			}
+			if got := ScoreReceipt(receipt, rs).Points; got != want {
+				t.Errorf("expected %d points; got %d", want, got)
+			}
+			// Receipts without store metadata never match store conditions
+			if got := ScoreReceipt(promotionTestReceipt, rs).Points; got != base {
+				t.Errorf("expected a receipt without a store to get %d points; got %d", base, got)
+			}
+		})
+	}
+
+	if err := (Promotion{ID: "p", Bonus: 1, Near: &GeoArea{Latitude: 41, Longitude: -87}}).Validate(); err == nil {
+		t.Error("expected a zero radius to be rejected")
+	}
+}
@@ -1,15 +1,38 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"receipt-processor/internal/logger"
 	"receipt-processor/internal/model"
+	"receipt-processor/internal/utility"
 	"receipt-processor/pkg/hash"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
-var receipts = make(map[string]string)
-var receiptDetails = map[string]model.ReceiptDetails{}
+// Receipts are partitioned by tenant: tenant -> hash -> ID and tenant -> ID -> details.
+// A tenant can only see, and dedup against, its own receipts.
+var receipts = make(map[string]map[string]string)
+var receiptDetails = map[string]map[string]model.ReceiptDetails{}
+
+// promotionUses is a secondary index of tenant -> customer -> promotion ID ->
+// number of stored receipts the promotion awarded points to.
+var promotionUses = map[string]map[string]map[string]int{}
+
+// customerDailyPoints is a secondary index of tenant -> customer -> purchase
+// date -> points of the customer's stored receipts.
+var customerDailyPoints = map[string]map[string]map[string]int{}
+
+// storeMu guards receipts, receiptDetails and the indexes (including
+// listingIndexes), which are shared by concurrent requests.
+var storeMu sync.RWMutex
+
+// storeRevision is incremented on every write so snapshots can tell whether
+// anything changed since they were last saved. Guarded by storeMu.
+var storeRevision uint64
 
 // GenerateHash computes a SHA-1 hash for the given receipt.
 func GenerateHash(receipt model.Receipt) string {
@@ -21,40 +44,160 @@ func GenerateHash(receipt model.Receipt) string {
 	return h
 }
 
-// CheckReceipt checks if a receipt hash already exists and returns the corresponding ID.
-func CheckReceipt(hash string) (string, bool) {
-	id, found := receipts[hash]
+// CheckReceipt checks if a receipt hash already exists for the tenant and returns the corresponding ID.
+func CheckReceipt(tenant, hash string) (string, bool) {
+	storeMu.RLock()
+	id, found := receipts[tenant][hash]
+	storeMu.RUnlock()
 	if found {
 		logger.Info("Receipt already processed", logrus.Fields{
+			"tenant":     tenant,
 			"receipt_id": id,
 			"hash":       hash,
 		})
 	} else {
 		logger.Warn("New receipt hash detected", logrus.Fields{
-			"hash": hash,
+			"tenant": tenant,
+			"hash":   hash,
 		})
 	}
 	return id, found
 }
 
-// StoreReceipt stores the receipt hash and associated details.
-func StoreReceipt(id, hash string, points int, explanation string) {
-	receipts[hash] = id
-	receiptDetails[id] = model.ReceiptDetails{
-		Points:      points,
-		Explanation: explanation,
+// StoreReceipt stores the receipt hash and associated details in the tenant's partition.
+func StoreReceipt(tenant, id, hash string, details model.ReceiptDetails) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	storeReceiptLocked(tenant, id, hash, details)
+}
+
+// ProcessReceipt scores and stores a validated receipt in the tenant's
+// partition, or finds the same receipt already stored there. It returns the
+// receipt's ID and details, and whether it was newly stored. submittedBy is
+// the ID of the API key that sent the receipt, if any.
+//
+// The store stays locked from the duplicate check until the receipt is
+// stored, so concurrent submissions cannot both pass the check or both count
+// against the same per-customer and daily limits.
+func ProcessReceipt(tenant string, receipt model.Receipt, rs Ruleset, submittedBy string) (string, model.ReceiptDetails, bool) {
+	hash := GenerateHash(receipt)
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if id, exists := receipts[tenant][hash]; exists {
+		logger.Info("Receipt already processed", logrus.Fields{
+			"tenant":     tenant,
+			"receipt_id": id,
+			"hash":       hash,
+		})
+		return id, receiptDetails[tenant][id], false
+	}
+
+	id := utility.GenerateID()
+	score := ScoreReceiptFor(receipt, rs, lockedHistory{tenant: tenant})
+	details := model.ReceiptDetails{
+		Points:      score.Points,
+		Explanation: score.Explanation(),
+		SubmittedBy: submittedBy,
+		Receipt:     &receipt,
+		Promotions:  score.Promotions,
+	}
+	storeReceiptLocked(tenant, id, hash, details)
+	return id, details, true
+}
+
+func storeReceiptLocked(tenant, id, hash string, details model.ReceiptDetails) {
+	if receipts[tenant] == nil {
+		receipts[tenant] = map[string]string{}
+	}
+	if receiptDetails[tenant] == nil {
+		receiptDetails[tenant] = map[string]model.ReceiptDetails{}
 	}
+	receipts[tenant][hash] = id
+	receiptDetails[tenant][id] = details
+	indexCustomerLocked(tenant, details)
+	indexListingLocked(tenant, id, details)
+	storeRevision++
 	logger.Info("Stored receipt details", logrus.Fields{
-		"receipt_id": id,
-		"hash":       hash,
-		"points":     points,
+		"tenant":       tenant,
+		"receipt_id":   id,
+		"hash":         hash,
+		"points":       details.Points,
+		"submitted_by": details.SubmittedBy,
 	})
 }
 
-// GetReceiptPoints retrieves points and explanation based on receipt ID.
-func GetReceiptPoints(id string, detailed bool) (int, string, bool) {
-	if details, ok := receiptDetails[id]; ok {
+func indexCustomerLocked(tenant string, details model.ReceiptDetails) {
+	if details.Receipt == nil || details.Receipt.CustomerID == "" {
+		return
+	}
+	customer := details.Receipt.CustomerID
+	if customerDailyPoints[tenant] == nil {
+		customerDailyPoints[tenant] = map[string]map[string]int{}
+	}
+	if customerDailyPoints[tenant][customer] == nil {
+		customerDailyPoints[tenant][customer] = map[string]int{}
+	}
+	customerDailyPoints[tenant][customer][details.Receipt.PurchaseDate] += details.Points
+
+	if len(details.Promotions) == 0 {
+		return
+	}
+	if promotionUses[tenant] == nil {
+		promotionUses[tenant] = map[string]map[string]int{}
+	}
+	if promotionUses[tenant][customer] == nil {
+		promotionUses[tenant][customer] = map[string]int{}
+	}
+	for _, id := range details.Promotions {
+		promotionUses[tenant][customer][id]++
+	}
+}
+
+// storeHistory answers CustomerHistory questions from a tenant's stored receipts.
+type storeHistory struct {
+	tenant string
+}
+
+// CustomerHistoryFor returns the history of the tenant's customers as recorded
+// in the store.
+func CustomerHistoryFor(tenant string) CustomerHistory {
+	return storeHistory{tenant: tenant}
+}
+
+func (h storeHistory) PromotionUses(customerID, promotionID string) int {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return lockedHistory(h).PromotionUses(customerID, promotionID)
+}
+
+func (h storeHistory) PointsOn(customerID, date string) int {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return lockedHistory(h).PointsOn(customerID, date)
+}
+
+// lockedHistory is storeHistory for callers that already hold storeMu.
+type lockedHistory struct {
+	tenant string
+}
+
+func (h lockedHistory) PromotionUses(customerID, promotionID string) int {
+	return promotionUses[h.tenant][customerID][promotionID]
+}
+
+func (h lockedHistory) PointsOn(customerID, date string) int {
+	return customerDailyPoints[h.tenant][customerID][date]
+}
+
+// GetReceiptPoints retrieves points and explanation based on receipt ID within the tenant's partition.
+func GetReceiptPoints(tenant, id string, detailed bool) (int, string, bool) {
+	storeMu.RLock()
+	details, ok := receiptDetails[tenant][id]
+	storeMu.RUnlock()
+	if ok {
 		logger.Info("Retrieved receipt details", logrus.Fields{
+			"tenant":     tenant,
 			"receipt_id": id,
 			"detailed":   detailed,
 		})
@@ -67,7 +210,38 @@ func GetReceiptPoints(id string, detailed bool) (int, string, bool) {
 		return details.Points, "", true
 	}
 	logger.Warn("Receipt not found", logrus.Fields{
+		"tenant":     tenant,
 		"receipt_id": id,
 	})
 	return 0, "", false
 }
+
+// GetReceipt returns the stored details of a receipt within the tenant's partition.
+func GetReceipt(tenant, id string) (model.ReceiptDetails, bool) {
+	storeMu.RLock()
+	details, ok := receiptDetails[tenant][id]
+	storeMu.RUnlock()
+	if !ok {
+		logger.Warn("Receipt not found", logrus.Fields{
+			"tenant":     tenant,
+			"receipt_id": id,
+		})
+	}
+	return details, ok
+}
+
+// CheckStore reports whether the receipt store can take its write lock before
+// ctx expires. It is used as a readiness check.
+func CheckStore(ctx context.Context) error {
+	for {
+		if storeMu.TryLock() {
+			storeMu.Unlock()
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.New("receipt store is not writable: timed out waiting for lock")
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
@@ -1,8 +1,14 @@
 package services
 
 import (
+	"context"
+	"fmt"
 	"receipt-processor/internal/model"
+	"runtime"
+	"slices"
+	"sync"
 	"testing"
+	"time"
 )
 
 // Test GenerateHash
@@ -32,9 +38,9 @@ func TestGenerateHash(t *testing.T) {
 // Test CheckReceipt
 func TestCheckReceipt(t *testing.T) {
 	receiptHash := "sampleHash123"
-	receipts[receiptHash] = "12345"
+	receipts[DefaultTenant] = map[string]string{receiptHash: "12345"}
 
-	id, found := CheckReceipt(receiptHash)
+	id, found := CheckReceipt(DefaultTenant, receiptHash)
 	if !found {
 		t.Errorf("expected receipt to be found")
 	}
@@ -43,7 +49,7 @@ func TestCheckReceipt(t *testing.T) {
 	}
 
 	// Test for a hash that doesn't exist
-	id, found = CheckReceipt("nonexistentHash")
+	id, found = CheckReceipt(DefaultTenant, "nonexistentHash")
 	if found {
 		t.Errorf("expected receipt to not be found")
 	}
@@ -56,14 +62,18 @@ func TestStoreReceipt(t *testing.T) {
 	points := 109
 	explanation := "Points breakdown explanation"
 
-	StoreReceipt(id, hash, points, explanation)
+	StoreReceipt(DefaultTenant, id, hash, model.ReceiptDetails{
+		Points:      points,
+		Explanation: explanation,
+		SubmittedBy: "pos-terminal",
+	})
 
 	// Verify storage
-	if receipts[hash] != id {
+	if receipts[DefaultTenant][hash] != id {
 		t.Errorf("expected receipt hash to map to ID %s", id)
 	}
 
-	details, ok := receiptDetails[id]
+	details, ok := receiptDetails[DefaultTenant][id]
 	if !ok {
 		t.Errorf("expected receipt details to be stored for ID %s", id)
 	}
@@ -74,6 +84,9 @@ func TestStoreReceipt(t *testing.T) {
 	if details.Explanation != explanation {
 		t.Errorf("expected explanation to be %q; got %q", explanation, details.Explanation)
 	}
+	if details.SubmittedBy != "pos-terminal" {
+		t.Errorf("expected submitting key to be recorded; got %q", details.SubmittedBy)
+	}
 }
 
 // Test GetReceiptPoints
@@ -81,13 +94,13 @@ func TestGetReceiptPoints(t *testing.T) {
 	id := "12345"
 	points := 109
 	explanation := "Points breakdown explanation"
-	receiptDetails[id] = model.ReceiptDetails{
+	receiptDetails[DefaultTenant] = map[string]model.ReceiptDetails{id: {
 		Points:      points,
 		Explanation: explanation,
-	}
+	}}
 
 	// Test retrieving points with detailed explanation
-	retrievedPoints, retrievedExplanation, found := GetReceiptPoints(id, true)
+	retrievedPoints, retrievedExplanation, found := GetReceiptPoints(DefaultTenant, id, true)
 	if !found {
 		t.Errorf("expected receipt to be found")
 	}
@@ -99,14 +112,124 @@ func TestGetReceiptPoints(t *testing.T) {
 	}
 
 	// Test retrieving points without detailed explanation
-	retrievedPoints, retrievedExplanation, found = GetReceiptPoints(id, false)
+	retrievedPoints, retrievedExplanation, found = GetReceiptPoints(DefaultTenant, id, false)
 	if retrievedExplanation != "" {
 		t.Errorf("expected no explanation; got %q", retrievedExplanation)
 	}
 
 	// Test for nonexistent receipt ID
-	_, _, found = GetReceiptPoints("nonexistentID", true)
+	_, _, found = GetReceiptPoints(DefaultTenant, "nonexistentID", true)
 	if found {
 		t.Errorf("expected receipt to not be found")
 	}
 }
+
+// Test that tenants cannot see or dedup against each other's receipts
+func TestCrossTenantIsolation(t *testing.T) {
+	hash := "sharedHash"
+	StoreReceipt("partner-a", "id-a", hash, model.ReceiptDetails{Points: 10})
+
+	// The same receipt hash is new for another tenant
+	if _, found := CheckReceipt("partner-b", hash); found {
+		t.Errorf("expected partner-b not to dedup against partner-a's receipt")
+	}
+	StoreReceipt("partner-b", "id-b", hash, model.ReceiptDetails{Points: 20})
+
+	if id, _ := CheckReceipt("partner-a", hash); id != "id-a" {
+		t.Errorf("expected partner-a's hash to still map to id-a; got %q", id)
+	}
+
+	// Neither tenant can read the other's receipt by ID
+	if _, _, found := GetReceiptPoints("partner-b", "id-a", false); found {
+		t.Errorf("expected partner-b not to read partner-a's receipt")
+	}
+	if _, _, found := GetReceiptPoints("partner-a", "id-b", false); found {
+		t.Errorf("expected partner-a not to read partner-b's receipt")
+	}
+	if points, _, found := GetReceiptPoints("partner-b", "id-b", false); !found || points != 20 {
+		t.Errorf("expected partner-b to read its own receipt; got %d, %v", points, found)
+	}
+}
+
+// Test that concurrent submissions are deduplicated and counted against
+// per-customer limits as if they arrived one at a time. Run with -race.
+func TestProcessReceipt_Concurrent(t *testing.T) {
+	ResetStore()
+	defer ResetStore()
+	rs := DefaultRuleset()
+	rs.Promotions = []Promotion{{ID: "once", Bonus: 100, PerCustomerLimit: 1}}
+
+	receipt := func(total int) model.Receipt {
+		return model.Receipt{
+			Retailer:     "Target",
+			PurchaseDate: "2022-03-20",
+			PurchaseTime: "10:00",
+			Items:        []model.Item{{ShortDescription: "Pepsi", Price: fmt.Sprintf("%d.00", total)}},
+			Total:        fmt.Sprintf("%d.00", total),
+			CustomerID:   "cust-1",
+		}
+	}
+
+	// Several threads make the submissions overlap even on a single CPU
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(8))
+	const submissions = 100
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	stored, ids := 0, map[string]bool{}
+	for i := 0; i < submissions; i++ {
+		wg.Add(2)
+		// Distinct receipts of one customer
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			ProcessReceipt("race", receipt(i+1), rs, "")
+		}(i)
+		// The same receipt submitted many times
+		go func() {
+			defer wg.Done()
+			<-start
+			id, _, isNew := ProcessReceipt("race", receipt(1000), rs, "")
+			mu.Lock()
+			defer mu.Unlock()
+			ids[id] = true
+			if isNew {
+				stored++
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if stored != 1 || len(ids) != 1 {
+		t.Errorf("expected the repeated receipt to be stored once under one ID; stored %d times under %d IDs", stored, len(ids))
+	}
+	if n := len(receiptDetails["race"]); n != submissions+1 {
+		t.Errorf("expected %d stored receipts; got %d", submissions+1, n)
+	}
+	awarded := 0
+	for _, details := range receiptDetails["race"] {
+		if slices.Contains(details.Promotions, "once") {
+			awarded++
+		}
+	}
+	if awarded != 1 {
+		t.Errorf("expected the promotion to be awarded once for a limit of 1; got %d", awarded)
+	}
+}
+
+// Test CheckStore
+func TestCheckStore(t *testing.T) {
+	if err := CheckStore(context.Background()); err != nil {
+		t.Errorf("expected store to be writable; got %v", err)
+	}
+
+	// A store whose lock is held cannot be written to before the deadline
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := CheckStore(ctx); err == nil {
+		t.Errorf("expected error while the store lock is held")
+	}
+}
@@ -0,0 +1,403 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/utility"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultTenant is used for requests that do not identify a tenant.
+const DefaultTenant = "default"
+
+// Ruleset holds the parameters of the scoring rules applied by CalculatePoints.
+type Ruleset struct {
+	Version                    string  `json:"version"`
+	RetailerCharPoints         int     `json:"retailerCharPoints"`         // per alphanumeric character in the retailer name
+	RoundTotalPoints           int     `json:"roundTotalPoints"`           // total is a round dollar amount
+	QuarterMultiplePoints      int     `json:"quarterMultiplePoints"`      // total is a multiple of 0.25
+	ItemPairPoints             int     `json:"itemPairPoints"`             // per two items on the receipt
+	DescriptionLengthMultiple  int     `json:"descriptionLengthMultiple"`  // trimmed description length must be a multiple of this
+	DescriptionPriceMultiplier float64 `json:"descriptionPriceMultiplier"` // item price multiplier, rounded up
+	OddDayPoints               int     `json:"oddDayPoints"`               // purchase day is odd
+	AfternoonPoints            int     `json:"afternoonPoints"`            // purchase time falls in the afternoon window
+	AfternoonStartHour         int     `json:"afternoonStartHour"`         // window start, inclusive
+	AfternoonEndHour           int     `json:"afternoonEndHour"`           // window end, exclusive
+
+	PaymentMethodPoints map[string]int `json:"paymentMethodPoints,omitempty"` // by receipt paymentMethod
+
+	Promotions []Promotion `json:"promotions,omitempty"` // evaluated after the rules above
+
+	// Limits on the points awarded; zero means no limit. See applyLimits.
+	RuleCaps               map[string]int `json:"ruleCaps,omitempty"`               // maximum points per rule name
+	MaxReceiptPoints       int            `json:"maxReceiptPoints,omitempty"`       // maximum points per receipt
+	MaxCustomerDailyPoints int            `json:"maxCustomerDailyPoints,omitempty"` // maximum points per customer and purchase date
+	MinSpend               float64        `json:"minSpend,omitempty"`               // receipts with a lower total earn no points
+
+	// Amounts in other currencies are converted to BaseCurrency (USD when
+	// empty) for rules with price thresholds: the item description rule and
+	// minSpend. CurrencyRates gives the value of one unit of each currency in
+	// BaseCurrency, e.g. {"JPY": 0.0067}.
+	BaseCurrency  string             `json:"baseCurrency,omitempty"`
+	CurrencyRates map[string]float64 `json:"currencyRates,omitempty"`
+
+	// Time zones of receipts that do not name one, as IANA names. Without
+	// either, purchase times are taken as UTC.
+	Timezone          string            `json:"timezone,omitempty"`          // default for every retailer
+	RetailerTimezones map[string]string `json:"retailerTimezones,omitempty"` // by retailer name, matched like promotions
+}
+
+// RulesetSet is the default ruleset plus per-tenant overrides.
+type RulesetSet struct {
+	Default Ruleset            `json:"default"`
+	Tenants map[string]Ruleset `json:"tenants,omitempty"`
+}
+
+// rulesetFile mirrors RulesetSet but keeps raw JSON so each ruleset can be
+// decoded on top of the defaults.
+type rulesetFile struct {
+	Default json.RawMessage            `json:"default"`
+	Tenants map[string]json.RawMessage `json:"tenants"`
+}
+
+var activeRulesets atomic.Pointer[RulesetSet]
+
+// rulesetHistory remembers every ruleset activated since startup by tenant
+// and version, so what-if scoring can compare against a previous version.
+// Default rulesets are kept under the empty tenant.
+var (
+	historyMu      sync.RWMutex
+	rulesetHistory = map[string]map[string]Ruleset{}
+)
+
+// builtinVersion is the version of DefaultRuleset, which files may not reuse.
+const builtinVersion = "builtin"
+
+func init() {
+	builtin := DefaultRuleset()
+	rulesetHistory[""] = map[string]Ruleset{builtin.Version: builtin}
+	activeRulesets.Store(&RulesetSet{Default: builtin})
+}
+
+// DefaultRuleset returns the scoring rules from the original receipt processor specification.
+func DefaultRuleset() Ruleset {
+	return Ruleset{
+		Version:                    builtinVersion,
+		RetailerCharPoints:         1,
+		RoundTotalPoints:           50,
+		QuarterMultiplePoints:      25,
+		ItemPairPoints:             5,
+		DescriptionLengthMultiple:  3,
+		DescriptionPriceMultiplier: 0.2,
+		OddDayPoints:               6,
+		AfternoonPoints:            10,
+		AfternoonStartHour:         14,
+		AfternoonEndHour:           16,
+	}
+}
+
+// Validate checks that the ruleset parameters are usable.
+func (rs Ruleset) Validate() error {
+	if rs.RetailerCharPoints < 0 || rs.RoundTotalPoints < 0 || rs.QuarterMultiplePoints < 0 ||
+		rs.ItemPairPoints < 0 || rs.OddDayPoints < 0 || rs.AfternoonPoints < 0 || rs.DescriptionPriceMultiplier < 0 {
+		return errors.New("ruleset points and multipliers must not be negative")
+	}
+	if rs.DescriptionLengthMultiple <= 0 {
+		return errors.New("descriptionLengthMultiple must be positive")
+	}
+	if rs.AfternoonStartHour < 0 || rs.AfternoonEndHour > 24 || rs.AfternoonStartHour >= rs.AfternoonEndHour {
+		return errors.New("afternoon window must satisfy 0 <= afternoonStartHour < afternoonEndHour <= 24")
+	}
+	for method, points := range rs.PaymentMethodPoints {
+		if !slices.Contains(model.PaymentMethods, method) {
+			return fmt.Errorf("paymentMethodPoints: unknown payment method %q", method)
+		}
+		if points < 0 {
+			return errors.New("ruleset points and multipliers must not be negative")
+		}
+	}
+	for rule, limit := range rs.RuleCaps {
+		if !knownRules[rule] {
+			return fmt.Errorf("ruleCaps: unknown rule %q", rule)
+		}
+		if limit < 0 {
+			return fmt.Errorf("ruleCaps: cap for %s must not be negative", rule)
+		}
+	}
+	if rs.MaxReceiptPoints < 0 || rs.MaxCustomerDailyPoints < 0 || rs.MinSpend < 0 {
+		return errors.New("maxReceiptPoints, maxCustomerDailyPoints and minSpend must not be negative")
+	}
+	if rs.BaseCurrency != "" {
+		if _, ok := utility.MinorUnits(rs.BaseCurrency); !ok {
+			return fmt.Errorf("baseCurrency: unknown currency %q", rs.BaseCurrency)
+		}
+	}
+	for currency, rate := range rs.CurrencyRates {
+		if _, ok := utility.MinorUnits(currency); !ok {
+			return fmt.Errorf("currencyRates: unknown currency %q", currency)
+		}
+		if rate <= 0 {
+			return fmt.Errorf("currencyRates: rate for %s must be positive", currency)
+		}
+	}
+	if rs.Timezone != "" {
+		if _, err := utility.LoadLocation(rs.Timezone); err != nil {
+			return fmt.Errorf("timezone: %v", err)
+		}
+	}
+	for retailer, name := range rs.RetailerTimezones {
+		if _, err := utility.LoadLocation(name); err != nil {
+			return fmt.Errorf("retailerTimezones: %s: %v", retailer, err)
+		}
+	}
+	ids := map[string]bool{}
+	for _, p := range rs.Promotions {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		if ids[p.ID] {
+			return fmt.Errorf("duplicate promotion id %s", p.ID)
+		}
+		ids[p.ID] = true
+	}
+	return nil
+}
+
+// RetailerLocation returns the configured time zone of the retailer, or nil
+// when the ruleset has none.
+func (rs Ruleset) RetailerLocation(retailer string) *time.Location {
+	name := rs.Timezone
+	if len(rs.RetailerTimezones) > 0 {
+		normalized := NormalizeRetailer(retailer)
+		for candidate, tz := range rs.RetailerTimezones {
+			if NormalizeRetailer(candidate) == normalized {
+				name = tz
+				break
+			}
+		}
+	}
+	if name == "" {
+		return nil
+	}
+	loc, err := utility.LoadLocation(name) // validated with the ruleset
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
+func (rs Ruleset) baseCurrency() string {
+	if rs.BaseCurrency == "" {
+		return utility.DefaultCurrency
+	}
+	return rs.BaseCurrency
+}
+
+// ToBaseCurrency converts an amount in currency (USD when empty) to the
+// ruleset's base currency. It reports false when there is no rate for it.
+func (rs Ruleset) ToBaseCurrency(amount float64, currency string) (float64, bool) {
+	if currency == "" {
+		currency = utility.DefaultCurrency
+	}
+	if currency == rs.baseCurrency() {
+		return amount, true
+	}
+	rate, ok := rs.CurrencyRates[currency]
+	return amount * rate, ok
+}
+
+// ValidateReceipt validates the receipt, checking its purchase date against
+// the retailer's time zone from rs when the receipt does not name one. It
+// also rejects currencies that rs cannot convert to its base currency.
+func ValidateReceipt(receipt model.Receipt, rs Ruleset) error {
+	if err := receipt.ValidateIn(rs.RetailerLocation(receipt.Retailer)); err != nil {
+		return err
+	}
+	if _, ok := rs.ToBaseCurrency(0, receipt.Currency); !ok {
+		logger.Error("No exchange rate for receipt currency", logrus.Fields{
+			"currency":      receipt.Currency,
+			"base_currency": rs.baseCurrency(),
+		})
+		return &model.FieldError{
+			Field:   "currency",
+			Message: fmt.Sprintf("currency %s is not accepted: no exchange rate to %s", receiptCurrency(receipt), rs.baseCurrency()),
+		}
+	}
+	return nil
+}
+
+// Validate checks the default ruleset and every tenant override.
+func (set *RulesetSet) Validate() error {
+	if err := set.Default.Validate(); err != nil {
+		return fmt.Errorf("default ruleset: %v", err)
+	}
+	for tenant, rs := range set.Tenants {
+		if err := rs.Validate(); err != nil {
+			return fmt.Errorf("ruleset for tenant %q: %v", tenant, err)
+		}
+	}
+	return nil
+}
+
+// For returns the ruleset for tenant, falling back to the default.
+func (set *RulesetSet) For(tenant string) Ruleset {
+	if rs, ok := set.Tenants[tenant]; ok {
+		return rs
+	}
+	return set.Default
+}
+
+// ParseRulesets decodes a rulesets document. Fields left out of a ruleset keep
+// their DefaultRuleset values and unknown fields are rejected. A ruleset
+// without a version gets one derived from its contents, so it never takes the
+// builtin version.
+func ParseRulesets(data []byte) (*RulesetSet, error) {
+	var file rulesetFile
+	if err := decodeStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing rulesets: %v", err)
+	}
+
+	set := &RulesetSet{Default: DefaultRuleset(), Tenants: map[string]Ruleset{}}
+	if len(file.Default) > 0 {
+		rs, err := parseFileRuleset(file.Default, "default")
+		if err != nil {
+			return nil, fmt.Errorf("parsing default ruleset: %v", err)
+		}
+		set.Default = rs
+	}
+	for tenant, raw := range file.Tenants {
+		rs, err := parseFileRuleset(raw, tenant)
+		if err != nil {
+			return nil, fmt.Errorf("parsing ruleset for tenant %q: %v", tenant, err)
+		}
+		set.Tenants[tenant] = rs
+	}
+
+	if err := set.Validate(); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+// parseFileRuleset decodes one ruleset of a rulesets file on top of
+// DefaultRuleset. Without a version it is named after prefix and a hash of
+// its settings.
+func parseFileRuleset(raw json.RawMessage, prefix string) (Ruleset, error) {
+	rs := DefaultRuleset()
+	rs.Version = ""
+	if err := decodeStrict(raw, &rs); err != nil {
+		return Ruleset{}, err
+	}
+	switch rs.Version {
+	case builtinVersion:
+		return Ruleset{}, fmt.Errorf("version %q is reserved for the built-in rules", builtinVersion)
+	case "":
+		settings, err := json.Marshal(rs)
+		if err != nil {
+			return Ruleset{}, err
+		}
+		sum := sha256.Sum256(settings)
+		rs.Version = fmt.Sprintf("%s-%x", prefix, sum[:6])
+	}
+	return rs, nil
+}
+
+// ParseRuleset decodes a single ruleset on top of DefaultRuleset and validates
+// it. Unknown fields are rejected.
+func ParseRuleset(data []byte) (Ruleset, error) {
+	rs := DefaultRuleset()
+	rs.Version = ""
+	if err := decodeStrict(data, &rs); err != nil {
+		return Ruleset{}, fmt.Errorf("parsing ruleset: %v", err)
+	}
+	if err := rs.Validate(); err != nil {
+		return Ruleset{}, err
+	}
+	return rs, nil
+}
+
+// decodeStrict decodes data into v, rejecting fields v does not have so a
+// misspelt setting fails instead of silently keeping its default.
+func decodeStrict(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// LoadRulesets reads and validates a rulesets file. An empty path yields the defaults.
+func LoadRulesets(path string) (*RulesetSet, error) {
+	if path == "" {
+		return &RulesetSet{Default: DefaultRuleset()}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading rulesets file: %v", err)
+	}
+	return ParseRulesets(data)
+}
+
+// SetRulesets makes set the active rulesets for new scoring requests.
+func SetRulesets(set *RulesetSet) {
+	historyMu.Lock()
+	remember := func(tenant string, rs Ruleset) {
+		if rulesetHistory[tenant] == nil {
+			rulesetHistory[tenant] = map[string]Ruleset{}
+		}
+		rulesetHistory[tenant][rs.Version] = rs
+	}
+	remember("", set.Default)
+	for tenant, rs := range set.Tenants {
+		remember(tenant, rs)
+	}
+	historyMu.Unlock()
+
+	activeRulesets.Store(set)
+	logger.Info("Activated rulesets", logrus.Fields{
+		"default_version": set.Default.Version,
+		"tenants":         len(set.Tenants),
+	})
+}
+
+// ActiveRulesets returns the rulesets currently in use.
+func ActiveRulesets() *RulesetSet {
+	return activeRulesets.Load()
+}
+
+// RulesetVersion returns the most recently activated ruleset with the given
+// version among tenant's own overrides and the default rulesets. Other
+// tenants' rulesets are never returned.
+func RulesetVersion(tenant, version string) (Ruleset, bool) {
+	historyMu.RLock()
+	defer historyMu.RUnlock()
+	if rs, ok := rulesetHistory[tenant][version]; ok {
+		return rs, true
+	}
+	rs, ok := rulesetHistory[""][version]
+	return rs, ok
+}
+
+// RulesetFor returns the active ruleset for tenant.
+func RulesetFor(tenant string) Ruleset {
+	return ActiveRulesets().For(tenant)
+}
+
+// CheckRulesets reports whether a valid ruleset is loaded. It is used as a readiness check.
+func CheckRulesets(ctx context.Context) error {
+	set := ActiveRulesets()
+	if set == nil {
+		return errors.New("no ruleset loaded")
+	}
+	return set.Validate()
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"receipt-processor/internal/model"
+	"reflect"
+	"testing"
+)
+
+func TestParseRulesets(t *testing.T) {
+	data := []byte(`{
+		"default": {"version": "2024-06"},
+		"tenants": {"partner-a": {"version": "a-1", "roundTotalPoints": 100}}
+	}`)
+
+	set, err := ParseRulesets(data)
+	if err != nil {
+		t.Fatalf("ParseRulesets() error = %v", err)
+	}
+	if set.Default.Version != "2024-06" || set.Default.RoundTotalPoints != 50 {
+		t.Errorf("expected omitted fields to keep defaults; got %+v", set.Default)
+	}
+	if rs := set.For("partner-a"); rs.RoundTotalPoints != 100 || rs.ItemPairPoints != 5 {
+		t.Errorf("unexpected ruleset for partner-a: %+v", rs)
+	}
+	if rs := set.For("partner-b"); rs.Version != "2024-06" {
+		t.Errorf("expected unknown tenant to fall back to the default ruleset; got %+v", rs)
+	}
+}
+
+func TestParseRulesets_Invalid(t *testing.T) {
+	tests := []string{
+		`not json`,
+		`{"default": {"descriptionLengthMultiple": 0}}`,
+		`{"tenants": {"a": {"afternoonStartHour": 16, "afternoonEndHour": 14}}}`,
+		`{"default": {"oddDayPoints": -1}}`,
+		`{"default": {"maxReceiptPoint": 100}}`,
+		`{"tenants": {"a": {"oddDayPoint": 8}}}`,
+		`{"tenant": {"a": {}}}`,
+	}
+	for _, data := range tests {
+		if _, err := ParseRulesets([]byte(data)); err == nil {
+			t.Errorf("ParseRulesets(%s): expected error", data)
+		}
+	}
+}
+
+func TestLoadRulesets(t *testing.T) {
+	set, err := LoadRulesets("")
+	if err != nil || !reflect.DeepEqual(set.Default, DefaultRuleset()) {
+		t.Errorf("expected defaults without a file; got %+v, %v", set, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "rulesets.json")
+	if err := os.WriteFile(path, []byte(`{"default": {"version": "file"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	set, err = LoadRulesets(path)
+	if err != nil || set.Default.Version != "file" {
+		t.Errorf("LoadRulesets() = %+v, %v", set, err)
+	}
+
+	if _, err := LoadRulesets(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("expected error for missing file")
+	}
+}
+
+func TestCalculatePointsWithRuleset_PerTenant(t *testing.T) {
+	defer SetRulesets(&RulesetSet{Default: DefaultRuleset()})
+
+	receipt := model.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2022-01-02",
+		PurchaseTime: "13:01",
+		Items:        []model.Item{{ShortDescription: "Pepsi", Price: "1.00"}},
+		Total:        "1.00",
+	}
+
+	partner := DefaultRuleset()
+	partner.RoundTotalPoints = 500
+	SetRulesets(&RulesetSet{Default: DefaultRuleset(), Tenants: map[string]Ruleset{"partner-a": partner}})
+
+	defaultPoints, _ := CalculatePointsWithRuleset(receipt, RulesetFor(DefaultTenant))
+	partnerPoints, _ := CalculatePointsWithRuleset(receipt, RulesetFor("partner-a"))
+	if partnerPoints-defaultPoints != 450 {
+		t.Errorf("expected partner-a's ruleset to award 450 more points; got %d vs %d", partnerPoints, defaultPoints)
+	}
+}
+
+func TestCheckRulesets(t *testing.T) {
+	if err := CheckRulesets(context.Background()); err != nil {
+		t.Errorf("expected the active rulesets to be valid; got %v", err)
+	}
+}
+
+func TestParseRuleset(t *testing.T) {
+	rs, err := ParseRuleset([]byte(`{"oddDayPoints": 12}`))
+	if err != nil {
+		t.Fatalf("ParseRuleset() error: %v", err)
+	}
+	if rs.OddDayPoints != 12 || rs.RoundTotalPoints != 50 || rs.Version != "" {
+		t.Errorf("expected the ruleset to overlay the defaults; got %+v", rs)
+	}
+
+	for _, doc := range []string{`{"oddDay": 1}`, `{"descriptionLengthMultiple": 0}`, `[]`} {
+		if _, err := ParseRuleset([]byte(doc)); err == nil {
+			t.Errorf("expected an error parsing %s", doc)
+		}
+	}
+}
+
+func TestRulesetVersion(t *testing.T) {
+	defer SetRulesets(&RulesetSet{Default: DefaultRuleset()})
+
+	v1 := DefaultRuleset()
+	v1.Version = "history-v1"
+	v1.OddDayPoints = 1
+	SetRulesets(&RulesetSet{Default: v1})
+	v2 := DefaultRuleset()
+	v2.Version = "history-v2"
+	SetRulesets(&RulesetSet{Default: v2})
+
+	rs, ok := RulesetVersion(DefaultTenant, "history-v1")
+	if !ok || rs.OddDayPoints != 1 {
+		t.Errorf("expected the previous version to be remembered; got %+v, %v", rs, ok)
+	}
+	if _, ok := RulesetVersion(DefaultTenant, "history-v3"); ok {
+		t.Error("expected an unknown version not to be found")
+	}
+}
+
+func TestRulesetVersion_Tenants(t *testing.T) {
+	defer SetRulesets(&RulesetSet{Default: DefaultRuleset()})
+
+	set, err := ParseRulesets([]byte(`{
+		"default": {"version": "tenants-v1"},
+		"tenants": {
+			"acme": {"oddDayPoints": 999},
+			"globex": {"version": "globex-1", "oddDayPoints": 7}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	acme := set.Tenants["acme"]
+	if acme.Version == "" || acme.Version == "builtin" {
+		t.Fatalf("expected an unversioned override to get a derived version; got %q", acme.Version)
+	}
+	SetRulesets(set)
+
+	if rs, ok := RulesetVersion("acme", "builtin"); !ok || rs.OddDayPoints != 6 {
+		t.Errorf("expected builtin to stay the built-in rules; got %+v", rs)
+	}
+	if rs, ok := RulesetVersion("acme", acme.Version); !ok || rs.OddDayPoints != 999 {
+		t.Errorf("expected a tenant to find its own version; got %+v, %v", rs, ok)
+	}
+	if _, ok := RulesetVersion("acme", "globex-1"); ok {
+		t.Error("expected another tenant's version not to be found")
+	}
+	if _, ok := RulesetVersion("initech", acme.Version); ok {
+		t.Error("expected a tenant without overrides not to find another tenant's version")
+	}
+	if rs, ok := RulesetVersion("globex", "tenants-v1"); !ok || rs.OddDayPoints != 6 {
+		t.Errorf("expected default versions to be shared; got %+v, %v", rs, ok)
+	}
+
+	if _, err := ParseRulesets([]byte(`{"tenants": {"acme": {"version": "builtin"}}}`)); err == nil {
+		t.Error("expected the builtin version to be reserved")
+	}
+}
@@ -0,0 +1,458 @@
+package services
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/utility"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Sort orders accepted by ListReceipts.
+const (
+	SortDate   = "date"
+	SortPoints = "points"
+	SortTotal  = "total"
+)
+
+// Page sizes of ListReceipts.
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+)
+
+// Errors returned by ListReceipts.
+var (
+	// ErrInvalidCursor is returned for a cursor that ListReceipts did not
+	// issue for the same sort order.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrTotalNeedsCurrency is returned for a total bound without a currency.
+	ErrTotalNeedsCurrency = errors.New("minTotal and maxTotal need a currency")
+)
+
+// ReceiptQuery selects and orders the receipts returned by ListReceipts.
+// Empty or nil fields match every receipt.
+type ReceiptQuery struct {
+	Retailer   string // matched like promotion retailers
+	CustomerID string
+	From, To   string // purchase dates, inclusive
+	Currency   string // ISO 4217 code; receipts without one are in utility.DefaultCurrency
+	MinTotal   *int64 // in AmountScale units of Currency, which must be set
+	MaxTotal   *int64
+	MinPoints  *int
+	MaxPoints  *int
+
+	Sort       string // SortDate (the default), SortPoints or SortTotal
+	Descending bool
+	Cursor     string // NextCursor of the previous page
+	Limit      int    // DefaultListLimit when 0, at most MaxListLimit
+}
+
+// ListedReceipt is one receipt of a ReceiptPage.
+type ListedReceipt struct {
+	ID string
+	model.ReceiptDetails
+}
+
+// ReceiptPage is a page of ListReceipts results. NextCursor is empty on the
+// last page.
+type ReceiptPage struct {
+	Receipts   []ListedReceipt
+	NextCursor string
+}
+
+// AmountScale is the number of units per 1 of a total in ReceiptQuery, enough
+// for every currency's decimal places.
+const AmountScale = 10000
+
+var amountRegex = regexp.MustCompile(`^\d+(\.\d{1,4})?$`)
+
+// ParseAmount converts a non-negative decimal such as "12.5" to AmountScale
+// units.
+func ParseAmount(str string) (int64, bool) {
+	if !amountRegex.MatchString(str) {
+		return 0, false
+	}
+	whole, fraction, _ := strings.Cut(str, ".")
+	n, err := strconv.ParseInt(whole+(fraction + "0000")[:4], 10, 64)
+	return n, err == nil
+}
+
+// indexEntry is a stored receipt's keys in the listing indexes.
+type indexEntry struct {
+	id     string
+	date   string // purchase date and time, "2006-01-02 15:04"
+	points int
+	total  int64 // in AmountScale units
+}
+
+func newIndexEntry(id string, details model.ReceiptDetails) *indexEntry {
+	entry := &indexEntry{id: id, points: details.Points}
+	if r := details.Receipt; r != nil {
+		entry.date = r.PurchaseDate + " " + r.PurchaseTime
+		if minor, err := utility.ParseMinorUnits(r.Total, r.Currency); err == nil {
+			digits, _ := utility.MinorUnits(r.Currency)
+			for ; digits < 4; digits++ {
+				minor *= 10
+			}
+			entry.total = minor
+		}
+	}
+	return entry
+}
+
+// compareEntries orders entries by the sort key, then ID.
+func compareEntries(sortBy string, a, b *indexEntry) int {
+	var c int
+	switch sortBy {
+	case SortPoints:
+		c = cmp.Compare(a.points, b.points)
+	case SortTotal:
+		c = cmp.Compare(a.total, b.total)
+	default:
+		c = cmp.Compare(a.date, b.date)
+	}
+	if c != 0 {
+		return c
+	}
+	return cmp.Compare(a.id, b.id)
+}
+
+// indexBlockSize bounds the blocks of an orderedIndex.
+const indexBlockSize = 256
+
+// orderedIndex keeps entries sorted by one key, in blocks of at most
+// indexBlockSize so an insert only shifts the entries of one block.
+type orderedIndex struct {
+	sortBy string
+	blocks [][]*indexEntry
+}
+
+// position is an entry of an orderedIndex by block and offset.
+type position struct{ block, offset int }
+
+func (x *orderedIndex) insert(entry *indexEntry) {
+	if len(x.blocks) == 0 {
+		x.blocks = [][]*indexEntry{{entry}}
+		return
+	}
+	// The first block whose last entry sorts after the new one, else the last
+	b := sort.Search(len(x.blocks), func(i int) bool {
+		block := x.blocks[i]
+		return compareEntries(x.sortBy, block[len(block)-1], entry) > 0
+	})
+	if b == len(x.blocks) {
+		b--
+	}
+	block := x.blocks[b]
+	i := sort.Search(len(block), func(i int) bool { return compareEntries(x.sortBy, block[i], entry) > 0 })
+	block = append(block, nil)
+	copy(block[i+1:], block[i:])
+	block[i] = entry
+	x.blocks[b] = block
+
+	if len(block) > indexBlockSize {
+		half := len(block) / 2
+		upper := append([]*indexEntry(nil), block[half:]...)
+		x.blocks[b] = block[:half:half]
+		x.blocks = append(x.blocks, nil)
+		copy(x.blocks[b+2:], x.blocks[b+1:])
+		x.blocks[b+1] = upper
+	}
+}
+
+// seek returns the position of the first entry that sorts after pivot, or
+// at or after it when inclusive. It is one past the end when there is none.
+func (x *orderedIndex) seek(pivot *indexEntry, inclusive bool) position {
+	after := func(e *indexEntry) bool {
+		c := compareEntries(x.sortBy, e, pivot)
+		return c > 0 || inclusive && c == 0
+	}
+	b := sort.Search(len(x.blocks), func(i int) bool {
+		block := x.blocks[i]
+		return after(block[len(block)-1])
+	})
+	if b == len(x.blocks) {
+		return position{block: b}
+	}
+	block := x.blocks[b]
+	return position{block: b, offset: sort.Search(len(block), func(i int) bool { return after(block[i]) })}
+}
+
+func (x *orderedIndex) end() position {
+	return position{block: len(x.blocks)}
+}
+
+func (x *orderedIndex) at(p position) *indexEntry {
+	return x.blocks[p.block][p.offset]
+}
+
+func (x *orderedIndex) valid(p position) bool {
+	return p.block >= 0 && p.block < len(x.blocks)
+}
+
+func (x *orderedIndex) next(p position) position {
+	if p.offset++; p.offset == len(x.blocks[p.block]) {
+		return position{block: p.block + 1}
+	}
+	return p
+}
+
+// prev returns the position before p, which may be end(); before the first
+// entry it is invalid.
+func (x *orderedIndex) prev(p position) position {
+	if p.offset--; p.offset >= 0 {
+		return p
+	}
+	if p.block--; p.block < 0 {
+		return p
+	}
+	p.offset = len(x.blocks[p.block]) - 1
+	return p
+}
+
+// listingIndex holds the secondary indexes of one tenant's receipts.
+type listingIndex struct {
+	byRetailer map[string][]*indexEntry // by NormalizeRetailer
+	byCustomer map[string][]*indexEntry
+	ordered    map[string]*orderedIndex // by sort order
+}
+
+// listingIndexes is tenant -> listing indexes. Guarded by storeMu.
+var listingIndexes = map[string]*listingIndex{}
+
+func indexListingLocked(tenant, id string, details model.ReceiptDetails) {
+	index := listingIndexes[tenant]
+	if index == nil {
+		index = &listingIndex{
+			byRetailer: map[string][]*indexEntry{},
+			byCustomer: map[string][]*indexEntry{},
+			ordered:    map[string]*orderedIndex{},
+		}
+		for _, sortBy := range []string{SortDate, SortPoints, SortTotal} {
+			index.ordered[sortBy] = &orderedIndex{sortBy: sortBy}
+		}
+		listingIndexes[tenant] = index
+	}
+
+	entry := newIndexEntry(id, details)
+	if r := details.Receipt; r != nil {
+		retailer := NormalizeRetailer(r.Retailer)
+		index.byRetailer[retailer] = append(index.byRetailer[retailer], entry)
+		if r.CustomerID != "" {
+			index.byCustomer[r.CustomerID] = append(index.byCustomer[r.CustomerID], entry)
+		}
+	}
+	for _, ordered := range index.ordered {
+		ordered.insert(entry)
+	}
+}
+
+// listCursor is the decoded form of ReceiptPage.NextCursor: the sort order
+// and the keys of the last receipt returned.
+type listCursor struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d,omitempty"`
+	ID         string `json:"i"`
+	Date       string `json:"t,omitempty"`
+	Points     int    `json:"p,omitempty"`
+	Total      int64  `json:"a,omitempty"`
+}
+
+func encodeCursor(q ReceiptQuery, last *indexEntry) string {
+	data, _ := json.Marshal(listCursor{
+		Sort:       q.Sort,
+		Descending: q.Descending,
+		ID:         last.id,
+		Date:       last.date,
+		Points:     last.points,
+		Total:      last.total,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(q ReceiptQuery) (*indexEntry, error) {
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != q.Sort || c.Descending != q.Descending || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	return &indexEntry{id: c.ID, date: c.Date, points: c.Points, total: c.Total}, nil
+}
+
+// matches reports whether the receipt of entry passes the query's filters.
+func (q ReceiptQuery) matches(entry *indexEntry, details model.ReceiptDetails) bool {
+	r := details.Receipt
+	if (q.Retailer != "" || q.CustomerID != "" || q.From != "" || q.To != "" || q.Currency != "" || q.MinTotal != nil || q.MaxTotal != nil) && r == nil {
+		return false
+	}
+	return (q.Retailer == "" || NormalizeRetailer(r.Retailer) == NormalizeRetailer(q.Retailer)) &&
+		(q.CustomerID == "" || r.CustomerID == q.CustomerID) &&
+		(q.Currency == "" || receiptCurrency(*r) == q.Currency) &&
+		(q.From == "" || r.PurchaseDate >= q.From) &&
+		(q.To == "" || r.PurchaseDate <= q.To) &&
+		(q.MinTotal == nil || entry.total >= *q.MinTotal) &&
+		(q.MaxTotal == nil || entry.total <= *q.MaxTotal) &&
+		(q.MinPoints == nil || entry.points >= *q.MinPoints) &&
+		(q.MaxPoints == nil || entry.points <= *q.MaxPoints)
+}
+
+// bounds returns the query's range on its sort key as pivot entries, nil
+// when unbounded. IDs are chosen so the pivots sort before or after every
+// receipt with the bounding key.
+func (q ReceiptQuery) bounds() (lower, upper *indexEntry) {
+	const maxID = "\U0010FFFF"
+	switch q.Sort {
+	case SortPoints:
+		if q.MinPoints != nil {
+			lower = &indexEntry{points: *q.MinPoints}
+		}
+		if q.MaxPoints != nil {
+			upper = &indexEntry{points: *q.MaxPoints, id: maxID}
+		}
+	case SortTotal:
+		if q.MinTotal != nil {
+			lower = &indexEntry{total: *q.MinTotal}
+		}
+		if q.MaxTotal != nil {
+			upper = &indexEntry{total: *q.MaxTotal, id: maxID}
+		}
+	default:
+		if q.From != "" {
+			lower = &indexEntry{date: q.From}
+		}
+		if q.To != "" {
+			upper = &indexEntry{date: q.To + maxID}
+		}
+	}
+	return lower, upper
+}
+
+// ListReceipts returns a page of the tenant's receipts that match the query,
+// in its sort order with ties broken by ID. Retailer and customer filters are
+// answered from their indexes; otherwise the index of the sort order is
+// walked from the cursor, or from the query's range on the sort key, until
+// the page is full. Totals are only comparable within one currency, so a
+// total bound needs a Currency.
+func ListReceipts(tenant string, q ReceiptQuery) (ReceiptPage, error) {
+	if (q.MinTotal != nil || q.MaxTotal != nil) && q.Currency == "" {
+		return ReceiptPage{}, ErrTotalNeedsCurrency
+	}
+	if q.Sort == "" {
+		q.Sort = SortDate
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultListLimit
+	}
+	q.Limit = min(q.Limit, MaxListLimit)
+	var cursor *indexEntry
+	if q.Cursor != "" {
+		var err error
+		if cursor, err = decodeCursor(q); err != nil {
+			return ReceiptPage{}, err
+		}
+	}
+
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	index := listingIndexes[tenant]
+	if index == nil {
+		return ReceiptPage{}, nil
+	}
+
+	// Collect up to one more receipt than the page holds to know whether
+	// there is a next page
+	var entries []*indexEntry
+	collect := func(entry *indexEntry) bool {
+		if q.matches(entry, receiptDetails[tenant][entry.id]) {
+			entries = append(entries, entry)
+		}
+		return len(entries) <= q.Limit
+	}
+
+	if candidates, ok := q.candidates(index); ok {
+		sorted := append([]*indexEntry(nil), candidates...)
+		sort.Slice(sorted, func(i, j int) bool { return q.before(sorted[i], sorted[j]) })
+		for _, entry := range sorted {
+			if cursor != nil && !q.before(cursor, entry) {
+				continue
+			}
+			if !collect(entry) {
+				break
+			}
+		}
+	} else {
+		ordered := index.ordered[q.Sort]
+		lower, upper := q.bounds()
+		if !q.Descending {
+			p := position{}
+			if cursor != nil {
+				p = ordered.seek(cursor, false)
+			} else if lower != nil {
+				p = ordered.seek(lower, true)
+			}
+			for ; ordered.valid(p); p = ordered.next(p) {
+				entry := ordered.at(p)
+				if upper != nil && compareEntries(q.Sort, entry, upper) > 0 || !collect(entry) {
+					break
+				}
+			}
+		} else {
+			p := ordered.end()
+			if cursor != nil {
+				p = ordered.seek(cursor, true)
+			} else if upper != nil {
+				p = ordered.seek(upper, false)
+			}
+			for p = ordered.prev(p); ordered.valid(p); p = ordered.prev(p) {
+				entry := ordered.at(p)
+				if lower != nil && compareEntries(q.Sort, entry, lower) < 0 || !collect(entry) {
+					break
+				}
+			}
+		}
+	}
+
+	var page ReceiptPage
+	if len(entries) > q.Limit {
+		entries = entries[:q.Limit]
+		page.NextCursor = encodeCursor(q, entries[len(entries)-1])
+	}
+	page.Receipts = make([]ListedReceipt, 0, len(entries))
+	for _, entry := range entries {
+		page.Receipts = append(page.Receipts, ListedReceipt{ID: entry.id, ReceiptDetails: receiptDetails[tenant][entry.id]})
+	}
+	return page, nil
+}
+
+// before reports whether a comes before b in the query's order.
+func (q ReceiptQuery) before(a, b *indexEntry) bool {
+	if q.Descending {
+		return compareEntries(q.Sort, a, b) > 0
+	}
+	return compareEntries(q.Sort, a, b) < 0
+}
+
+// candidates returns the receipts of the retailer or customer index the
+// query filters on, the smaller when it filters on both.
+func (q ReceiptQuery) candidates(index *listingIndex) ([]*indexEntry, bool) {
+	var candidates []*indexEntry
+	found := false
+	if q.Retailer != "" {
+		candidates, found = index.byRetailer[NormalizeRetailer(q.Retailer)], true
+	}
+	if q.CustomerID != "" {
+		if byCustomer := index.byCustomer[q.CustomerID]; !found || len(byCustomer) < len(candidates) {
+			candidates, found = byCustomer, true
+		}
+	}
+	return candidates, found
+}
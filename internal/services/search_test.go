@@ -0,0 +1,173 @@
+package services
+
+import (
+	"fmt"
+	"receipt-processor/internal/model"
+	"sort"
+	"testing"
+)
+
+// seedListing stores n receipts for tenant "list" with repeating retailers,
+// customers, dates, points, totals and currencies.
+func seedListing(t *testing.T, n int) {
+	t.Helper()
+	ResetStore()
+	t.Cleanup(ResetStore)
+	retailers := []string{"Target", "Walgreens", "M&M Corner Market"}
+	for i := 0; i < n; i++ {
+		receipt := &model.Receipt{
+			Retailer:     retailers[i%len(retailers)],
+			PurchaseDate: fmt.Sprintf("2024-01-%02d", i%28+1),
+			PurchaseTime: fmt.Sprintf("%02d:%02d", i%24, i%60),
+			Total:        fmt.Sprintf("%d.%02d", i%40, i%100),
+			CustomerID:   fmt.Sprintf("cust-%d", i%7),
+		}
+		if i%5 == 0 {
+			receipt.Currency = "EUR"
+		}
+		StoreReceipt("list", fmt.Sprintf("r%04d", i), fmt.Sprintf("h%04d", i), model.ReceiptDetails{
+			Points:  (i * 37) % 101,
+			Receipt: receipt,
+		})
+	}
+	// A receipt of another tenant is never listed
+	StoreReceipt("other", "x", "x", model.ReceiptDetails{Points: 1, Receipt: &model.Receipt{Retailer: "Target"}})
+}
+
+// listAll follows the cursors of q to the end and returns the IDs in order.
+func listAll(t *testing.T, q ReceiptQuery) []string {
+	t.Helper()
+	var ids []string
+	for pages := 0; ; pages++ {
+		if pages > 1000 {
+			t.Fatal("pagination does not terminate")
+		}
+		page, err := ListReceipts("list", q)
+		if err != nil {
+			t.Fatalf("ListReceipts() error: %v", err)
+		}
+		if len(page.Receipts) > q.Limit {
+			t.Fatalf("page of %d receipts exceeds the limit %d", len(page.Receipts), q.Limit)
+		}
+		for _, r := range page.Receipts {
+			ids = append(ids, r.ID)
+		}
+		if page.NextCursor == "" {
+			return ids
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+// expected filters and sorts every stored receipt by brute force.
+func expected(q ReceiptQuery) []string {
+	var entries []*indexEntry
+	for id, details := range receiptDetails["list"] {
+		entry := newIndexEntry(id, details)
+		if q.matches(entry, details) {
+			entries = append(entries, entry)
+		}
+	}
+	if q.Sort == "" {
+		q.Sort = SortDate
+	}
+	sort.Slice(entries, func(i, j int) bool { return q.before(entries[i], entries[j]) })
+	ids := []string{}
+	for _, entry := range entries {
+		ids = append(ids, entry.id)
+	}
+	return ids
+}
+
+func TestListReceipts(t *testing.T) {
+	// Enough receipts to split the ordered indexes into several blocks
+	seedListing(t, 1200)
+	minPoints, maxPoints := 20, 60
+	minTotal, _ := ParseAmount("10")
+	maxTotal, _ := ParseAmount("25.5")
+
+	tests := []struct {
+		name string
+		q    ReceiptQuery
+	}{
+		{"everything by date", ReceiptQuery{}},
+		{"newest first", ReceiptQuery{Descending: true}},
+		{"by points", ReceiptQuery{Sort: SortPoints}},
+		{"by total descending", ReceiptQuery{Sort: SortTotal, Descending: true}},
+		{"date range", ReceiptQuery{From: "2024-01-05", To: "2024-01-09"}},
+		{"date range descending", ReceiptQuery{From: "2024-01-05", To: "2024-01-09", Descending: true}},
+		{"points range by points", ReceiptQuery{Sort: SortPoints, MinPoints: &minPoints, MaxPoints: &maxPoints}},
+		{"points range by date", ReceiptQuery{MinPoints: &minPoints, MaxPoints: &maxPoints, Descending: true}},
+		{"total range by total", ReceiptQuery{Sort: SortTotal, Currency: "USD", MinTotal: &minTotal, MaxTotal: &maxTotal, Descending: true}},
+		{"total range by date", ReceiptQuery{Currency: "EUR", MinTotal: &minTotal}},
+		{"currency", ReceiptQuery{Currency: "EUR", Sort: SortPoints}},
+		{"retailer", ReceiptQuery{Retailer: "m&m corner market", Sort: SortPoints}},
+		{"customer", ReceiptQuery{CustomerID: "cust-3", Descending: true}},
+		{"retailer and customer", ReceiptQuery{Retailer: "Target", CustomerID: "cust-3", From: "2024-01-10"}},
+		{"no match", ReceiptQuery{Retailer: "Costco"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, limit := range []int{7, MaxListLimit} {
+				q := tt.q
+				q.Limit = limit
+				got, want := listAll(t, q), expected(q)
+				if fmt.Sprint(got) != fmt.Sprint(want) {
+					t.Errorf("limit %d: got %d receipts, want %d\ngot:  %v\nwant: %v", limit, len(got), len(want), got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestListReceipts_Limits(t *testing.T) {
+	seedListing(t, 300)
+
+	page, err := ListReceipts("list", ReceiptQuery{})
+	if err != nil || len(page.Receipts) != DefaultListLimit || page.NextCursor == "" {
+		t.Errorf("expected a default page of %d; got %d, %v", DefaultListLimit, len(page.Receipts), err)
+	}
+	page, _ = ListReceipts("list", ReceiptQuery{Limit: 1000})
+	if len(page.Receipts) != MaxListLimit {
+		t.Errorf("expected the limit to be capped at %d; got %d", MaxListLimit, len(page.Receipts))
+	}
+	page, _ = ListReceipts("list", ReceiptQuery{Limit: 300})
+	if len(page.Receipts) != MaxListLimit || page.NextCursor == "" {
+		t.Errorf("expected a next page after the cap; got %d", len(page.Receipts))
+	}
+	if page, _ := ListReceipts("nobody", ReceiptQuery{}); len(page.Receipts) != 0 || page.NextCursor != "" {
+		t.Errorf("expected no receipts for an unknown tenant; got %+v", page)
+	}
+
+	// Totals in different currencies are not compared
+	minTotal, _ := ParseAmount("10")
+	if _, err := ListReceipts("list", ReceiptQuery{MinTotal: &minTotal}); err != ErrTotalNeedsCurrency {
+		t.Errorf("expected ErrTotalNeedsCurrency; got %v", err)
+	}
+
+	// A cursor is only valid for the order it was issued for
+	first, _ := ListReceipts("list", ReceiptQuery{Limit: 5})
+	for _, q := range []ReceiptQuery{
+		{Cursor: first.NextCursor, Sort: SortPoints},
+		{Cursor: first.NextCursor, Descending: true},
+		{Cursor: "not a cursor"},
+		{Cursor: "e30"}, // {}
+	} {
+		if _, err := ListReceipts("list", q); err != ErrInvalidCursor {
+			t.Errorf("expected ErrInvalidCursor for %+v; got %v", q, err)
+		}
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	for input, want := range map[string]int64{"12": 120000, "12.5": 125000, "0.0001": 1, "1.2345": 12345} {
+		if got, ok := ParseAmount(input); !ok || got != want {
+			t.Errorf("ParseAmount(%q) = %d, %v; want %d", input, got, ok, want)
+		}
+	}
+	for _, input := range []string{"", "-1", "1.23456", "1e3", "1."} {
+		if _, ok := ParseAmount(input); ok {
+			t.Errorf("expected ParseAmount(%q) to fail", input)
+		}
+	}
+}
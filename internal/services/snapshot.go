@@ -0,0 +1,247 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/model"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SnapshotVersion is the on-disk store format written by this release.
+const SnapshotVersion = 1
+
+// Errors returned when importing receipts.
+var (
+	ErrDuplicateID      = errors.New("a receipt with this ID already exists")
+	ErrDuplicateReceipt = errors.New("receipt was already processed")
+)
+
+// StoredReceipt is a receipt as kept in the store, in snapshots and in exports.
+type StoredReceipt struct {
+	ID     string `json:"id"`
+	Tenant string `json:"tenant"`
+	Hash   string `json:"hash,omitempty"`
+	model.ReceiptDetails
+}
+
+// Snapshot is the on-disk form of the receipt store.
+type Snapshot struct {
+	Version  int             `json:"version"`
+	SavedAt  time.Time       `json:"savedAt"`
+	Receipts []StoredReceipt `json:"receipts"`
+}
+
+// snapshotMigrations upgrade a raw snapshot document from the keyed version
+// to the next one. Add an entry whenever SnapshotVersion is bumped.
+var snapshotMigrations = map[int]func(doc map[string]json.RawMessage) error{}
+
+// ListStoredReceipts returns every stored receipt, ordered by tenant and ID.
+// An empty tenant lists all tenants.
+func ListStoredReceipts(tenant string) []StoredReceipt {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return listStoredReceiptsLocked(tenant)
+}
+
+func listStoredReceiptsLocked(tenant string) []StoredReceipt {
+	var list []StoredReceipt
+	for t, hashes := range receipts {
+		if tenant != "" && t != tenant {
+			continue
+		}
+		for hash, id := range hashes {
+			list = append(list, StoredReceipt{
+				ID:             id,
+				Tenant:         t,
+				Hash:           hash,
+				ReceiptDetails: receiptDetails[t][id],
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Tenant != list[j].Tenant {
+			return list[i].Tenant < list[j].Tenant
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// ImportReceipt adds a previously processed receipt, keeping its ID. The hash
+// is recomputed from the receipt when it is not given.
+func ImportReceipt(r StoredReceipt) error {
+	if r.ID == "" {
+		return errors.New("receipt ID is required")
+	}
+	if r.Tenant == "" {
+		r.Tenant = DefaultTenant
+	}
+	if r.Hash == "" {
+		if r.Receipt == nil {
+			return errors.New("receipt or hash is required")
+		}
+		r.Hash = GenerateHash(*r.Receipt)
+	}
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	if _, exists := receiptDetails[r.Tenant][r.ID]; exists {
+		return ErrDuplicateID
+	}
+	if _, exists := receipts[r.Tenant][r.Hash]; exists {
+		return ErrDuplicateReceipt
+	}
+	storeReceiptLocked(r.Tenant, r.ID, r.Hash, r.ReceiptDetails)
+	return nil
+}
+
+// ResetStore removes every stored receipt.
+func ResetStore() {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	receipts = map[string]map[string]string{}
+	receiptDetails = map[string]map[string]model.ReceiptDetails{}
+	promotionUses = map[string]map[string]map[string]int{}
+	customerDailyPoints = map[string]map[string]map[string]int{}
+	listingIndexes = map[string]*listingIndex{}
+	storeRevision++
+}
+
+// SaveSnapshot atomically writes the store to path. It returns the store
+// revision that was saved.
+func SaveSnapshot(path string) (uint64, error) {
+	storeMu.RLock()
+	snapshot := Snapshot{
+		Version:  SnapshotVersion,
+		SavedAt:  time.Now().UTC(),
+		Receipts: listStoredReceiptsLocked(""),
+	}
+	revision := storeRevision
+	storeMu.RUnlock()
+
+	if err := WriteSnapshot(path, &snapshot); err != nil {
+		return 0, err
+	}
+	logger.Info("Saved store snapshot", logrus.Fields{
+		"path":     path,
+		"receipts": len(snapshot.Receipts),
+	})
+	return revision, nil
+}
+
+// WriteSnapshot atomically writes snapshot to path via a temporary file.
+func WriteSnapshot(path string, snapshot *Snapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("encoding snapshot: %v", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("writing snapshot: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing snapshot: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing snapshot: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("writing snapshot: %v", err)
+	}
+	return nil
+}
+
+// ReadSnapshot reads the snapshot at path. It refuses files that need
+// migrating; use MigrateSnapshot for those.
+func ReadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("parsing snapshot: %v", err)
+	}
+	if snapshot.Version != SnapshotVersion {
+		return nil, fmt.Errorf("snapshot is format version %d, expected %d: run the migrate command", snapshot.Version, SnapshotVersion)
+	}
+	return &snapshot, nil
+}
+
+// LoadSnapshot replaces the store contents with the snapshot at path. A
+// missing file leaves the store empty.
+func LoadSnapshot(path string) error {
+	snapshot, err := ReadSnapshot(path)
+	if errors.Is(err, os.ErrNotExist) {
+		ResetStore()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ResetStore()
+	for _, r := range snapshot.Receipts {
+		if err := ImportReceipt(r); err != nil {
+			return fmt.Errorf("loading receipt %s: %v", r.ID, err)
+		}
+	}
+	logger.Info("Loaded store snapshot", logrus.Fields{
+		"path":     path,
+		"receipts": len(snapshot.Receipts),
+	})
+	return nil
+}
+
+// MigrateSnapshot upgrades a snapshot document to SnapshotVersion and returns
+// it along with the version it was upgraded from.
+func MigrateSnapshot(data []byte) (*Snapshot, int, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, 0, fmt.Errorf("parsing snapshot: %v", err)
+	}
+	var from int
+	if err := json.Unmarshal(doc["version"], &from); err != nil || from < 1 {
+		return nil, 0, errors.New("parsing snapshot: missing or invalid version")
+	}
+	if from > SnapshotVersion {
+		return nil, from, fmt.Errorf("snapshot is format version %d, newer than supported version %d", from, SnapshotVersion)
+	}
+
+	for version := from; version < SnapshotVersion; version++ {
+		migrate, ok := snapshotMigrations[version]
+		if !ok {
+			return nil, from, fmt.Errorf("no migration from snapshot version %d", version)
+		}
+		if err := migrate(doc); err != nil {
+			return nil, from, fmt.Errorf("migrating snapshot from version %d: %v", version, err)
+		}
+		doc["version"], _ = json.Marshal(version + 1)
+	}
+
+	upgraded, err := json.Marshal(doc)
+	if err != nil {
+		return nil, from, err
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(upgraded, &snapshot); err != nil {
+		return nil, from, fmt.Errorf("parsing migrated snapshot: %v", err)
+	}
+	return &snapshot, from, nil
+}
+
+// StoreRevision returns a counter that changes whenever the store is written.
+func StoreRevision() uint64 {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+	return storeRevision
+}
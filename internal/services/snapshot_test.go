@@ -0,0 +1,101 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"receipt-processor/internal/model"
+	"testing"
+)
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	t.Cleanup(ResetStore)
+	ResetStore()
+
+	receipt := model.Receipt{Retailer: "Target", PurchaseDate: "2022-01-01", PurchaseTime: "13:01", Total: "1.25"}
+	StoreReceipt(DefaultTenant, "id-1", GenerateHash(receipt), model.ReceiptDetails{Points: 31, Receipt: &receipt})
+	StoreReceipt("acme", "id-2", "hash-2", model.ReceiptDetails{Points: 7, SubmittedBy: "pos"})
+
+	path := filepath.Join(t.TempDir(), "store.json")
+	if _, err := SaveSnapshot(path); err != nil {
+		t.Fatalf("SaveSnapshot() error: %v", err)
+	}
+
+	ResetStore()
+	if err := LoadSnapshot(path); err != nil {
+		t.Fatalf("LoadSnapshot() error: %v", err)
+	}
+	list := ListStoredReceipts("")
+	if len(list) != 2 {
+		t.Fatalf("expected 2 receipts after reload; got %d", len(list))
+	}
+	if list[0].Tenant != "acme" || list[0].Points != 7 || list[0].SubmittedBy != "pos" {
+		t.Errorf("unexpected first receipt: %+v", list[0])
+	}
+	if list[1].Receipt == nil || list[1].Receipt.Retailer != "Target" {
+		t.Errorf("expected the receipt document to survive a reload; got %+v", list[1])
+	}
+	if id, found := CheckReceipt(DefaultTenant, GenerateHash(receipt)); !found || id != "id-1" {
+		t.Errorf("expected dedup entry to survive a reload; got %q, %v", id, found)
+	}
+}
+
+func TestLoadSnapshot_Missing(t *testing.T) {
+	t.Cleanup(ResetStore)
+	StoreReceipt(DefaultTenant, "stale", "stale-hash", model.ReceiptDetails{})
+
+	if err := LoadSnapshot(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Fatalf("LoadSnapshot() error: %v", err)
+	}
+	if list := ListStoredReceipts(""); len(list) != 0 {
+		t.Errorf("expected an empty store; got %d receipts", len(list))
+	}
+}
+
+func TestImportReceipt_Duplicates(t *testing.T) {
+	t.Cleanup(ResetStore)
+	ResetStore()
+
+	receipt := model.Receipt{Retailer: "Target", Total: "1.00"}
+	if err := ImportReceipt(StoredReceipt{ID: "a", ReceiptDetails: model.ReceiptDetails{Receipt: &receipt}}); err != nil {
+		t.Fatalf("ImportReceipt() error: %v", err)
+	}
+	err := ImportReceipt(StoredReceipt{ID: "a", Hash: "other"})
+	if !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("expected ErrDuplicateID; got %v", err)
+	}
+	err = ImportReceipt(StoredReceipt{ID: "b", ReceiptDetails: model.ReceiptDetails{Receipt: &receipt}})
+	if !errors.Is(err, ErrDuplicateReceipt) {
+		t.Errorf("expected ErrDuplicateReceipt; got %v", err)
+	}
+	// The same receipt is not a duplicate for another tenant
+	if err := ImportReceipt(StoredReceipt{ID: "a", Tenant: "acme", ReceiptDetails: model.ReceiptDetails{Receipt: &receipt}}); err != nil {
+		t.Errorf("ImportReceipt() for another tenant error: %v", err)
+	}
+}
+
+func TestMigrateSnapshot(t *testing.T) {
+	snapshot, from, err := MigrateSnapshot([]byte(`{"version": 1, "receipts": [{"id": "a", "tenant": "default", "points": 3}]}`))
+	if err != nil {
+		t.Fatalf("MigrateSnapshot() error: %v", err)
+	}
+	if from != 1 || snapshot.Version != SnapshotVersion || len(snapshot.Receipts) != 1 {
+		t.Errorf("unexpected migration result: from %d, %+v", from, snapshot)
+	}
+
+	for _, doc := range []string{`{"receipts": []}`, `{"version": 99}`, `not json`} {
+		if _, _, err := MigrateSnapshot([]byte(doc)); err == nil {
+			t.Errorf("expected an error migrating %s", doc)
+		}
+	}
+}
+
+func TestReadSnapshot_WrongVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	if err := os.WriteFile(path, []byte(`{"version": 99}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadSnapshot(path); err == nil {
+		t.Error("expected an error reading a snapshot of another version")
+	}
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"sort"
+	"strings"
+)
+
+// StoreFilter selects the stores aggregated by StoreStats. Empty fields match
+// every store.
+type StoreFilter struct {
+	StoreID    string
+	Retailer   string // matched like promotion retailers
+	Region     string
+	PostalCode string // prefix, so "606" matches every Chicago ZIP code
+}
+
+// StoreStat aggregates a tenant's stored receipts from one store.
+type StoreStat struct {
+	Retailer      string  `json:"retailer"`
+	StoreID       string  `json:"storeId"`
+	Address       string  `json:"address,omitempty"`
+	PostalCode    string  `json:"postalCode,omitempty"`
+	Region        string  `json:"region,omitempty"`
+	Receipts      int     `json:"receipts"`
+	Points        int     `json:"points"`
+	AveragePoints float64 `json:"averagePoints"`
+	FirstPurchase string  `json:"firstPurchase"` // earliest purchase date
+	LastPurchase  string  `json:"lastPurchase"`  // latest purchase date
+}
+
+// StoreStats aggregates the tenant's receipts that carry store metadata, one
+// entry per retailer and store ID, ordered by retailer and store ID. Store ID,
+// address, postal code and region are taken from the most recent purchase.
+func StoreStats(tenant string, filter StoreFilter) []StoreStat {
+	storeMu.RLock()
+	defer storeMu.RUnlock()
+
+	stats := map[string]*StoreStat{}
+	for _, details := range receiptDetails[tenant] {
+		receipt := details.Receipt
+		if receipt == nil || receipt.Store == nil {
+			continue
+		}
+		store := receipt.Store
+		if filter.StoreID != "" && !strings.EqualFold(store.ID, filter.StoreID) ||
+			filter.Retailer != "" && NormalizeRetailer(receipt.Retailer) != NormalizeRetailer(filter.Retailer) ||
+			filter.Region != "" && !strings.EqualFold(store.Region, filter.Region) ||
+			filter.PostalCode != "" && !strings.HasPrefix(strings.ToUpper(store.PostalCode), strings.ToUpper(filter.PostalCode)) {
+			continue
+		}
+
+		// Store IDs are grouped ignoring case, as the filter matches them
+		key := NormalizeRetailer(receipt.Retailer) + "\x00" + strings.ToLower(store.ID)
+		stat, ok := stats[key]
+		if !ok {
+			stat = &StoreStat{Retailer: receipt.Retailer, StoreID: store.ID, FirstPurchase: receipt.PurchaseDate}
+			stats[key] = stat
+		}
+		stat.Receipts++
+		stat.Points += details.Points
+		if receipt.PurchaseDate < stat.FirstPurchase {
+			stat.FirstPurchase = receipt.PurchaseDate
+		}
+		if receipt.PurchaseDate >= stat.LastPurchase {
+			stat.LastPurchase = receipt.PurchaseDate
+			stat.StoreID, stat.Address, stat.PostalCode, stat.Region = store.ID, store.Address, store.PostalCode, store.Region
+		}
+	}
+
+	list := make([]StoreStat, 0, len(stats))
+	for _, stat := range stats {
+		stat.AveragePoints = float64(stat.Points) / float64(stat.Receipts)
+		list = append(list, *stat)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Retailer != list[j].Retailer {
+			return list[i].Retailer < list[j].Retailer
+		}
+		return list[i].StoreID < list[j].StoreID
+	})
+	return list
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"receipt-processor/internal/model"
+	"receipt-processor/internal/utility"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScoreReceipt_Timezone(t *testing.T) {
+	// 14:30 in Tokyo is 05:30 UTC; the afternoon rule uses the local time
+	receipt := model.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2024-03-11",
+		PurchaseTime: "14:30",
+		Items:        []model.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}},
+		Total:        "6.49",
+		Timezone:     "Asia/Tokyo",
+	}
+	rs := DefaultRuleset()
+
+	score := ScoreReceipt(receipt, rs)
+	if !hasRule(score, RuleAfternoon) || !hasRule(score, RuleOddDay) {
+		t.Errorf("expected the odd day and afternoon rules in local time; got\n%s", score.Explanation())
+	}
+	if !strings.Contains(score.Explanation(), "between 2:00pm and 4:00pm (Asia/Tokyo)") {
+		t.Errorf("expected explanation to name the time zone; got %q", score.Explanation())
+	}
+
+	// A retailer time zone from the ruleset applies when the receipt has none
+	receipt.Timezone = ""
+	rs.RetailerTimezones = map[string]string{"TARGET": "America/New_York"}
+	if explanation := ScoreReceipt(receipt, rs).Explanation(); !strings.Contains(explanation, "(America/New_York)") {
+		t.Errorf("expected the retailer time zone to apply; got %q", explanation)
+	}
+
+	// Without any time zone the breakdown is unchanged
+	rs.RetailerTimezones = nil
+	if explanation := ScoreReceipt(receipt, rs).Explanation(); !strings.Contains(explanation, "between 2:00pm and 4:00pm\n") {
+		t.Errorf("expected no time zone in the explanation; got %q", explanation)
+	}
+}
+
+func TestScoreReceipt_DSTGap(t *testing.T) {
+	// 02:30 does not exist in New York on 2024-03-10; the wall-clock time is
+	// scored as submitted rather than moved to 03:30
+	receipt := model.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2024-03-10",
+		PurchaseTime: "02:30",
+		Items:        []model.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}},
+		Total:        "6.49",
+		Timezone:     "America/New_York",
+	}
+	rs := DefaultRuleset()
+	rs.AfternoonStartHour, rs.AfternoonEndHour = 2, 3
+
+	score := ScoreReceipt(receipt, rs)
+	if !hasRule(score, RuleAfternoon) {
+		t.Errorf("expected 02:30 to be scored in the 2am-3am window; got\n%s", score.Explanation())
+	}
+	if hasRule(score, RuleOddDay) {
+		t.Errorf("expected the purchase date to stay even; got\n%s", score.Explanation())
+	}
+}
+
+func TestValidateReceipt_Timezone(t *testing.T) {
+	defer func(now func() time.Time) { utility.Now = now }(utility.Now)
+	// Just after midnight on 2024-03-21 in Sydney, still 2024-03-20 in UTC
+	utility.Now = func() time.Time { return time.Date(2024, 3, 20, 13, 30, 0, 0, time.UTC) }
+
+	receipt := model.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: "2024-03-21",
+		PurchaseTime: "00:10",
+		Items:        []model.Item{{ShortDescription: "Mountain Dew 12PK", Price: "6.49"}},
+		Total:        "6.49",
+	}
+	rs := DefaultRuleset()
+	rs.Timezone = "UTC"
+	if err := ValidateReceipt(receipt, rs); err == nil {
+		t.Error("expected a future date in UTC to be rejected")
+	}
+
+	receipt.Timezone = "Australia/Sydney"
+	if err := ValidateReceipt(receipt, rs); err != nil {
+		t.Errorf("expected today in Sydney to be accepted; got %v", err)
+	}
+
+	rs.RetailerTimezones = map[string]string{"Target": "Australia/Sydney"}
+	receipt.Timezone = ""
+	if err := ValidateReceipt(receipt, rs); err != nil {
+		t.Errorf("expected the retailer time zone to be used; got %v", err)
+	}
+
+	receipt.Timezone = "Nowhere/Special"
+	if err := ValidateReceipt(receipt, rs); err == nil {
+		t.Error("expected an unknown time zone to be rejected")
+	}
+}
+
+func TestRuleset_ValidateTimezones(t *testing.T) {
+	rs := DefaultRuleset()
+	rs.Timezone = "Mars/Olympus"
+	if err := rs.Validate(); err == nil {
+		t.Error("expected an unknown timezone to be rejected")
+	}
+	rs = DefaultRuleset()
+	rs.RetailerTimezones = map[string]string{"Target": "Local"}
+	if err := rs.Validate(); err == nil {
+		t.Error("expected Local to be rejected")
+	}
+}
+
+func hasRule(score Score, rule string) bool {
+	for _, result := range score.Breakdown {
+		if result.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"receipt-processor/internal/auth"
+	"receipt-processor/internal/logger"
+	"receipt-processor/internal/services"
+	"receipt-processor/internal/utility"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Header lets a caller name its tenant when it is not implied by the API key.
+const Header = "X-Tenant-ID"
+
+type contextKey struct{}
+
+// ValidID reports whether id is an acceptable tenant ID.
+func ValidID(id string) bool {
+	return utility.IsValidTenantID(id)
+}
+
+// ResolveError is returned when a request names a tenant it may not use.
+type ResolveError struct {
+	Status  int
+	Message string
+}
+
+func (e *ResolveError) Error() string {
+	return e.Message
+}
+
+// Resolve determines the tenant for a request.
+//
+// A key bound to a tenant always acts as that tenant; a conflicting header is
+// rejected. Any other authenticated key may only pick a tenant with the header
+// if it has the admin scope. Without authentication the header is trusted.
+// Requests that name no tenant use services.DefaultTenant.
+func Resolve(r *http.Request) (string, error) {
+	return ResolveRequested(r.Context(), r.Header.Get(Header))
+}
+
+// ResolveRequested is Resolve for a caller that asked for the requested tenant
+// (none when empty), authenticated by the key in ctx if any. It serves
+// transports other than HTTP.
+func ResolveRequested(ctx context.Context, requested string) (string, error) {
+	if requested != "" && !ValidID(requested) {
+		return "", &ResolveError{Status: http.StatusBadRequest, Message: "Invalid tenant ID"}
+	}
+
+	key, authenticated := auth.KeyFromContext(ctx)
+	switch {
+	case authenticated && key.Tenant != "":
+		if requested != "" && requested != key.Tenant {
+			return "", &ResolveError{
+				Status:  http.StatusForbidden,
+				Message: fmt.Sprintf("API key is not permitted to access tenant %s", requested),
+			}
+		}
+		return key.Tenant, nil
+	case authenticated && requested != "" && !key.HasScope(auth.ScopeAdmin):
+		return "", &ResolveError{
+			Status:  http.StatusForbidden,
+			Message: fmt.Sprintf("API key is not permitted to access tenant %s", requested),
+		}
+	case requested != "":
+		return requested, nil
+	default:
+		return services.DefaultTenant, nil
+	}
+}
+
+// Middleware resolves the request's tenant and stores it in the request context.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, err := Resolve(r)
+		if err != nil {
+			status := http.StatusBadRequest
+			if resolveErr, ok := err.(*ResolveError); ok {
+				status = resolveErr.Status
+			}
+			logger.Warn("Rejected request for tenant", logrus.Fields{
+				"tenant": r.Header.Get(Header),
+				"error":  err,
+				"uri":    r.RequestURI,
+			})
+			utility.WriteError(w, err.Error(), status)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), tenant)))
+	})
+}
+
+// WithTenant returns a copy of ctx carrying tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, contextKey{}, tenant)
+}
+
+// FromContext returns the tenant stored in ctx, or services.DefaultTenant.
+func FromContext(ctx context.Context) string {
+	if tenant, ok := ctx.Value(contextKey{}).(string); ok && tenant != "" {
+		return tenant
+	}
+	return services.DefaultTenant
+}
@@ -0,0 +1,85 @@
+package tenant
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"receipt-processor/internal/auth"
+	"receipt-processor/internal/services"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	bound := auth.Key{ID: "pos-a", Tenant: "partner-a", Scopes: []string{auth.ScopeReceiptsWrite}}
+	unbound := auth.Key{ID: "reporting", Scopes: []string{auth.ScopeReceiptsRead}}
+	admin := auth.Key{ID: "ops", Scopes: []string{auth.ScopeAdmin}}
+
+	tests := []struct {
+		name     string
+		key      *auth.Key
+		header   string
+		expected string
+		status   int
+	}{
+		{"no auth, no header", nil, "", services.DefaultTenant, 0},
+		{"no auth, header", nil, "partner-b", "partner-b", 0},
+		{"invalid header", nil, "../etc", "", http.StatusBadRequest},
+		{"bound key", &bound, "", "partner-a", 0},
+		{"bound key, matching header", &bound, "partner-a", "partner-a", 0},
+		{"bound key, other tenant", &bound, "partner-b", "", http.StatusForbidden},
+		{"unbound key, no header", &unbound, "", services.DefaultTenant, 0},
+		{"unbound key, other tenant", &unbound, "partner-b", "", http.StatusForbidden},
+		{"admin key, other tenant", &admin, "partner-b", "partner-b", 0},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if test.key != nil {
+			req = req.WithContext(auth.WithKey(req.Context(), *test.key))
+		}
+		if test.header != "" {
+			req.Header.Set(Header, test.header)
+		}
+
+		got, err := Resolve(req)
+		if test.status != 0 {
+			resolveErr, ok := err.(*ResolveError)
+			if !ok || resolveErr.Status != test.status {
+				t.Errorf("%s: expected error with status %d; got %v", test.name, test.status, err)
+			}
+			continue
+		}
+		if err != nil || got != test.expected {
+			t.Errorf("%s: Resolve() = %q, %v; want %q", test.name, got, err, test.expected)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var seen string
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(Header, "partner-a")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if seen != "partner-a" {
+		t.Errorf("expected handler to see tenant partner-a; got %q", seen)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(auth.WithKey(req.Context(), auth.Key{ID: "pos", Tenant: "partner-a", Scopes: []string{auth.ScopeReceiptsRead}}))
+	req.Header.Set(Header, "partner-b")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for cross-tenant request; got %d", rr.Code)
+	}
+}
+
+func TestFromContext_Default(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if got := FromContext(req.Context()); got != services.DefaultTenant {
+		t.Errorf("FromContext() = %q; want %q", got, services.DefaultTenant)
+	}
+}
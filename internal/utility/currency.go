@@ -0,0 +1,110 @@
+package utility
+
+import (
+	"errors"
+	"receipt-processor/internal/logger"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultCurrency is assumed for amounts that do not name a currency.
+const DefaultCurrency = "USD"
+
+// currencyMinorUnits maps ISO 4217 codes to the number of decimal places of
+// their amounts. Codes not listed in currencyExceptions use two.
+var currencyMinorUnits = func() map[string]int {
+	units := map[string]int{}
+	for _, code := range strings.Fields(`
+		AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BMD BND BOB BOV
+		BRL BSD BTN BWP BYN BZD CAD CDF CHE CHF CHW CNY COP COU CRC CUP CVE CZK
+		DKK DOP DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GTQ GYD HKD HNL
+		HTG HUF IDR ILS INR IRR JMD KES KGS KHR KPW KYD KZT LAK LBP LKR LRD LSL
+		MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MXV MYR MZN NAD NGN NIO
+		NOK NPR NZD PAB PEN PGK PHP PKR PLN QAR RON RSD RUB SAR SBD SCR SDG SEK
+		SGD SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS TMT TOP TRY TTD TWD TZS
+		UAH USD USN UYU UZS VED VES WST XCD YER ZAR ZMW ZWG`) {
+		units[code] = 2
+	}
+	for code, minor := range currencyExceptions {
+		units[code] = minor
+	}
+	return units
+}()
+
+var currencyExceptions = map[string]int{
+	"BIF": 0, "CLP": 0, "DJF": 0, "GNF": 0, "ISK": 0, "JPY": 0, "KMF": 0, "KRW": 0, "PYG": 0,
+	"RWF": 0, "UGX": 0, "UYI": 0, "VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+	"CLF": 4, "UYW": 4,
+}
+
+// amountRegexes holds the amount format for each number of minor units.
+var amountRegexes = map[int]*regexp.Regexp{
+	0: regexp.MustCompile(`^\d+$`),
+	2: priceRegex,
+	3: regexp.MustCompile(`^\d+\.\d{3}$`),
+	4: regexp.MustCompile(`^\d+\.\d{4}$`),
+}
+
+// MinorUnits returns the number of decimal places of an ISO 4217 currency,
+// e.g. 2 for USD, 0 for JPY and 3 for KWD. An empty code is DefaultCurrency.
+func MinorUnits(currency string) (int, bool) {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	minor, ok := currencyMinorUnits[currency]
+	return minor, ok
+}
+
+// IsValidCurrency validates an ISO 4217 currency code.
+func IsValidCurrency(currency string) bool {
+	_, ok := currencyMinorUnits[currency]
+	if !ok {
+		logger.Error("Invalid currency", logrus.Fields{
+			"currency": currency,
+		})
+	}
+	return ok
+}
+
+// IsValidAmount validates an amount in the currency: a non-negative number
+// with exactly the currency's decimal places, such as "12.34" USD, "1200" JPY
+// or "1.250" KWD.
+func IsValidAmount(str, currency string) bool {
+	minor, ok := MinorUnits(currency)
+	if !ok || !amountRegexes[minor].MatchString(str) {
+		logger.Error("Invalid amount format", logrus.Fields{
+			"amount":   str,
+			"currency": currency,
+		})
+		return false
+	}
+	return true
+}
+
+// ParseMinorUnits converts an amount in the currency to an integer number of
+// minor units, e.g. "12.34" USD is 1234 and "1200" JPY is 1200.
+func ParseMinorUnits(str, currency string) (int64, error) {
+	if !IsValidAmount(str, currency) {
+		return 0, errors.New("invalid amount " + strconv.Quote(str))
+	}
+	return strconv.ParseInt(strings.Replace(str, ".", "", 1), 10, 64)
+}
+
+// AmountFormat describes the amount format of the currency for error
+// messages, e.g. "two decimal places".
+func AmountFormat(currency string) string {
+	switch minor, _ := MinorUnits(currency); minor {
+	case 0:
+		return "no decimal places"
+	case 3:
+		return "three decimal places"
+	case 4:
+		return "four decimal places"
+	default:
+		return "two decimal places"
+	}
+}
@@ -0,0 +1,46 @@
+package utility
+
+import "testing"
+
+func TestIsValidAmount(t *testing.T) {
+	tests := []struct {
+		amount, currency string
+		expected         bool
+	}{
+		{"12.34", "", true},
+		{"12.34", "USD", true},
+		{"12.3", "USD", false},
+		{"1200", "JPY", true},
+		{"1200.00", "JPY", false},
+		{"1.250", "KWD", true},
+		{"1.25", "KWD", false},
+		{"12.34", "XXX", false},
+		{"-1.00", "EUR", false},
+	}
+	for _, test := range tests {
+		if result := IsValidAmount(test.amount, test.currency); result != test.expected {
+			t.Errorf("IsValidAmount(%q, %q) = %v; want %v", test.amount, test.currency, result, test.expected)
+		}
+	}
+}
+
+func TestParseMinorUnits(t *testing.T) {
+	tests := []struct {
+		amount, currency string
+		expected         int64
+	}{
+		{"12.34", "USD", 1234},
+		{"0.05", "", 5},
+		{"1200", "JPY", 1200},
+		{"1.250", "KWD", 1250},
+	}
+	for _, test := range tests {
+		result, err := ParseMinorUnits(test.amount, test.currency)
+		if err != nil || result != test.expected {
+			t.Errorf("ParseMinorUnits(%q, %q) = %d, %v; want %d", test.amount, test.currency, result, err, test.expected)
+		}
+	}
+	if _, err := ParseMinorUnits("1.2", "USD"); err == nil {
+		t.Error("expected an error for a malformed amount")
+	}
+}
@@ -41,3 +41,16 @@ func WriteJSON(w http.ResponseWriter, data interface{}) {
 		})
 	}
 }
+
+// WriteJSONWithStatus sends a JSON formatted response with the given status code.
+func WriteJSONWithStatus(w http.ResponseWriter, data interface{}, statusCode int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		logger.Error("JSON encoding error", logrus.Fields{
+			"response_data":  data,
+			"status_code":    statusCode,
+			"encoding_error": err,
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package utility
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"receipt-processor/internal/logger"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Media types a response can be negotiated to.
+const (
+	MediaJSON = "application/json"
+	MediaXML  = "application/xml"
+	MediaCSV  = "text/csv"
+)
+
+// Tabular is a response that can be written as CSV. Columns are named like
+// the fields of its JSON form.
+type Tabular interface {
+	CSVHeader() []string
+	CSVRows() [][]string
+}
+
+// EscapeCSVCell guards a CSV cell against formula injection: a cell starting
+// with '=', '+', '-' or '@' gets a leading apostrophe, so spreadsheets show it
+// as text instead of evaluating it. A cell that already looks escaped gets
+// another apostrophe, so UnescapeCSVCell always restores the original.
+func EscapeCSVCell(cell string) string {
+	if needsCSVEscape(cell) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// UnescapeCSVCell removes the apostrophe added by EscapeCSVCell.
+func UnescapeCSVCell(cell string) string {
+	if strings.HasPrefix(cell, "'") && needsCSVEscape(cell[1:]) {
+		return cell[1:]
+	}
+	return cell
+}
+
+func needsCSVEscape(cell string) bool {
+	if cell == "" {
+		return false
+	}
+	if strings.ContainsRune("=+-@", rune(cell[0])) {
+		return true
+	}
+	return cell[0] == '\'' && needsCSVEscape(cell[1:])
+}
+
+// EscapeCSVRow returns row with every cell passed through EscapeCSVCell.
+func EscapeCSVRow(row []string) []string {
+	escaped := make([]string, len(row))
+	for i, cell := range row {
+		escaped[i] = EscapeCSVCell(cell)
+	}
+	return escaped
+}
+
+// Negotiate picks the offer the request's Accept header ranks highest, with
+// ties going to the earlier offer. text/xml counts as application/xml. It
+// returns false when no offer is acceptable; a request without an Accept
+// header gets the first offer.
+func Negotiate(r *http.Request, offers ...string) (string, bool) {
+	accept := strings.TrimSpace(r.Header.Get("Accept"))
+	if accept == "" {
+		return offers[0], true
+	}
+
+	best, bestQuality := "", 0.0
+	for _, offer := range offers {
+		quality, specificity := 0.0, -1
+		for _, entry := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(entry))
+			if err != nil {
+				continue
+			}
+			if mediaType == "text/xml" {
+				mediaType = MediaXML
+			}
+			q := 1.0
+			if value, ok := params["q"]; ok {
+				if q, err = strconv.ParseFloat(value, 64); err != nil {
+					continue
+				}
+			}
+			// The most specific matching range sets the quality
+			offerType, _, _ := strings.Cut(offer, "/")
+			rangeType, rangeSubtype, _ := strings.Cut(mediaType, "/")
+			s := -1
+			switch {
+			case mediaType == offer:
+				s = 2
+			case rangeType == offerType && rangeSubtype == "*":
+				s = 1
+			case mediaType == "*/*":
+				s = 0
+			}
+			if s > specificity {
+				quality, specificity = q, s
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = offer, quality
+		}
+	}
+	return best, best != ""
+}
+
+// WriteFormatted sends data in the negotiated media type: JSON, XML (data
+// needs xml tags) or CSV (data must be Tabular, and its cells are escaped
+// with EscapeCSVCell).
+func WriteFormatted(w http.ResponseWriter, mediaType string, data interface{}, statusCode int) {
+	w.Header().Add("Vary", "Accept")
+	var err error
+	switch mediaType {
+	case MediaXML:
+		w.Header().Set("Content-Type", MediaXML+"; charset=utf-8")
+		w.WriteHeader(statusCode)
+		encoder := xml.NewEncoder(w)
+		if _, err = w.Write([]byte(xml.Header)); err == nil {
+			if err = encoder.Encode(data); err == nil {
+				_, err = w.Write([]byte("\n"))
+			}
+		}
+	case MediaCSV:
+		table, ok := data.(Tabular)
+		if !ok {
+			logger.Error("Response cannot be written as CSV", logrus.Fields{
+				"response_data": data,
+			})
+			WriteError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", MediaCSV+"; charset=utf-8")
+		w.WriteHeader(statusCode)
+		writer := csv.NewWriter(w)
+		writer.Write(EscapeCSVRow(table.CSVHeader()))
+		for _, row := range table.CSVRows() {
+			writer.Write(EscapeCSVRow(row))
+		}
+		writer.Flush()
+		err = writer.Error()
+	default:
+		WriteJSONWithStatus(w, data, statusCode)
+		return
+	}
+	if err != nil {
+		logger.Error("Response encoding error", logrus.Fields{
+			"media_type":     mediaType,
+			"response_data":  data,
+			"encoding_error": err,
+		})
+	}
+}
+
+// errorResponse is the body WriteError sends, for the other media types.
+type errorResponse struct {
+	XMLName xml.Name `xml:"error"`
+	Message string   `xml:",chardata"`
+}
+
+func (e errorResponse) CSVHeader() []string { return []string{"error"} }
+func (e errorResponse) CSVRows() [][]string { return [][]string{{e.Message}} }
+
+// WriteFormattedError is WriteError in the negotiated media type:
+// <error>message</error> in XML and an error column in CSV.
+func WriteFormattedError(w http.ResponseWriter, mediaType string, errMsg string, statusCode int) {
+	if mediaType != MediaXML && mediaType != MediaCSV {
+		WriteError(w, errMsg, statusCode)
+		return
+	}
+	WriteFormatted(w, mediaType, errorResponse{Message: errMsg}, statusCode)
+	logger.Info("Error response sent", logrus.Fields{
+		"error_message": errMsg,
+		"status_code":   statusCode,
+		"media_type":    mediaType,
+	})
+}
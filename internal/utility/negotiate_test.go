@@ -0,0 +1,95 @@
+package utility
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{MediaJSON, MediaXML, MediaCSV}
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", MediaJSON},
+		{"*/*", MediaJSON},
+		{"application/xml", MediaXML},
+		{"text/xml", MediaXML},
+		{"text/*", MediaCSV},
+		{"text/csv;q=0.5, application/xml;q=0.9", MediaXML},
+		{"application/*;q=0.1, text/csv", MediaCSV},
+		{"*/*, application/json;q=0", MediaXML},
+		{"text/html", ""},
+		{"image/png, application/json;q=0", ""},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		got, ok := Negotiate(req, offers...)
+		if got != test.want || ok != (test.want != "") {
+			t.Errorf("Negotiate(%q) = %q, %v; want %q", test.accept, got, ok, test.want)
+		}
+	}
+}
+
+type testRow struct {
+	Name  string `json:"name" xml:"name"`
+	Count int    `json:"count" xml:"count"`
+}
+
+func (r testRow) CSVHeader() []string { return []string{"name", "count"} }
+func (r testRow) CSVRows() [][]string { return [][]string{{r.Name, "2"}} }
+
+func TestWriteFormatted(t *testing.T) {
+	row := testRow{Name: "a,b", Count: 2}
+	for mediaType, want := range map[string]string{
+		MediaJSON: `{"name":"a,b","count":2}` + "\n",
+		MediaXML:  `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<testRow><name>a,b</name><count>2</count></testRow>` + "\n",
+		MediaCSV:  "name,count\n\"a,b\",2\n",
+	} {
+		rr := httptest.NewRecorder()
+		WriteFormatted(rr, mediaType, row, 200)
+		if rr.Body.String() != want || !strings.HasPrefix(rr.Header().Get("Content-Type"), mediaType) || rr.Header().Get("Vary") != "Accept" {
+			t.Errorf("%s: got %q (%s); want %q", mediaType, rr.Body.String(), rr.Header().Get("Content-Type"), want)
+		}
+	}
+
+	// Cells that a spreadsheet would evaluate are sent as text
+	rr := httptest.NewRecorder()
+	WriteFormatted(rr, MediaCSV, testRow{Name: "=HYPERLINK(\"http://evil\")"}, 200)
+	if want := "name,count\n\"'=HYPERLINK(\"\"http://evil\"\")\",2\n"; rr.Body.String() != want {
+		t.Errorf("expected the formula to be escaped; got %q, want %q", rr.Body.String(), want)
+	}
+
+	rr = httptest.NewRecorder()
+	WriteFormattedError(rr, MediaXML, "Incorrect receipt ID", 404)
+	if rr.Code != 404 || !strings.Contains(rr.Body.String(), "<error>Incorrect receipt ID</error>") {
+		t.Errorf("unexpected XML error: %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestEscapeCSVCell(t *testing.T) {
+	tests := []struct {
+		cell, want string
+	}{
+		{"Target", "Target"},
+		{"", ""},
+		{"=1+1", "'=1+1"},
+		{"+1", "'+1"},
+		{"-1", "'-1"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"'quoted", "'quoted"},
+		{"'=1+1", "''=1+1"}, // already looks escaped
+	}
+	for _, test := range tests {
+		if got := EscapeCSVCell(test.cell); got != test.want {
+			t.Errorf("EscapeCSVCell(%q) = %q; want %q", test.cell, got, test.want)
+		}
+		if got := UnescapeCSVCell(test.want); got != test.cell {
+			t.Errorf("UnescapeCSVCell(%q) = %q; want %q", test.want, got, test.cell)
+		}
+	}
+}
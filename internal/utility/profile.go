@@ -0,0 +1,119 @@
+package utility
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Validation profiles for retailer names and item descriptions.
+const (
+	// ProfileUnicode accepts letters, marks and digits in any script, spaces
+	// and the profile's punctuation, and NFC-normalizes text before checking.
+	ProfileUnicode = "unicode"
+	// ProfileStrict is the original spec: ASCII word characters, spaces and
+	// '-', plus '&' in retailer names. Text is not normalized.
+	ProfileStrict = "strict"
+)
+
+// DefaultPunctuation is the punctuation the unicode profile accepts when none
+// is configured.
+const DefaultPunctuation = "-&'’.,_/()#+!"
+
+// ValidationProfile decides which characters retailer names and descriptions
+// may contain and how the retailer points rule counts characters.
+type ValidationProfile struct {
+	Name        string
+	Punctuation string
+}
+
+// NewValidationProfile checks and returns a profile. An empty name is the
+// unicode profile and empty punctuation is DefaultPunctuation; punctuation is
+// ignored by the strict profile.
+func NewValidationProfile(name, punctuation string) (*ValidationProfile, error) {
+	if name == "" {
+		name = ProfileUnicode
+	}
+	if name != ProfileUnicode && name != ProfileStrict {
+		return nil, errors.New("unknown validation profile " + strconv.Quote(name) + ", expected unicode or strict")
+	}
+	if punctuation == "" {
+		punctuation = DefaultPunctuation
+	}
+	for _, r := range punctuation {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsSpace(r) || unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return nil, errors.New("punctuation " + strconv.QuoteRune(r) + " is a letter, digit, space or control character")
+		}
+	}
+	return &ValidationProfile{Name: name, Punctuation: punctuation}, nil
+}
+
+// activeProfile is the profile used by validation and scoring; it defaults to
+// the unicode profile with DefaultPunctuation.
+var activeProfile atomic.Pointer[ValidationProfile]
+
+func init() {
+	profile, _ := NewValidationProfile(ProfileUnicode, DefaultPunctuation)
+	activeProfile.Store(profile)
+}
+
+// SetValidationProfile swaps in the profile used by later validation and
+// scoring. Receipts already stored are not revalidated.
+func SetValidationProfile(profile *ValidationProfile) {
+	activeProfile.Store(profile)
+}
+
+// CurrentValidationProfile returns the active profile.
+func CurrentValidationProfile() *ValidationProfile {
+	return activeProfile.Load()
+}
+
+// NormalizeText returns str in Unicode normalization form C, so that "é"
+// typed as one code point or as "e" plus a combining accent is the same
+// text. The strict profile leaves text unchanged.
+func NormalizeText(str string) string {
+	if CurrentValidationProfile().Name == ProfileStrict {
+		return str
+	}
+	return norm.NFC.String(str)
+}
+
+// CountAlphanumeric counts the letters and digits in str: any script under
+// the unicode profile, ASCII only under the strict profile.
+func CountAlphanumeric(str string) int {
+	strict := CurrentValidationProfile().Name == ProfileStrict
+	count := 0
+	for _, r := range str {
+		if strict {
+			if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				count++
+			}
+		} else if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			count++
+		}
+	}
+	return count
+}
+
+// isValidText reports whether str is non-empty and contains only letters,
+// marks, digits, whitespace and the profile's punctuation. Whitespace includes
+// tabs and line breaks, which the strict profile's \s also accepts.
+func (p *ValidationProfile) isValidText(str string) bool {
+	if str == "" {
+		return false
+	}
+	for _, r := range str {
+		switch {
+		case unicode.IsLetter(r), unicode.IsMark(r), unicode.IsDigit(r):
+		case unicode.IsSpace(r):
+		case strings.ContainsRune(p.Punctuation, r):
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,103 @@
+package utility
+
+import "testing"
+
+// useProfile makes name the active validation profile for the rest of the test.
+func useProfile(t *testing.T, name string) {
+	t.Helper()
+	previous := CurrentValidationProfile()
+	profile, err := NewValidationProfile(name, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetValidationProfile(profile)
+	t.Cleanup(func() { SetValidationProfile(previous) })
+}
+
+func TestValidationProfiles(t *testing.T) {
+	tests := []struct {
+		input           string
+		unicode, strict bool
+	}{
+		{"M&M Corner Market", true, true},
+		{"Café Olé", true, false},
+		{"ユニクロ", true, false},
+		{"Trader Joe's", true, false},
+		{"Trader Joe’s", true, false},
+		{"St. Mark's", true, false},
+		{"Cafe\u0301", true, false}, // combining accent
+		{"Invalid@Name", false, false},
+		{"Tab\tName", true, true},
+		{"Line\r\nBreak\f", true, true},
+		{"", false, false},
+	}
+	for _, name := range []string{ProfileUnicode, ProfileStrict} {
+		useProfile(t, name)
+		for _, test := range tests {
+			want := test.unicode
+			if name == ProfileStrict {
+				want = test.strict
+			}
+			if got := IsValidRetailerName(test.input); got != want {
+				t.Errorf("%s: IsValidRetailerName(%q) = %v; want %v", name, test.input, got, want)
+			}
+		}
+	}
+
+	// The strict profile keeps '&' out of descriptions
+	useProfile(t, ProfileStrict)
+	if IsValidShortDescription("Salt & Pepper") {
+		t.Error("expected '&' to be invalid in a strict description")
+	}
+}
+
+func TestValidationProfiles_Whitespace(t *testing.T) {
+	// Receipts valid under the strict profile stay valid under the default one
+	useProfile(t, ProfileUnicode)
+	if !IsValidRetailerName("Target\tStore") {
+		t.Error("expected a tab in a retailer name to be valid")
+	}
+	if !IsValidShortDescription("Mountain Dew\n12PK") {
+		t.Error("expected a newline in a description to be valid")
+	}
+}
+
+func TestNewValidationProfile(t *testing.T) {
+	profile, err := NewValidationProfile("", "")
+	if err != nil || profile.Name != ProfileUnicode || profile.Punctuation != DefaultPunctuation {
+		t.Errorf("NewValidationProfile defaults = %+v, %v", profile, err)
+	}
+	profile, err = NewValidationProfile(ProfileUnicode, "-@")
+	if err != nil || !profile.isValidText("a@b") || profile.isValidText("Joe's") {
+		t.Errorf("expected only the configured punctuation to be accepted; got %+v, %v", profile, err)
+	}
+	for _, bad := range [][2]string{{"latin1", ""}, {ProfileUnicode, "-a"}, {ProfileUnicode, "- "}} {
+		if _, err := NewValidationProfile(bad[0], bad[1]); err == nil {
+			t.Errorf("NewValidationProfile(%q, %q): expected an error", bad[0], bad[1])
+		}
+	}
+}
+
+func TestNormalizeText(t *testing.T) {
+	useProfile(t, ProfileUnicode)
+	if got := NormalizeText("Cafe\u0301"); got != "Café" {
+		t.Errorf("NormalizeText = %q; want NFC %q", got, "Café")
+	}
+	useProfile(t, ProfileStrict)
+	if got := NormalizeText("Cafe\u0301"); got != "Cafe\u0301" {
+		t.Errorf("expected the strict profile not to normalize; got %q", got)
+	}
+}
+
+func TestCountAlphanumeric(t *testing.T) {
+	useProfile(t, ProfileUnicode)
+	for input, want := range map[string]int{"M&M Corner Market": 14, "Café Olé": 7, "ユニクロ": 4, "Target_1": 7} {
+		if got := CountAlphanumeric(input); got != want {
+			t.Errorf("CountAlphanumeric(%q) = %d; want %d", input, got, want)
+		}
+	}
+	useProfile(t, ProfileStrict)
+	if got := CountAlphanumeric("Café Olé"); got != 5 {
+		t.Errorf("strict CountAlphanumeric = %d; want 5", got)
+	}
+}
@@ -2,28 +2,44 @@ package utility
 
 import (
 	"encoding/json"
-	"io/ioutil"
+	"errors"
+	"io"
 	"net/http"
 	"receipt-processor/internal/logger"
 	"regexp"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
-// Regex patterns compiled once for efficiency.
+// Regex patterns compiled once for efficiency. The retailer and description
+// patterns are the strict validation profile.
 var (
 	retailerRegex         = regexp.MustCompile(`^[\w\s\-&]+$`)
 	shortdescriptionRegex = regexp.MustCompile(`^[\w\s\-]+$`)
 	priceRegex            = regexp.MustCompile(`^\d+\.\d{2}$`)
+	quantityRegex         = regexp.MustCompile(`^\d+(\.\d{1,3})?$`)
 	dateRegex             = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
 	timeRegex             = regexp.MustCompile(`^(2[0-3]|[01][0-9]):([0-5][0-9])$`)
+	customerIDRegex       = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.@-]{0,127}$`)
+	storeIDRegex          = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,63}$`)
+	addressRegex          = regexp.MustCompile(`^[^\x00-\x1f\x7f]{1,200}$`)
+	postalCodeRegex       = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 -]{1,9}$`)
+	regionRegex           = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]{0,15}$`)
+	tenantIDRegex         = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,63}$`)
 )
 
-// IsValidRetailerName validates the retailer name against a regular expression.
+// IsValidRetailerName validates the retailer name under the active
+// validation profile.
 func IsValidRetailerName(str string) bool {
-	valid := retailerRegex.MatchString(str)
+	var valid bool
+	if profile := CurrentValidationProfile(); profile.Name == ProfileStrict {
+		valid = retailerRegex.MatchString(str)
+	} else {
+		valid = profile.isValidText(str)
+	}
 	if !valid {
 		logger.Error("Invalid retailer name", logrus.Fields{
 			"retailer_name": str,
@@ -32,9 +48,15 @@ func IsValidRetailerName(str string) bool {
 	return valid
 }
 
-// IsValidShortDescription validates the item description format.
+// IsValidShortDescription validates an item or discount description under the
+// active validation profile.
 func IsValidShortDescription(str string) bool {
-	valid := shortdescriptionRegex.MatchString(str)
+	var valid bool
+	if profile := CurrentValidationProfile(); profile.Name == ProfileStrict {
+		valid = shortdescriptionRegex.MatchString(str)
+	} else {
+		valid = profile.isValidText(str)
+	}
 	if !valid {
 		logger.Error("Invalid short description", logrus.Fields{
 			"short_description": str,
@@ -43,6 +65,43 @@ func IsValidShortDescription(str string) bool {
 	return valid
 }
 
+// IsValidCustomerID validates a loyalty customer ID.
+func IsValidCustomerID(str string) bool {
+	valid := customerIDRegex.MatchString(str)
+	if !valid {
+		logger.Error("Invalid customer ID", logrus.Fields{
+			"customer_id": str,
+		})
+	}
+	return valid
+}
+
+// IsValidStoreID validates a retailer's store number or code.
+func IsValidStoreID(str string) bool {
+	return storeIDRegex.MatchString(str)
+}
+
+// IsValidAddress validates a one-line street address: up to 200 characters
+// without control characters.
+func IsValidAddress(str string) bool {
+	return addressRegex.MatchString(str)
+}
+
+// IsValidPostalCode validates a postal or ZIP code.
+func IsValidPostalCode(str string) bool {
+	return postalCodeRegex.MatchString(str)
+}
+
+// IsValidRegion validates a region code such as "IL" or "US-IL".
+func IsValidRegion(str string) bool {
+	return regionRegex.MatchString(str)
+}
+
+// IsValidTenantID validates a tenant ID.
+func IsValidTenantID(str string) bool {
+	return tenantIDRegex.MatchString(str)
+}
+
 // IsValidPrice validates the price format.
 func IsValidPrice(str string) bool {
 	// Check format using regex
@@ -66,8 +125,56 @@ func IsValidPrice(str string) bool {
 	return true
 }
 
-// IsValidDate validates the date format.
+// Now returns the current time. Tests replace it to pin the date that the
+// future-date check compares against.
+var Now = time.Now
+
+// earliestZone is where the date changes first (UTC+14). A date with no known
+// time zone is only in the future if it is still in the future there.
+var earliestZone = time.FixedZone("UTC+14", 14*60*60)
+
+// locations caches time zones loaded by LoadLocation.
+var locations sync.Map
+
+// LoadLocation returns the time zone with the given IANA name, such as
+// "America/Chicago". Unlike time.LoadLocation it rejects "" and "Local".
+func LoadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	if name == "" || name == "Local" {
+		return nil, errors.New("not an IANA time zone name: " + strconv.Quote(name))
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// IsValidQuantity validates an item quantity: a positive number with up to
+// three decimal places.
+func IsValidQuantity(str string) bool {
+	if !quantityRegex.MatchString(str) {
+		logger.Error("Invalid quantity format", logrus.Fields{
+			"quantity": str,
+		})
+		return false
+	}
+	quantity, err := strconv.ParseFloat(str, 64)
+	return err == nil && quantity > 0
+}
+
+// IsValidDate validates the date format and that the date is not in the
+// future in every time zone.
 func IsValidDate(str string) bool {
+	return IsValidDateIn(str, nil)
+}
+
+// IsValidDateIn validates the date format and that the date is not after
+// today in loc. A nil loc accepts any date that has started somewhere.
+func IsValidDateIn(str string, loc *time.Location) bool {
 	if !dateRegex.MatchString(str) {
 		logger.Error("Invalid date format", logrus.Fields{
 			"date": str,
@@ -75,9 +182,8 @@ func IsValidDate(str string) bool {
 		return false
 	}
 
-	// Parse the date string into a time.Time object
-	parsedDate, err := time.Parse("2006-01-02", str)
-	if err != nil {
+	// Parse the date string to reject impossible dates such as 2022-02-30
+	if _, err := time.Parse("2006-01-02", str); err != nil {
 		logger.Error("Date parsing error", logrus.Fields{
 			"date":  str,
 			"error": err,
@@ -85,11 +191,16 @@ func IsValidDate(str string) bool {
 		return false
 	}
 
-	// Check if the parsed date is not in the future
-	today := time.Now().Truncate(24 * time.Hour) // Truncate to remove time portion
-	if parsedDate.After(today) {
+	// Check that the date is not in the future in the purchase time zone
+	if loc == nil {
+		loc = earliestZone
+	}
+	today := Now().In(loc).Format("2006-01-02")
+	if str > today {
 		logger.Error("Date is in the future", logrus.Fields{
-			"date": str,
+			"date":     str,
+			"today":    today,
+			"timezone": loc.String(),
 		})
 		return false
 	}
@@ -108,9 +219,11 @@ func IsValidTime(str string) bool {
 	return valid
 }
 
-// ReadBody reads the full request body into a byte slice.
+// ReadBody reads the full request body into a byte slice. When the body has
+// been wrapped with http.MaxBytesReader, reading past the limit returns an
+// error for which IsBodyTooLarge reports true.
 func ReadBody(r *http.Request) ([]byte, error) {
-	body, err := ioutil.ReadAll(r.Body)
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
 		logger.Error("Error reading body", logrus.Fields{
 			"error": err,
@@ -121,6 +234,12 @@ func ReadBody(r *http.Request) ([]byte, error) {
 	return body, nil
 }
 
+// IsBodyTooLarge reports whether err was caused by a request body exceeding its size limit.
+func IsBodyTooLarge(err error) bool {
+	var maxErr *http.MaxBytesError
+	return errors.As(err, &maxErr)
+}
+
 // ParseJSON parses the JSON-encoded data and stores the result in the value pointed to by target.
 func ParseJSON(body []byte, target any) error {
 	if err := json.Unmarshal(body, target); err != nil {
@@ -1,7 +1,11 @@
 package utility
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 // Test IsValidRetailerName
@@ -85,6 +89,43 @@ func TestIsValidDate(t *testing.T) {
 	}
 }
 
+// Test IsValidDateIn
+func TestIsValidDateIn(t *testing.T) {
+	// 2024-03-20 22:30 UTC is already 2024-03-21 in Tokyo but not in Chicago
+	defer func(now func() time.Time) { Now = now }(Now)
+	Now = func() time.Time { return time.Date(2024, 3, 20, 22, 30, 0, 0, time.UTC) }
+
+	tokyo, _ := LoadLocation("Asia/Tokyo")
+	chicago, _ := LoadLocation("America/Chicago")
+	tests := []struct {
+		date     string
+		loc      *time.Location
+		expected bool
+	}{
+		{"2024-03-20", time.UTC, true},
+		{"2024-03-21", time.UTC, false},
+		{"2024-03-21", tokyo, true},
+		{"2024-03-21", chicago, false},
+		{"2024-03-21", nil, true},  // today somewhere
+		{"2024-03-22", nil, false}, // not yet started anywhere
+		{"2024-02-30", nil, false}, // no such day
+	}
+	for _, test := range tests {
+		if result := IsValidDateIn(test.date, test.loc); result != test.expected {
+			t.Errorf("IsValidDateIn(%q, %v) = %v; want %v", test.date, test.loc, result, test.expected)
+		}
+	}
+}
+
+// Test LoadLocation
+func TestLoadLocation(t *testing.T) {
+	for name, valid := range map[string]bool{"Europe/Berlin": true, "UTC": true, "": false, "Local": false, "Mars/Olympus": false} {
+		if _, err := LoadLocation(name); (err == nil) != valid {
+			t.Errorf("LoadLocation(%q) error = %v; want valid %v", name, err, valid)
+		}
+	}
+}
+
 // Test IsValidTime
 func TestIsValidTime(t *testing.T) {
 	tests := []struct {
@@ -104,3 +145,21 @@ func TestIsValidTime(t *testing.T) {
 		}
 	}
 }
+
+// Test ReadBody
+func TestReadBody(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", strings.NewReader("hello"))
+	body, err := ReadBody(req)
+	if err != nil || string(body) != "hello" {
+		t.Errorf("ReadBody() = %q, %v; want %q, nil", body, err, "hello")
+	}
+
+	// Bodies over the MaxBytesReader limit are reported as too large
+	rr := httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/", strings.NewReader("hello world"))
+	req.Body = http.MaxBytesReader(rr, req.Body, 5)
+	_, err = ReadBody(req)
+	if !IsBodyTooLarge(err) {
+		t.Errorf("ReadBody() error = %v; want body too large", err)
+	}
+}